@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"io"
 	"log"
 	"os"
@@ -14,9 +15,20 @@ The bot will also be able to add new gifs to the list of gifs that it can send b
 */
 
 func main() {
+	console := flag.Bool("console", false, "run offline, reading messages from stdin and printing responses")
+	flag.Parse()
+
 	// Configure logging to be more selective
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 
+	// The console keeps its logs on stderr, out of the way of responses
+	if *console {
+		if err := server.RunConsole(os.Stdin, os.Stdout); err != nil {
+			log.Fatalf("Console failed: %v", err)
+		}
+		return
+	}
+
 	// Create log file for persistent logging
 	logFile, err := os.OpenFile("thelistbot.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err == nil {
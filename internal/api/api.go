@@ -0,0 +1,278 @@
+// Package api serves an HTTP JSON API for managing gif lists and reading
+// code counts, so other tools can script the list without chat commands.
+// Every request needs one of the configured API tokens.
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"theListBot/internal/combo"
+	"theListBot/internal/giflist"
+)
+
+// addedBy is recorded as the author of changes made through the API
+const addedBy = "api"
+
+// maxBodyBytes limits request bodies, which only ever hold a URL
+const maxBodyBytes = 64 << 10
+
+// Config says where the API listens and which tokens it accepts
+type Config struct {
+	Addr   string   // Listen address like 127.0.0.1:8080, empty turns the API off
+	Tokens []string // Accepted bearer tokens
+}
+
+// ConfigFromEnv reads GIFLIST_API_ADDR and GIFLIST_API_TOKENS (comma separated)
+func ConfigFromEnv() Config {
+	cfg := Config{Addr: strings.TrimSpace(os.Getenv("GIFLIST_API_ADDR"))}
+	for _, token := range strings.Split(os.Getenv("GIFLIST_API_TOKENS"), ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			cfg.Tokens = append(cfg.Tokens, token)
+		}
+	}
+	return cfg
+}
+
+// Enabled reports whether the API should be served. Without tokens nobody
+// could use it, so it stays off.
+func (c Config) Enabled() bool {
+	return c.Addr != "" && len(c.Tokens) > 0
+}
+
+// API answers requests against the bot's gif lists and counts
+type API struct {
+	gifLists *giflist.Registry
+	combos   *combo.Registry
+	tokens   [][]byte
+	mux      *http.ServeMux
+}
+
+// New creates an API over gif lists and combo counts that accepts tokens
+func New(gifLists *giflist.Registry, combos *combo.Registry, tokens []string) *API {
+	a := &API{gifLists: gifLists, combos: combos, mux: http.NewServeMux()}
+	for _, token := range tokens {
+		a.tokens = append(a.tokens, []byte(token))
+	}
+
+	a.mux.HandleFunc("GET /api/guilds", a.listGuilds)
+	a.mux.HandleFunc("GET /api/guilds/{guild}/codes", a.listCodes)
+	a.mux.HandleFunc("GET /api/guilds/{guild}/codes/{code}", a.getCode)
+	a.mux.HandleFunc("DELETE /api/guilds/{guild}/codes/{code}", a.removeCode)
+	a.mux.HandleFunc("POST /api/guilds/{guild}/codes/{code}/gifs", a.addGif)
+	a.mux.HandleFunc("DELETE /api/guilds/{guild}/codes/{code}/gifs", a.removeGif)
+	a.mux.HandleFunc("GET /api/guilds/{guild}/counts/daily", a.dailyCounts)
+	a.mux.HandleFunc("GET /api/guilds/{guild}/counts/lifetime", a.lifetimeCounts)
+	return a
+}
+
+// ServeHTTP checks the request's token and routes it
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="theListBot"`)
+		writeError(w, http.StatusUnauthorized, "missing or invalid API token")
+		return
+	}
+	a.mux.ServeHTTP(w, r)
+}
+
+// authorized reports whether a request carries one of the API tokens
+func (a *API) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	for _, valid := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), valid) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// CodeSummary is one code in a listing
+type CodeSummary struct {
+	Code     string                `json:"code"`
+	GifCount int                   `json:"gif_count"`
+	Mode     giflist.SelectionMode `json:"mode,omitempty"`
+	AliasOf  string                `json:"alias_of,omitempty"`
+	Picks    int                   `json:"picks"` // Picks of this guild's GIFs, uses are under counts
+}
+
+// CodeDetail is a single code with its GIFs
+type CodeDetail struct {
+	Code    string                `json:"code"`
+	AliasOf string                `json:"alias_of,omitempty"` // Canonical code when Code is an alias
+	Mode    giflist.SelectionMode `json:"mode"`
+	Gifs    []giflist.Gif         `json:"gifs"`
+}
+
+// gifRequest is the body of an add request
+type gifRequest struct {
+	URL string `json:"url"`
+}
+
+// listGuilds returns the IDs of every guild with a gif list
+func (a *API) listGuilds(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.gifLists.Guilds())
+}
+
+// listCodes returns every code of a guild with its GIF and pick counts,
+// sorted by code. Use counts are served by the counts endpoints.
+func (a *API) listCodes(w http.ResponseWriter, r *http.Request) {
+	gifList, ok := a.guildList(w, r)
+	if !ok {
+		return
+	}
+
+	details := gifList.ListCodesWithCounts()
+	codes := make([]CodeSummary, 0, len(details))
+	for _, d := range details {
+		codes = append(codes, CodeSummary{
+			Code:     d.Code,
+			GifCount: d.GifCount,
+			Mode:     d.Mode,
+			AliasOf:  d.AliasOf,
+			Picks:    d.Picks,
+		})
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code })
+	writeJSON(w, http.StatusOK, codes)
+}
+
+// getCode returns one code and its GIFs
+func (a *API) getCode(w http.ResponseWriter, r *http.Request) {
+	gifList, ok := a.guildList(w, r)
+	if !ok {
+		return
+	}
+	code := strings.ToLower(r.PathValue("code"))
+	detail, found := codeDetail(gifList, code)
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("code %s not found", code))
+		return
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// addGif adds a URL to a code, creating the code if needed
+func (a *API) addGif(w http.ResponseWriter, r *http.Request) {
+	gifList, ok := a.guildList(w, r)
+	if !ok {
+		return
+	}
+	code := strings.ToLower(r.PathValue("code"))
+
+	var body gifRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	if err := gifList.AddGifBy(code, strings.TrimSpace(body.URL), addedBy); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	log.Printf("API added GIF to code %s in guild %s: %s", code, r.PathValue("guild"), body.URL)
+	detail, _ := codeDetail(gifList, code)
+	writeJSON(w, http.StatusCreated, detail)
+}
+
+// removeGif removes the URL given in the url query parameter from a code
+func (a *API) removeGif(w http.ResponseWriter, r *http.Request) {
+	gifList, ok := a.guildList(w, r)
+	if !ok {
+		return
+	}
+	code := strings.ToLower(r.PathValue("code"))
+	gifURL := r.URL.Query().Get("url")
+	if gifURL == "" {
+		writeError(w, http.StatusBadRequest, "the url query parameter is required")
+		return
+	}
+
+	if !gifList.RemoveGifBy(code, gifURL, addedBy) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("code %s has no GIF %s", code, gifURL))
+		return
+	}
+	log.Printf("API removed GIF from code %s in guild %s: %s", code, r.PathValue("guild"), gifURL)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeCode removes a code and all of its GIFs
+func (a *API) removeCode(w http.ResponseWriter, r *http.Request) {
+	gifList, ok := a.guildList(w, r)
+	if !ok {
+		return
+	}
+	code := strings.ToLower(r.PathValue("code"))
+
+	if !gifList.RemoveCodeBy(code, addedBy) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("code %s not found", code))
+		return
+	}
+	log.Printf("API removed code %s in guild %s", code, r.PathValue("guild"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// dailyCounts returns how often each code of a guild was used today
+func (a *API) dailyCounts(w http.ResponseWriter, r *http.Request) {
+	if _, ok := a.guildList(w, r); !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, a.combos.ForGuild(r.PathValue("guild")).GetDailyCounts())
+}
+
+// lifetimeCounts returns how often each code of a guild was ever used
+func (a *API) lifetimeCounts(w http.ResponseWriter, r *http.Request) {
+	if _, ok := a.guildList(w, r); !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, a.combos.ForGuild(r.PathValue("guild")).GetLifetimeCounts())
+}
+
+// guildList returns the gif list of the guild in the path. Unknown guilds
+// get a 404 rather than a new empty list, so a typo can't create one.
+func (a *API) guildList(w http.ResponseWriter, r *http.Request) (*giflist.GifList, bool) {
+	guildID := r.PathValue("guild")
+	if !slices.Contains(a.gifLists.Guilds(), guildID) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("guild %s has no gif list", guildID))
+		return nil, false
+	}
+	return a.gifLists.ForGuild(guildID), true
+}
+
+// codeDetail collects a code's GIFs, following aliases
+func codeDetail(gifList *giflist.GifList, code string) (CodeDetail, bool) {
+	gifs, found := gifList.GetGifDetails(code)
+	if !found {
+		return CodeDetail{}, false
+	}
+	mode, _ := gifList.GetMode(code)
+
+	detail := CodeDetail{Code: code, Mode: mode, Gifs: gifs}
+	if canonical := gifList.Resolve(code); canonical != code {
+		detail.AliasOf = canonical
+	}
+	return detail, true
+}
+
+// writeJSON sends a JSON response
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("Failed to write API response: %v", err)
+	}
+}
+
+// writeError sends a JSON error
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"theListBot/internal/combo"
+	"theListBot/internal/giflist"
+	"time"
+)
+
+const testToken = "secret"
+
+func newTestAPI(t *testing.T) (*API, *giflist.Registry, *combo.Registry) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("GIFLIST_CONFIG_PATH", dir)
+	t.Setenv("GIFLIST_DEFAULT_GUILD", "")
+	t.Setenv("GIFLIST_MIRROR", "")
+
+	gifLists := giflist.NewRegistry()
+	t.Cleanup(gifLists.Close)
+	combos := combo.NewRegistry(time.Minute, gifLists.GuildDir)
+	return New(gifLists, combos, []string{"other", testToken}), gifLists, combos
+}
+
+// do sends a request with the test token and decodes a JSON response into out
+func do(t *testing.T, a *API, method string, path string, body string, out any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, req)
+
+	if out != nil && rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("Failed to decode %s %s response %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestTokensRequired(t *testing.T) {
+	a, _, _ := newTestAPI(t)
+
+	for _, header := range []string{"", "Bearer", "Bearer wrong", "secret"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/guilds", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		a.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected 401, got %d", header, rec.Code)
+		}
+	}
+
+	if code := do(t, a, http.MethodGet, "/api/guilds", "", nil); code != http.StatusOK {
+		t.Errorf("Expected a valid token to be accepted, got %d", code)
+	}
+}
+
+func TestManageCodes(t *testing.T) {
+	a, gifLists, _ := newTestAPI(t)
+	gifLists.ForGuild("g1")
+
+	if code := do(t, a, http.MethodGet, "/api/guilds/nope/codes", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected unknown guilds to be 404, got %d", code)
+	}
+
+	var detail CodeDetail
+	code := do(t, a, http.MethodPost, "/api/guilds/g1/codes/WAVE/gifs", `{"url": "https://example.com/wave.gif"}`, &detail)
+	if code != http.StatusCreated || detail.Code != "wave" || len(detail.Gifs) != 1 || detail.Gifs[0].AddedBy != "api" {
+		t.Fatalf("Unexpected add response %d %+v", code, detail)
+	}
+	var failure map[string]string
+	if code := do(t, a, http.MethodPost, "/api/guilds/g1/codes/wave/gifs", `{"url": "https://example.com/wave.gif"}`, &failure); code != http.StatusBadRequest || failure["error"] == "" {
+		t.Errorf("Expected duplicate URLs to be rejected, got %d %v", code, failure)
+	}
+	do(t, a, http.MethodPost, "/api/guilds/g1/codes/wave/gifs", `{"url": "https://example.com/wave2.gif"}`, nil)
+
+	gifLists.ForGuild("g1").PickGif("wave", "c1")
+	var codes []CodeSummary
+	do(t, a, http.MethodGet, "/api/guilds/g1/codes", "", &codes)
+	found := false
+	for _, c := range codes {
+		if c.Code == "wave" {
+			found = c.GifCount == 2 && c.Picks == 1
+		}
+	}
+	if !found {
+		t.Errorf("Expected wave with 2 GIFs and one pick, got %+v", codes)
+	}
+
+	path := "/api/guilds/g1/codes/wave/gifs?url=" + url.QueryEscape("https://example.com/wave.gif")
+	if code := do(t, a, http.MethodDelete, path, "", nil); code != http.StatusNoContent {
+		t.Errorf("Expected removing a GIF to succeed, got %d", code)
+	}
+	if code := do(t, a, http.MethodDelete, path, "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected removing a missing GIF to be 404, got %d", code)
+	}
+	do(t, a, http.MethodGet, "/api/guilds/g1/codes/wave", "", &detail)
+	if len(detail.Gifs) != 1 || detail.Gifs[0].URL != "https://example.com/wave2.gif" {
+		t.Errorf("Expected only wave2 left, got %+v", detail.Gifs)
+	}
+
+	if code := do(t, a, http.MethodDelete, "/api/guilds/g1/codes/wave", "", nil); code != http.StatusNoContent {
+		t.Errorf("Expected removing the code to succeed, got %d", code)
+	}
+	if code := do(t, a, http.MethodGet, "/api/guilds/g1/codes/wave", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected the removed code to be 404, got %d", code)
+	}
+}
+
+func TestCounts(t *testing.T) {
+	a, gifLists, combos := newTestAPI(t)
+	gifLists.ForGuild("g1").AddGif("wave", "https://example.com/wave.gif")
+	gifLists.ForGuild("g2").AddGif("other", "https://example.com/other.gif")
+	combos.ForGuild("g1").RecordCode("u1", "wave")
+	combos.ForGuild("g1").RecordCode("u2", "wave")
+	combos.ResetDailyCounts()
+	combos.ForGuild("g1").RecordCode("u1", "gg")
+	combos.ForGuild("g2").RecordCode("u1", "other")
+
+	var daily, lifetime map[string]int
+	do(t, a, http.MethodGet, "/api/guilds/g1/counts/daily", "", &daily)
+	do(t, a, http.MethodGet, "/api/guilds/g1/counts/lifetime", "", &lifetime)
+	if daily["gg"] != 1 || daily["wave"] != 0 || lifetime["wave"] != 2 || lifetime["gg"] != 1 {
+		t.Errorf("Unexpected counts, daily %v lifetime %v", daily, lifetime)
+	}
+	if _, found := lifetime["other"]; found {
+		t.Errorf("Expected another guild's codes to be left out, got %v", lifetime)
+	}
+	if code := do(t, a, http.MethodGet, "/api/guilds/nope/counts/daily", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected counts of an unknown guild to be 404, got %d", code)
+	}
+	if code := do(t, a, http.MethodPost, "/api/guilds/g1/counts/daily", "", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected counts to be read only, got %d", code)
+	}
+}
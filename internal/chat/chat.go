@@ -0,0 +1,120 @@
+// Package chat describes chat messages and responses without tying them to
+// a platform, so the bot's commands can run on Discord, in tests, or
+// anywhere else a Conn is implemented
+package chat
+
+import (
+	"io"
+	"theListBot/internal/permissions"
+	"time"
+)
+
+// User is the author of a message
+type User struct {
+	ID   string
+	Name string
+}
+
+// Attachment is a file sent with a message
+type Attachment struct {
+	Name string
+	URL  string
+	Size int
+}
+
+// Message is an incoming chat message
+type Message struct {
+	ID          string
+	ChannelID   string
+	GuildID     string // Empty for direct messages
+	Author      User
+	AuthorRoles []string // Roles of the author in the guild, on platforms that have them
+	Content     string
+	Attachments []Attachment
+}
+
+// Field is a titled section of an embed
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Embed is a rich block of text, shown as plain text where the platform
+// has nothing better
+type Embed struct {
+	Title       string
+	Description string
+	Color       int
+	ImageURL    string
+	Fields      []Field
+	Footer      string
+	Timestamp   time.Time
+}
+
+// ButtonStyle is the color of a button
+type ButtonStyle int
+
+// Supported button styles
+const (
+	Secondary ButtonStyle = iota
+	Primary
+	Success
+	Danger
+)
+
+// Button is a button under a response. Pressing it sends ID back to the bot.
+type Button struct {
+	Label    string
+	ID       string
+	Style    ButtonStyle
+	Disabled bool
+}
+
+// File is an upload sent with a response
+type File struct {
+	Name        string
+	ContentType string
+	Reader      io.Reader
+}
+
+// Response is an outgoing message
+type Response struct {
+	Text       string
+	Embeds     []Embed
+	Files      []File
+	Buttons    []Button
+	NoMentions bool // Show mentions without notifying anyone
+}
+
+// Text returns a plain text response
+func Text(text string) Response {
+	return Response{Text: text}
+}
+
+// Conn is a connection to a chat platform
+type Conn interface {
+	// Send posts a response in a channel and returns the new message's ID
+	Send(channelID string, response Response) (string, error)
+	// Edit replaces a message the bot sent earlier
+	Edit(channelID string, messageID string, response Response) error
+	// React adds an emoji reaction to a message
+	React(channelID string, messageID string, emoji string) error
+	// Member returns what the author of a message is allowed to do
+	Member(message Message) permissions.Member
+	// SupportsComponents reports whether buttons under a response work
+	SupportsComponents() bool
+}
+
+// Throttled is implemented by connections that get disconnected for
+// sending too much at once. Replies that would take more than MaxMessages
+// messages are cut short.
+type Throttled interface {
+	MaxMessages() int
+}
+
+// ChannelGuilds is implemented by connections that serve several guilds at
+// once, where a channel ID from a user may belong to another guild
+type ChannelGuilds interface {
+	// ChannelGuild returns the guild a channel belongs to
+	ChannelGuild(channelID string) (string, error)
+}
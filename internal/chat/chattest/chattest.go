@@ -0,0 +1,188 @@
+// Package chattest provides an in-memory chat.Conn for tests
+package chattest
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"theListBot/internal/chat"
+	"theListBot/internal/permissions"
+)
+
+// Sent is a response the bot sent, with uploads read into memory
+type Sent struct {
+	ID        string
+	ChannelID string
+	Response  chat.Response
+	Files     map[string][]byte // Upload contents by file name
+}
+
+// Reaction is an emoji the bot reacted with
+type Reaction struct {
+	ChannelID string
+	MessageID string
+	Emoji     string
+}
+
+// Conn records everything the bot sends instead of sending it
+type Conn struct {
+	mutex     sync.Mutex
+	sent      []Sent
+	read      int // How many of sent were returned by Sent already
+	reactions []Reaction
+	members   map[string]permissions.Member
+	channels  map[string]string // Guild of each channel set with SetChannelGuild
+	nextID    int
+	noButtons bool // Pretend to be a platform without buttons
+}
+
+// New creates an empty Conn
+func New() *Conn {
+	return &Conn{members: make(map[string]permissions.Member), channels: make(map[string]string)}
+}
+
+// SetChannelGuild puts a channel in a guild. Channels not set are unknown.
+func (c *Conn) SetChannelGuild(channelID string, guildID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.channels[channelID] = guildID
+}
+
+// ChannelGuild returns the guild set with SetChannelGuild
+func (c *Conn) ChannelGuild(channelID string) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	guildID, ok := c.channels[channelID]
+	if !ok {
+		return "", fmt.Errorf("unknown channel %s", channelID)
+	}
+	return guildID, nil
+}
+
+// SetMember sets the roles and permissions of a user. Users not set have
+// neither.
+func (c *Conn) SetMember(member permissions.Member) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.members[member.UserID] = member
+}
+
+// SetComponents sets whether the Conn claims buttons work, they do by default
+func (c *Conn) SetComponents(supported bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.noButtons = !supported
+}
+
+// SupportsComponents reports what SetComponents set
+func (c *Conn) SupportsComponents() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return !c.noButtons
+}
+
+// Send records a response
+func (c *Conn) Send(channelID string, response chat.Response) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.nextID++
+	sent := Sent{ID: fmt.Sprintf("m%d", c.nextID), ChannelID: channelID, Response: response}
+	for _, file := range response.Files {
+		data, err := io.ReadAll(file.Reader)
+		if err != nil {
+			return "", err
+		}
+		if sent.Files == nil {
+			sent.Files = make(map[string][]byte)
+		}
+		sent.Files[file.Name] = data
+	}
+	c.sent = append(c.sent, sent)
+	return sent.ID, nil
+}
+
+// Edit replaces a recorded response
+func (c *Conn) Edit(channelID string, messageID string, response chat.Response) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i := range c.sent {
+		if c.sent[i].ID == messageID && c.sent[i].ChannelID == channelID {
+			c.sent[i].Response = response
+			return nil
+		}
+	}
+	return fmt.Errorf("message %s not found in %s", messageID, channelID)
+}
+
+// React records a reaction
+func (c *Conn) React(channelID string, messageID string, emoji string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.reactions = append(c.reactions, Reaction{ChannelID: channelID, MessageID: messageID, Emoji: emoji})
+	return nil
+}
+
+// Member returns what SetMember set for the author
+func (c *Conn) Member(message chat.Message) permissions.Member {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if member, ok := c.members[message.Author.ID]; ok {
+		return member
+	}
+	return permissions.Member{UserID: message.Author.ID, Roles: message.AuthorRoles}
+}
+
+// Sent returns what was sent since the last call, as it looks now
+func (c *Conn) Sent() []Sent {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	sent := append([]Sent(nil), c.sent[c.read:]...)
+	c.read = len(c.sent)
+	return sent
+}
+
+// Message returns a sent message as it looks now
+func (c *Conn) Message(id string) (Sent, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, sent := range c.sent {
+		if sent.ID == id {
+			return sent, true
+		}
+	}
+	return Sent{}, false
+}
+
+// Reactions returns every reaction so far and forgets them
+func (c *Conn) Reactions() []Reaction {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	reactions := c.reactions
+	c.reactions = nil
+	return reactions
+}
+
+// Text returns the text of a sent response, including its embeds
+func (s Sent) Text() string {
+	parts := []string{s.Response.Text}
+	for _, embed := range s.Response.Embeds {
+		parts = append(parts, embed.Title, embed.Description)
+		for _, field := range embed.Fields {
+			parts = append(parts, field.Name, field.Value)
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n"))
+}
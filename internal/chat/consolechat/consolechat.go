@@ -0,0 +1,102 @@
+// Package consolechat implements chat.Conn on a terminal, printing what the
+// bot sends as plain text
+package consolechat
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"theListBot/internal/chat"
+	"theListBot/internal/permissions"
+)
+
+// Conn prints responses to a writer, leaving out buttons since they can't be
+// pressed. Every author gets the same member, so the console decides what
+// its user may do.
+type Conn struct {
+	mutex  sync.Mutex
+	out    io.Writer
+	member permissions.Member
+	nextID int
+}
+
+// New creates a Conn that prints to out and treats every author as member
+func New(out io.Writer, member permissions.Member) *Conn {
+	return &Conn{out: out, member: member}
+}
+
+// Send prints a response
+func (c *Conn) Send(channelID string, response chat.Response) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.nextID++
+	id := fmt.Sprintf("m%d", c.nextID)
+	return id, c.print(id, response)
+}
+
+// Edit prints the new version of a message
+func (c *Conn) Edit(channelID string, messageID string, response chat.Response) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.print(messageID+" edited", response)
+}
+
+// React prints a reaction
+func (c *Conn) React(channelID string, messageID string, emoji string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	_, err := fmt.Fprintf(c.out, "[reacted %s to %s]\n", emoji, messageID)
+	return err
+}
+
+// Member returns the console's member with the author's ID
+func (c *Conn) Member(message chat.Message) permissions.Member {
+	member := c.member
+	member.UserID = message.Author.ID
+	return member
+}
+
+// SupportsComponents reports false, buttons can't be pressed on a terminal
+func (c *Conn) SupportsComponents() bool {
+	return false
+}
+
+// print writes a response under a header. Callers must hold the lock.
+func (c *Conn) print(header string, response chat.Response) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s]\n", header)
+	if response.Text != "" {
+		b.WriteString(response.Text + "\n")
+	}
+	for _, embed := range response.Embeds {
+		if embed.Title != "" {
+			fmt.Fprintf(&b, "== %s ==\n", embed.Title)
+		}
+		if embed.Description != "" {
+			b.WriteString(embed.Description + "\n")
+		}
+		for _, field := range embed.Fields {
+			fmt.Fprintf(&b, "%s: %s\n", field.Name, field.Value)
+		}
+		if embed.ImageURL != "" {
+			fmt.Fprintf(&b, "(image %s)\n", embed.ImageURL)
+		}
+		if embed.Footer != "" {
+			fmt.Fprintf(&b, "-- %s\n", embed.Footer)
+		}
+	}
+	for _, file := range response.Files {
+		data, err := io.ReadAll(file.Reader)
+		if err != nil {
+			return fmt.Errorf("failed to read upload %s: %v", file.Name, err)
+		}
+		fmt.Fprintf(&b, "(file %s, %d bytes)\n", file.Name, len(data))
+	}
+
+	_, err := io.WriteString(c.out, b.String())
+	return err
+}
@@ -0,0 +1,240 @@
+// Package discordchat connects the platform-neutral chat types to Discord
+package discordchat
+
+import (
+	"log"
+	"theListBot/internal/chat"
+	"theListBot/internal/permissions"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Conn sends responses through a Discord session
+type Conn struct {
+	Session *discordgo.Session
+}
+
+// New creates a Conn for a session
+func New(session *discordgo.Session) *Conn {
+	return &Conn{Session: session}
+}
+
+// Message converts a Discord message event
+func Message(m *discordgo.MessageCreate) chat.Message {
+	message := chat.Message{
+		ID:        m.ID,
+		ChannelID: m.ChannelID,
+		GuildID:   m.GuildID,
+		Author:    chat.User{ID: m.Author.ID, Name: m.Author.Username},
+		Content:   m.Content,
+	}
+	if m.Member != nil {
+		message.AuthorRoles = m.Member.Roles
+	}
+	for _, attachment := range m.Attachments {
+		message.Attachments = append(message.Attachments, chat.Attachment{
+			Name: attachment.Filename,
+			URL:  attachment.URL,
+			Size: attachment.Size,
+		})
+	}
+	return message
+}
+
+// Send posts a response in a channel
+func (c *Conn) Send(channelID string, response chat.Response) (string, error) {
+	sent, err := c.Session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:         response.Text,
+		Embeds:          Embeds(response.Embeds),
+		Files:           Files(response.Files),
+		Components:      Components(response.Buttons),
+		AllowedMentions: allowedMentions(response),
+	})
+	if err != nil {
+		return "", err
+	}
+	return sent.ID, nil
+}
+
+// ChannelGuild returns the guild of a channel, from the state cache if the
+// bot has seen it
+func (c *Conn) ChannelGuild(channelID string) (string, error) {
+	channel, err := c.Session.State.Channel(channelID)
+	if err != nil {
+		channel, err = c.Session.Channel(channelID)
+		if err != nil {
+			return "", err
+		}
+	}
+	return channel.GuildID, nil
+}
+
+// Edit replaces the content, embeds and buttons of a message
+func (c *Conn) Edit(channelID string, messageID string, response chat.Response) error {
+	embeds := Embeds(response.Embeds)
+	components := Components(response.Buttons)
+	if embeds == nil {
+		embeds = []*discordgo.MessageEmbed{}
+	}
+	if components == nil {
+		components = []discordgo.MessageComponent{}
+	}
+
+	_, err := c.Session.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:              messageID,
+		Channel:         channelID,
+		Content:         &response.Text,
+		Embeds:          &embeds,
+		Components:      &components,
+		AllowedMentions: allowedMentions(response),
+	})
+	return err
+}
+
+// React adds an emoji reaction to a message
+func (c *Conn) React(channelID string, messageID string, emoji string) error {
+	return c.Session.MessageReactionAdd(channelID, messageID, emoji)
+}
+
+// Member looks up the roles and channel permissions of a message's author.
+// Direct messages have neither. Permissions come from the message's roles
+// and the cached guild and channel, and only fall back to asking Discord
+// when the message came without the author's roles or nothing is cached.
+func (c *Conn) Member(message chat.Message) permissions.Member {
+	member := permissions.Member{UserID: message.Author.ID}
+	if message.GuildID == "" {
+		return member
+	}
+
+	member.Roles = message.AuthorRoles
+
+	if message.AuthorRoles != nil {
+		channelPermissions, err := c.Session.State.MessagePermissions(&discordgo.Message{
+			ChannelID: message.ChannelID,
+			Author:    &discordgo.User{ID: message.Author.ID},
+			Member:    &discordgo.Member{Roles: message.AuthorRoles},
+		})
+		if err == nil {
+			member.Permissions = channelPermissions
+			return member
+		}
+	}
+
+	channelPermissions, err := c.Session.UserChannelPermissions(message.Author.ID, message.ChannelID)
+	if err != nil {
+		log.Printf("Error checking permissions of %s in %s: %v", message.Author.ID, message.ChannelID, err)
+	}
+	member.Permissions = channelPermissions
+	return member
+}
+
+// SupportsComponents reports true, Discord has buttons
+func (c *Conn) SupportsComponents() bool {
+	return true
+}
+
+// InteractionMember describes whoever pressed a button or ran a command
+func InteractionMember(i *discordgo.InteractionCreate) permissions.Member {
+	if i.Member == nil {
+		return permissions.Member{UserID: i.User.ID}
+	}
+	return permissions.Member{
+		UserID:      i.Member.User.ID,
+		Roles:       i.Member.Roles,
+		Permissions: i.Member.Permissions,
+	}
+}
+
+// Embeds converts embeds to Discord's
+func Embeds(embeds []chat.Embed) []*discordgo.MessageEmbed {
+	if len(embeds) == 0 {
+		return nil
+	}
+
+	converted := make([]*discordgo.MessageEmbed, 0, len(embeds))
+	for _, embed := range embeds {
+		e := &discordgo.MessageEmbed{
+			Title:       embed.Title,
+			Description: embed.Description,
+			Color:       embed.Color,
+		}
+		if embed.ImageURL != "" {
+			e.Image = &discordgo.MessageEmbedImage{URL: embed.ImageURL}
+		}
+		if embed.Footer != "" {
+			e.Footer = &discordgo.MessageEmbedFooter{Text: embed.Footer}
+		}
+		if !embed.Timestamp.IsZero() {
+			e.Timestamp = embed.Timestamp.Format(time.RFC3339)
+		}
+		for _, field := range embed.Fields {
+			e.Fields = append(e.Fields, &discordgo.MessageEmbedField{Name: field.Name, Value: field.Value})
+		}
+		converted = append(converted, e)
+	}
+	return converted
+}
+
+// Components converts buttons into a single row of Discord buttons
+func Components(buttons []chat.Button) []discordgo.MessageComponent {
+	if len(buttons) == 0 {
+		return nil
+	}
+
+	row := make([]discordgo.MessageComponent, 0, len(buttons))
+	for _, button := range buttons {
+		row = append(row, discordgo.Button{
+			Label:    button.Label,
+			Style:    buttonStyle(button.Style),
+			CustomID: button.ID,
+			Disabled: button.Disabled,
+		})
+	}
+	return []discordgo.MessageComponent{discordgo.ActionsRow{Components: row}}
+}
+
+// Files converts uploads to Discord's
+func Files(files []chat.File) []*discordgo.File {
+	if len(files) == 0 {
+		return nil
+	}
+
+	converted := make([]*discordgo.File, 0, len(files))
+	for _, file := range files {
+		converted = append(converted, &discordgo.File{Name: file.Name, ContentType: file.ContentType, Reader: file.Reader})
+	}
+	return converted
+}
+
+// InteractionData converts a response into the data of an interaction response
+func InteractionData(response chat.Response) *discordgo.InteractionResponseData {
+	return &discordgo.InteractionResponseData{
+		Content:         response.Text,
+		Embeds:          Embeds(response.Embeds),
+		Files:           Files(response.Files),
+		Components:      Components(response.Buttons),
+		AllowedMentions: allowedMentions(response),
+	}
+}
+
+// buttonStyle converts a button style to Discord's
+func buttonStyle(style chat.ButtonStyle) discordgo.ButtonStyle {
+	switch style {
+	case chat.Primary:
+		return discordgo.PrimaryButton
+	case chat.Success:
+		return discordgo.SuccessButton
+	case chat.Danger:
+		return discordgo.DangerButton
+	}
+	return discordgo.SecondaryButton
+}
+
+// allowedMentions stops a response from notifying anyone if it asked to
+func allowedMentions(response chat.Response) *discordgo.MessageAllowedMentions {
+	if response.NoMentions {
+		return &discordgo.MessageAllowedMentions{}
+	}
+	return nil
+}
@@ -0,0 +1,537 @@
+// Package ircchat connects the bot to an IRC network. It joins the
+// configured channels, hands every PRIVMSG to the bot as a chat.Message and
+// reconnects with backoff when the connection drops.
+package ircchat
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"theListBot/internal/chat"
+	"theListBot/internal/permissions"
+	"time"
+)
+
+// Defaults for settings left out of the environment
+const (
+	defaultNick         = "theListBot"
+	defaultGuild        = "irc"
+	defaultMinBackoff   = 2 * time.Second
+	defaultMaxBackoff   = 5 * time.Minute
+	defaultSendBurst    = 5
+	defaultSendInterval = 500 * time.Millisecond
+	readTimeout         = 5 * time.Minute // Servers PING well within this
+	maxLineBytes        = 400             // Leaves room for the prefix the server adds when relaying
+	maxResponseLines    = 12              // Lines one response may send before it's cut short
+	sendQueueSize       = 100             // PRIVMSG lines that can wait for the flood limit
+)
+
+// unidentifiedPrefix starts the user ID of someone not logged in to a
+// services account. It can't appear in a nick or account name, so such IDs
+// never collide with an account.
+const unidentifiedPrefix = "~"
+
+// Config says where to connect and which gif list IRC uses
+type Config struct {
+	Server     string   // host:port, empty turns IRC off
+	TLS        bool     // Connect with TLS
+	Password   string   // Server password sent with PASS, if any
+	Nick       string   // Nick to register, suffixed with _ while taken
+	Channels   []string // Channels to join after registering
+	Guild      string   // Gif list, settings and permissions IRC uses, never a Discord guild's
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Messages are sent in bursts of up to SendBurst lines, then one line
+	// every SendInterval, so servers don't disconnect the bot for flooding
+	SendBurst    int
+	SendInterval time.Duration
+}
+
+// ConfigFromEnv reads IRC_SERVER, IRC_TLS, IRC_PASSWORD, IRC_NICK,
+// IRC_CHANNELS (comma separated) and IRC_GUILD
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Server:       strings.TrimSpace(os.Getenv("IRC_SERVER")),
+		Password:     os.Getenv("IRC_PASSWORD"),
+		Nick:         strings.TrimSpace(os.Getenv("IRC_NICK")),
+		Guild:        strings.TrimSpace(os.Getenv("IRC_GUILD")),
+		MinBackoff:   defaultMinBackoff,
+		MaxBackoff:   defaultMaxBackoff,
+		SendBurst:    defaultSendBurst,
+		SendInterval: defaultSendInterval,
+	}
+	switch strings.ToLower(os.Getenv("IRC_TLS")) {
+	case "1", "true", "on", "yes":
+		cfg.TLS = true
+	}
+	for _, channel := range strings.Split(os.Getenv("IRC_CHANNELS"), ",") {
+		if channel = strings.TrimSpace(channel); channel != "" {
+			cfg.Channels = append(cfg.Channels, channel)
+		}
+	}
+	if cfg.Nick == "" {
+		cfg.Nick = defaultNick
+	}
+	if cfg.Guild == "" {
+		cfg.Guild = defaultGuild
+	}
+	return cfg
+}
+
+// Enabled reports whether an IRC server is configured
+func (c Config) Enabled() bool {
+	return c.Server != ""
+}
+
+// Validate rejects a guild that looks like a Discord guild ID. Sharing a
+// Discord guild's settings would send its review posts and notices to
+// Discord channel IDs over IRC.
+func (c Config) Validate() error {
+	if c.Guild == "" {
+		return fmt.Errorf("IRC_GUILD can't be empty")
+	}
+	if strings.Trim(c.Guild, "0123456789") == "" {
+		return fmt.Errorf("IRC_GUILD %q looks like a Discord guild ID, IRC needs a list of its own", c.Guild)
+	}
+	return nil
+}
+
+// Handler runs the bot on an incoming message
+type Handler func(conn chat.Conn, msg chat.Message)
+
+// Client is a connection to one IRC network. It implements chat.Conn for
+// whichever connection is currently up.
+type Client struct {
+	config Config
+	handle Handler
+
+	mutex  sync.Mutex
+	conn   net.Conn // Current connection, nil while reconnecting
+	nick   string   // Nick the server accepted
+	nextID int
+
+	queue chan string // PRIVMSG lines waiting for the flood limit
+}
+
+// New creates a Client that passes messages to handle once Run is called
+func New(config Config, handle Handler) *Client {
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = defaultMinBackoff
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = config.MinBackoff
+	}
+	if config.SendBurst <= 0 {
+		config.SendBurst = defaultSendBurst
+	}
+	if config.SendInterval <= 0 {
+		config.SendInterval = defaultSendInterval
+	}
+	return &Client{config: config, handle: handle, nick: config.Nick, queue: make(chan string, sendQueueSize)}
+}
+
+// Run connects and keeps reconnecting until ctx is cancelled. The wait
+// between attempts doubles up to MaxBackoff and starts over after a
+// connection that got as far as registering.
+func (c *Client) Run(ctx context.Context) {
+	backoff := c.config.MinBackoff
+	for {
+		registered, err := c.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if registered {
+			backoff = c.config.MinBackoff
+		}
+		log.Printf("IRC connection to %s lost: %v, reconnecting in %s", c.config.Server, err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, c.config.MaxBackoff)
+	}
+}
+
+// session runs one connection until it fails, reporting whether the server
+// accepted the registration
+func (c *Client) session(ctx context.Context) (bool, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	// Unblock the reader when the bot shuts down
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c.mutex.Lock()
+	c.conn = conn
+	c.nick = c.config.Nick
+	c.mutex.Unlock()
+	defer func() {
+		c.mutex.Lock()
+		c.conn = nil
+		c.mutex.Unlock()
+		c.dropQueue()
+	}()
+
+	sending, stopSending := context.WithCancel(ctx)
+	defer stopSending()
+	go c.drainQueue(sending)
+
+	if c.config.Password != "" {
+		c.write("PASS " + c.config.Password)
+	}
+	// account-tag marks messages with the sender's services account, which
+	// unlike a nick can't be taken over. Servers without CAP ignore this.
+	c.write("CAP REQ :account-tag")
+	c.write("NICK " + c.config.Nick)
+	c.write("USER " + c.config.Nick + " 0 * :theListBot")
+
+	registered := false
+	accountTags := false // Whether the server agreed to send account tags
+	reader := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		raw, err := reader.ReadString('\n')
+		if err != nil {
+			return registered, err
+		}
+		line := parseLine(raw)
+
+		switch line.command {
+		case "PING":
+			c.write("PONG :" + line.param(0))
+		case "001":
+			registered = true
+			log.Printf("Connected to IRC server %s as %s", c.config.Server, line.param(0))
+			for _, channel := range c.config.Channels {
+				c.write("JOIN " + channel)
+			}
+		case "433":
+			// Nick in use, keep trying longer ones until one is free
+			c.mutex.Lock()
+			c.nick += "_"
+			nick := c.nick
+			c.mutex.Unlock()
+			c.write("NICK " + nick)
+		case "NICK":
+			c.mutex.Lock()
+			if line.nick() == c.nick {
+				c.nick = line.param(0)
+			}
+			c.mutex.Unlock()
+		case "CAP":
+			switch line.param(1) {
+			case "ACK":
+				accountTags = accountTags || slices.Contains(strings.Fields(line.param(2)), "account-tag")
+				c.write("CAP END")
+			case "NAK":
+				log.Printf("IRC server %s doesn't support account tags, only grants to everyone apply", c.config.Server)
+				c.write("CAP END")
+			}
+		case "ERROR":
+			return registered, fmt.Errorf("server closed the link: %s", line.param(0))
+		case "PRIVMSG":
+			c.privmsg(line, accountTags)
+		}
+	}
+}
+
+// dial opens a plain or TLS connection to the server
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	if c.config.TLS {
+		host, _, _ := net.SplitHostPort(c.config.Server)
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: host}}
+		return dialer.DialContext(ctx, "tcp", c.config.Server)
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", c.config.Server)
+}
+
+// privmsg hands a channel or private message to the handler. Replies to a
+// private message go back to the sender. The sender is known by services
+// account when the server sends trusted account tags, and by an
+// unidentified ID otherwise.
+func (c *Client) privmsg(line ircLine, accountTags bool) {
+	sender, target, text := line.nick(), line.param(0), line.param(1)
+	if sender == "" || text == "" || strings.HasPrefix(text, "\x01") {
+		// Ignore server notices and CTCP requests like VERSION or ACTION
+		return
+	}
+
+	c.mutex.Lock()
+	self := c.nick
+	c.nextID++
+	id := fmt.Sprintf("irc%d", c.nextID)
+	c.mutex.Unlock()
+
+	if strings.EqualFold(sender, self) {
+		return
+	}
+	channelID := target
+	if !isChannel(target) {
+		channelID = sender
+	}
+
+	userID := unidentifiedPrefix + sender
+	if account := line.tags["account"]; accountTags && account != "" && account != "*" {
+		userID = account
+	}
+
+	c.handle(c, chat.Message{
+		ID:        id,
+		ChannelID: channelID,
+		GuildID:   c.config.Guild,
+		Author:    chat.User{ID: userID, Name: sender},
+		Content:   text,
+	})
+}
+
+// drainQueue writes queued PRIVMSG lines until ctx is cancelled, at most
+// SendBurst at once and then one every SendInterval
+func (c *Client) drainQueue(ctx context.Context) {
+	refill := time.NewTicker(c.config.SendInterval)
+	defer refill.Stop()
+
+	tokens := c.config.SendBurst
+	for {
+		if tokens == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-refill.C:
+				tokens++
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-refill.C:
+			tokens = min(tokens+1, c.config.SendBurst)
+		case line := <-c.queue:
+			if err := c.write(line); err != nil {
+				log.Printf("Error sending to IRC: %v", err)
+			}
+			tokens--
+		}
+	}
+}
+
+// dropQueue forgets lines that were meant for a connection that is gone
+func (c *Client) dropQueue() {
+	for {
+		select {
+		case <-c.queue:
+		default:
+			return
+		}
+	}
+}
+
+// write sends one raw line, dropping it if no connection is up. Protocol
+// replies like PONG go straight out, messages go through the queue.
+func (c *Client) write(line string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.conn == nil {
+		return fmt.Errorf("not connected to IRC")
+	}
+	_, err := c.conn.Write([]byte(line + "\r\n"))
+	return err
+}
+
+// Send queues a response as one PRIVMSG per line. Embeds are flattened to
+// text and buttons are left out; uploads are replaced by a note. Responses
+// longer than maxResponseLines are cut short.
+func (c *Client) Send(channelID string, response chat.Response) (string, error) {
+	lines := render(response)
+	if len(lines) > maxResponseLines {
+		more := len(lines) - (maxResponseLines - 1)
+		lines = append(lines[:maxResponseLines-1], fmt.Sprintf("…truncated, %d more lines", more))
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.conn == nil {
+		return "", fmt.Errorf("not connected to IRC")
+	}
+	for _, text := range lines {
+		select {
+		case c.queue <- "PRIVMSG " + channelID + " :" + text:
+		default:
+			return "", fmt.Errorf("IRC send queue is full")
+		}
+	}
+
+	c.nextID++
+	return fmt.Sprintf("irc%d", c.nextID), nil
+}
+
+// Edit fails, IRC messages can't be changed once sent
+func (c *Client) Edit(channelID string, messageID string, response chat.Response) error {
+	return fmt.Errorf("IRC messages can't be edited")
+}
+
+// React does nothing, IRC has no reactions
+func (c *Client) React(channelID string, messageID string, emoji string) error {
+	return nil
+}
+
+// Member identifies IRC users by services account. Anyone can take a nick,
+// so users who aren't logged in get no user ID and only grants to everyone
+// apply to them. IRC has no roles or Discord permissions.
+func (c *Client) Member(message chat.Message) permissions.Member {
+	if strings.HasPrefix(message.Author.ID, unidentifiedPrefix) {
+		return permissions.Member{}
+	}
+	return permissions.Member{UserID: message.Author.ID}
+}
+
+// SupportsComponents reports false, IRC has no buttons
+func (c *Client) SupportsComponents() bool {
+	return false
+}
+
+// MaxMessages reports that a reply should fit in one message, anything
+// longer takes too long to trickle out under the flood limit
+func (c *Client) MaxMessages() int {
+	return 1
+}
+
+// mentionPattern matches Discord user, role and channel mentions
+var mentionPattern = regexp.MustCompile(`<(@[!&]?|#)([^>\s]+)>`)
+
+// render turns a response into IRC lines
+func render(response chat.Response) []string {
+	parts := []string{response.Text}
+	for _, embed := range response.Embeds {
+		if embed.Title != "" {
+			parts = append(parts, "\x02"+embed.Title+"\x02")
+		}
+		parts = append(parts, embed.Description)
+		for _, field := range embed.Fields {
+			parts = append(parts, field.Name+": "+field.Value)
+		}
+		parts = append(parts, embed.ImageURL, embed.Footer)
+	}
+	for _, file := range response.Files {
+		parts = append(parts, fmt.Sprintf("(%s can't be uploaded on IRC)", file.Name))
+	}
+
+	text := strings.ReplaceAll(strings.Join(parts, "\n"), "\r", "")
+	text = mentionPattern.ReplaceAllStringFunc(text, func(mention string) string {
+		match := mentionPattern.FindStringSubmatch(mention)
+		if match[1] == "#" {
+			return "#" + match[2]
+		}
+		return strings.TrimPrefix(match[2], unidentifiedPrefix)
+	})
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " ")
+		for len(line) > maxLineBytes {
+			cut := maxLineBytes
+			for cut > 0 && !isRuneStart(line[cut]) {
+				cut--
+			}
+			lines = append(lines, line[:cut])
+			line = line[cut:]
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// isRuneStart reports whether b starts a UTF-8 character
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// isChannel reports whether a PRIVMSG target is a channel rather than a nick
+func isChannel(target string) bool {
+	return strings.HasPrefix(target, "#") || strings.HasPrefix(target, "&")
+}
+
+// ircLine is one parsed protocol line
+type ircLine struct {
+	tags    map[string]string
+	prefix  string
+	command string
+	params  []string
+}
+
+// tagEscapes undoes the escaping of message tag values
+var tagEscapes = strings.NewReplacer(`\:`, ";", `\s`, " ", `\\`, `\`, `\r`, "\r", `\n`, "\n")
+
+// parseLine splits a raw line into tags, prefix, command and parameters
+func parseLine(raw string) ircLine {
+	raw = strings.TrimRight(raw, "\r\n")
+	var line ircLine
+
+	if strings.HasPrefix(raw, "@") {
+		var tags string
+		tags, raw, _ = strings.Cut(raw[1:], " ")
+		line.tags = make(map[string]string)
+		for _, tag := range strings.Split(tags, ";") {
+			key, value, _ := strings.Cut(tag, "=")
+			line.tags[key] = tagEscapes.Replace(value)
+		}
+	}
+	if strings.HasPrefix(raw, ":") {
+		line.prefix, raw, _ = strings.Cut(raw[1:], " ")
+	}
+	for raw != "" {
+		if strings.HasPrefix(raw, ":") {
+			line.params = append(line.params, raw[1:])
+			break
+		}
+		var param string
+		param, raw, _ = strings.Cut(raw, " ")
+		if param == "" {
+			continue
+		}
+		if line.command == "" {
+			line.command = strings.ToUpper(param)
+		} else {
+			line.params = append(line.params, param)
+		}
+	}
+	return line
+}
+
+// param returns the i-th parameter, or "" if there are fewer
+func (l ircLine) param(i int) string {
+	if i < len(l.params) {
+		return l.params[i]
+	}
+	return ""
+}
+
+// nick returns the nick part of the prefix
+func (l ircLine) nick() string {
+	nick, _, _ := strings.Cut(l.prefix, "!")
+	if strings.Contains(nick, ".") {
+		// Server names aren't nicks
+		return ""
+	}
+	return nick
+}
@@ -0,0 +1,289 @@
+package ircchat
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"theListBot/internal/chat"
+	"time"
+)
+
+// fakeServer is an in-process IRC server that hands each client
+// connection to the test
+type fakeServer struct {
+	t        *testing.T
+	listener net.Listener
+	conns    chan *fakeConn
+}
+
+// fakeConn is one client connection to a fakeServer
+type fakeConn struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := &fakeServer{t: t, listener: listener, conns: make(chan *fakeConn, 4)}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.conns <- &fakeConn{t: t, conn: conn, reader: bufio.NewReader(conn)}
+		}
+	}()
+	return s
+}
+
+// accept waits for the client to connect
+func (s *fakeServer) accept() *fakeConn {
+	s.t.Helper()
+	select {
+	case c := <-s.conns:
+		c.t.Cleanup(func() { c.conn.Close() })
+		return c
+	case <-time.After(5 * time.Second):
+		s.t.Fatal("Client never connected")
+		return nil
+	}
+}
+
+// expect reads lines until one starts with prefix, failing after a timeout
+func (c *fakeConn) expect(prefix string) string {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("Expected a line starting with %q, got error %v", prefix, err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+}
+
+// send writes a raw line to the client
+func (c *fakeConn) send(format string, args ...any) {
+	c.t.Helper()
+	if _, err := fmt.Fprintf(c.conn, format+"\r\n", args...); err != nil {
+		c.t.Fatalf("Failed to write to client: %v", err)
+	}
+}
+
+// register completes the client's registration
+func (c *fakeConn) register() {
+	c.t.Helper()
+	c.expect("NICK bot")
+	c.expect("USER bot")
+	c.send(":irc.test 001 bot :Welcome")
+	c.expect("JOIN #gifs")
+}
+
+func startClient(t *testing.T, server *fakeServer, handle Handler) {
+	t.Helper()
+	startClientWith(t, server, Config{}, handle)
+}
+
+// startClientWith starts a client for the fake server with the send limits
+// of config
+func startClientWith(t *testing.T, server *fakeServer, config Config, handle Handler) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	client := New(Config{
+		Server:       server.listener.Addr().String(),
+		Nick:         "bot",
+		Channels:     []string{"#gifs"},
+		Guild:        "irc",
+		MinBackoff:   10 * time.Millisecond,
+		MaxBackoff:   20 * time.Millisecond,
+		SendBurst:    config.SendBurst,
+		SendInterval: config.SendInterval,
+	}, handle)
+	go client.Run(ctx)
+}
+
+func TestClientRelaysMessages(t *testing.T) {
+	server := newFakeServer(t)
+	messages := make(chan chat.Message, 4)
+	startClient(t, server, func(conn chat.Conn, msg chat.Message) {
+		messages <- msg
+		conn.Send(msg.ChannelID, chat.Response{
+			Text:   "hi <@" + msg.Author.ID + ">",
+			Embeds: []chat.Embed{{Title: "Codes", Description: "`wave`: 2\n`gg`: 1"}},
+		})
+	})
+
+	c := server.accept()
+	c.register()
+
+	c.send("PING :irc.test")
+	c.expect("PONG :irc.test")
+
+	c.send(":alice!a@host PRIVMSG #gifs :wave")
+	msg := <-messages
+	if msg.ChannelID != "#gifs" || msg.GuildID != "irc" || msg.Author.ID != "~alice" || msg.Content != "wave" {
+		t.Errorf("Unexpected message %+v", msg)
+	}
+	c.expect("PRIVMSG #gifs :hi alice")
+	c.expect("PRIVMSG #gifs :\x02Codes\x02")
+	c.expect("PRIVMSG #gifs :`wave`: 2")
+	c.expect("PRIVMSG #gifs :`gg`: 1")
+
+	// Private messages are answered privately
+	c.send(":alice!a@host PRIVMSG bot :!counts")
+	if msg := <-messages; msg.ChannelID != "alice" {
+		t.Errorf("Expected a private message to reply to the sender, got %+v", msg)
+	}
+	c.expect("PRIVMSG alice :hi alice")
+
+	// Server notices and CTCP are ignored
+	c.send(":irc.test PRIVMSG #gifs :maintenance soon")
+	c.send(":alice!a@host PRIVMSG #gifs :\x01ACTION waves\x01")
+	c.send(":bob!b@host PRIVMSG #gifs :gg")
+	if msg := <-messages; msg.Author.ID != "~bob" {
+		t.Errorf("Expected notices and CTCP to be skipped, got %+v", msg)
+	}
+}
+
+func TestClientIdentifiesByAccount(t *testing.T) {
+	server := newFakeServer(t)
+	messages := make(chan chat.Message, 4)
+	userIDs := make(chan string, 4)
+	startClient(t, server, func(conn chat.Conn, msg chat.Message) {
+		messages <- msg
+		userIDs <- conn.Member(msg).UserID
+	})
+
+	c := server.accept()
+	c.expect("CAP REQ :account-tag")
+	c.send(":irc.test CAP * ACK :account-tag")
+	c.expect("CAP END")
+	c.send(":irc.test 001 bot :Welcome")
+	c.expect("JOIN #gifs")
+
+	c.send("@account=alice;time=now :alice!a@host PRIVMSG #gifs :wave")
+	msg := <-messages
+	if msg.Author.ID != "alice" || msg.Author.Name != "alice" || <-userIDs != "alice" {
+		t.Errorf("Expected a logged in user to be known by account, got %+v", msg)
+	}
+
+	// Taking a logged in user's nick doesn't give their grants
+	c.send("@account=* :alice!a@host PRIVMSG #gifs :wave")
+	msg = <-messages
+	if msg.Author.ID != "~alice" || <-userIDs != "" {
+		t.Errorf("Expected a logged out user to have no user ID, got %+v", msg)
+	}
+}
+
+func TestAccountTagsNeedTheCapability(t *testing.T) {
+	server := newFakeServer(t)
+	messages := make(chan chat.Message, 4)
+	startClient(t, server, func(conn chat.Conn, msg chat.Message) {
+		messages <- msg
+	})
+
+	c := server.accept()
+	c.expect("CAP REQ :account-tag")
+	c.send(":irc.test CAP * NAK :account-tag")
+	c.expect("CAP END")
+	c.send(":irc.test 001 bot :Welcome")
+	c.expect("JOIN #gifs")
+
+	c.send("@account=alice :mallory!m@host PRIVMSG #gifs :wave")
+	if msg := <-messages; msg.Author.ID != "~mallory" {
+		t.Errorf("Expected account tags the server didn't agree to be ignored, got %+v", msg)
+	}
+}
+
+func TestClientLimitsFlooding(t *testing.T) {
+	server := newFakeServer(t)
+	startClientWith(t, server, Config{SendBurst: 2, SendInterval: 50 * time.Millisecond}, func(conn chat.Conn, msg chat.Message) {
+		var lines []string
+		for i := 0; i < 30; i++ {
+			lines = append(lines, fmt.Sprintf("line %d", i))
+		}
+		conn.Send(msg.ChannelID, chat.Text(strings.Join(lines, "\n")))
+	})
+
+	c := server.accept()
+	c.register()
+
+	c.send(":alice!a@host PRIVMSG #gifs :!list show")
+	start := time.Now()
+	for i := 0; i < maxResponseLines-1; i++ {
+		c.expect(fmt.Sprintf("PRIVMSG #gifs :line %d", i))
+	}
+	c.expect(fmt.Sprintf("PRIVMSG #gifs :…truncated, %d more lines", 30-(maxResponseLines-1)))
+
+	// Everything after the burst waits for a refill. The ticker starts with
+	// the connection, so the first refill may come at any point before the
+	// message and only the ones after it are certain.
+	if elapsed, least := time.Since(start), time.Duration(maxResponseLines-3)*50*time.Millisecond; elapsed < least {
+		t.Errorf("Expected %d lines to take at least %s, took %s", maxResponseLines, least, elapsed)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for guild, valid := range map[string]bool{"irc": true, "libera-gifs": true, "": false, "123456789012345678": false} {
+		if err := (Config{Server: "irc.test", Guild: guild}).Validate(); (err == nil) != valid {
+			t.Errorf("Guild %q: expected valid %v, got %v", guild, valid, err)
+		}
+	}
+}
+
+func TestClientReconnects(t *testing.T) {
+	server := newFakeServer(t)
+	startClient(t, server, func(conn chat.Conn, msg chat.Message) {})
+
+	first := server.accept()
+	first.register()
+	first.send("ERROR :Closing link")
+	first.conn.Close()
+
+	second := server.accept()
+	second.expect("NICK bot")
+	second.send(":irc.test 433 * bot :Nickname is already in use")
+	second.expect("NICK bot_")
+	second.send(":irc.test 001 bot_ :Welcome")
+	second.expect("JOIN #gifs")
+}
+
+func TestRenderSplitsLongLines(t *testing.T) {
+	long := strings.Repeat("é", maxLineBytes)
+	lines := render(chat.Response{Text: "see <#123> and <@&456>\n\n" + long})
+	if len(lines) != 3 || lines[0] != "see #123 and 456" {
+		t.Fatalf("Unexpected lines %q", lines)
+	}
+	if len(lines[1]) > maxLineBytes || lines[1]+lines[2] != long {
+		t.Errorf("Expected the long line to be split on a character boundary, got %d and %d bytes", len(lines[1]), len(lines[2]))
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	line := parseLine("@time=now;account=a\\sb\\:c;+draft :nick!user@host privmsg #chan :hello there\r\n")
+	if line.tags["time"] != "now" || line.tags["account"] != "a b;c" {
+		t.Errorf("Unexpected tags %v", line.tags)
+	}
+	if line.prefix != "nick!user@host" || line.command != "PRIVMSG" || line.param(0) != "#chan" || line.param(1) != "hello there" {
+		t.Errorf("Unexpected parse %+v", line)
+	}
+	if line.nick() != "nick" || line.param(2) != "" {
+		t.Errorf("Unexpected nick %q", line.nick())
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"log"
 	"os"
+	"path/filepath"
 	"sync"
+	"theListBot/internal/safefile"
 	"time"
 )
 
@@ -109,42 +111,42 @@ func (c *ComboTracker) ResetDailyCounts() {
 	c.dailyCounts = make(map[string]int)
 }
 
-// loadLifetimeCounts loads the lifetime counts from the JSON file.
+// loadLifetimeCounts loads the lifetime counts from the JSON file, falling
+// back to the newest valid backup if the file is damaged.
 func (c *ComboTracker) loadLifetimeCounts() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	file, err := os.Open(c.filePath)
-	if err != nil {
-		log.Printf("Error opening lifetime counts file: %v", err)
-		return
-	}
-	defer file.Close()
-
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&c.lifetimeCounts)
+	err := safefile.ReadFile(c.filePath, func(data []byte) error {
+		counts := make(map[string]int)
+		if err := json.Unmarshal(data, &counts); err != nil {
+			return err
+		}
+		c.lifetimeCounts = counts
+		return nil
+	})
 	if err != nil {
-		log.Printf("Error decoding lifetime counts: %v", err)
+		log.Printf("Error loading lifetime counts: %v", err)
 		return
 	}
 
 	log.Println("Successfully loaded lifetime counts from file")
 }
 
-// saveLifetimeCounts saves the lifetime counts to the JSON file.
+// saveLifetimeCounts atomically saves the lifetime counts to the JSON file.
 func (c *ComboTracker) saveLifetimeCounts() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	file, err := os.Create(c.filePath)
+	data, err := json.Marshal(c.lifetimeCounts)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	if err := os.MkdirAll(filepath.Dir(c.filePath), 0755); err != nil {
+		return err
+	}
 
-	encoder := json.NewEncoder(file)
-	err = encoder.Encode(c.lifetimeCounts)
-	if err != nil {
+	if err := safefile.WriteFile(c.filePath, data, 0644, safefile.BackupCount()); err != nil {
 		return err
 	}
 
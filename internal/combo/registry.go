@@ -0,0 +1,94 @@
+package combo
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fileName is the lifetime counts file kept in each guild's directory
+const fileName = "lifetime_counts.json"
+
+// Registry keeps separate counts and combos for every guild, so one guild's
+// codes never show up in another's counts or carry a combo into it
+type Registry struct {
+	mutex           sync.Mutex
+	consecutiveTime time.Duration
+	dirFor          func(guildID string) string // Directory holding a guild's files
+	trackers        map[string]*ComboTracker    // Keyed by directory
+}
+
+// NewRegistry creates a Registry that keeps each guild's lifetime counts in
+// the directory returned by dirFor
+func NewRegistry(consecutiveTime time.Duration, dirFor func(guildID string) string) *Registry {
+	return &Registry{
+		consecutiveTime: consecutiveTime,
+		dirFor:          dirFor,
+		trackers:        make(map[string]*ComboTracker),
+	}
+}
+
+// ForGuild returns the tracker of a guild, loading its lifetime counts on
+// first use
+func (r *Registry) ForGuild(guildID string) *ComboTracker {
+	dir := r.dirFor(guildID)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if tracker, ok := r.trackers[dir]; ok {
+		return tracker
+	}
+	tracker := NewComboTracker(r.consecutiveTime, filepath.Join(dir, fileName))
+	r.trackers[dir] = tracker
+	return tracker
+}
+
+// ResetDailyCounts resets the daily counts of every guild
+func (r *Registry) ResetDailyCounts() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, tracker := range r.trackers {
+		tracker.ResetDailyCounts()
+	}
+}
+
+// Stop saves the lifetime counts of every guild
+func (r *Registry) Stop() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, tracker := range r.trackers {
+		tracker.Stop()
+	}
+}
+
+// MigrateLegacyFile moves the lifetime counts kept in path, from before each
+// guild had its own, into guildID's directory. A guild that already has
+// counts keeps them and the file is left alone.
+func (r *Registry) MigrateLegacyFile(path string, guildID string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	dir := r.dirFor(guildID)
+	target := filepath.Join(dir, fileName)
+	if _, err := os.Stat(target); err == nil {
+		log.Printf("Guild %s already has lifetime counts, not migrating %s", guildID, path)
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create guild directory: %v", err)
+	}
+	if err := os.Rename(path, target); err != nil {
+		return fmt.Errorf("failed to move legacy lifetime counts: %v", err)
+	}
+
+	log.Printf("Migrated legacy lifetime counts %s to guild %s", path, guildID)
+	return nil
+}
@@ -0,0 +1,38 @@
+package combo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMigrateLegacyFile(t *testing.T) {
+	dir := t.TempDir()
+	dirFor := func(guildID string) string { return filepath.Join(dir, "guilds", guildID) }
+	legacy := filepath.Join(dir, "lifetime_counts.json")
+	if err := os.WriteFile(legacy, []byte(`{"wave": 3}`), 0644); err != nil {
+		t.Fatalf("Failed to write legacy counts: %v", err)
+	}
+
+	combos := NewRegistry(time.Minute, dirFor)
+	if err := combos.MigrateLegacyFile(legacy, "g1"); err != nil {
+		t.Fatalf("MigrateLegacyFile failed: %v", err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("Expected the legacy file to be moved, got %v", err)
+	}
+	if counts := combos.ForGuild("g1").GetLifetimeCounts(); counts["wave"] != 3 {
+		t.Errorf("Expected the default guild to inherit the counts, got %v", counts)
+	}
+	if counts := combos.ForGuild("g2").GetLifetimeCounts(); len(counts) != 0 {
+		t.Errorf("Expected other guilds to start empty, got %v", counts)
+	}
+
+	// Counts are saved beside each guild's other files
+	combos.ForGuild("g2").RecordCode("u1", "gg")
+	combos.Stop()
+	if _, err := os.Stat(filepath.Join(dir, "guilds", "g2", fileName)); err != nil {
+		t.Errorf("Expected g2's counts to be saved in its directory: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+// Package cooldown rate limits code responses so one person can't flood a
+// channel with GIFs
+package cooldown
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// pruneAt is how many remembered cooldowns trigger dropping the ended ones
+const pruneAt = 1000
+
+// Config holds a guild's limits. A zero duration or burst turns that limit off.
+type Config struct {
+	User        time.Duration `json:"user,omitempty"`         // Between responses to the same user
+	Channel     time.Duration `json:"channel,omitempty"`      // Between responses in the same channel
+	Code        time.Duration `json:"code,omitempty"`         // Between responses to the same code
+	Burst       int           `json:"burst,omitempty"`        // Responses allowed in the whole guild per BurstWindow
+	BurstWindow time.Duration `json:"burst_window,omitempty"` // Window the burst limit counts over
+	React       string        `json:"react,omitempty"`        // Emoji to react with when limited, empty ignores silently
+	NoCount     bool          `json:"no_count,omitempty"`     // Limited uses don't count towards code counts
+}
+
+// Enabled reports whether any limit is set
+func (c Config) Enabled() bool {
+	return c.User > 0 || c.Channel > 0 || c.Code > 0 || (c.Burst > 0 && c.BurstWindow > 0)
+}
+
+// Use is one attempt to trigger a code
+type Use struct {
+	GuildID   string
+	UserID    string
+	ChannelID string
+	Code      string
+}
+
+// Limiter remembers recent responses of every guild
+type Limiter struct {
+	mutex  sync.Mutex
+	until  map[string]time.Time   // When the cooldown of a guild's user, channel or code ends
+	bursts map[string][]time.Time // Recent responses per guild, oldest first
+	now    func() time.Time
+}
+
+// New creates an empty Limiter
+func New() *Limiter {
+	return &Limiter{
+		until:  make(map[string]time.Time),
+		bursts: make(map[string][]time.Time),
+		now:    time.Now,
+	}
+}
+
+// Allow reports whether a use may get a response under cfg and records it if
+// so. When it may not, the reason says which limit was hit. Limited uses
+// aren't recorded, so spamming doesn't extend a cooldown.
+func (l *Limiter) Allow(cfg Config, use Use) (bool, string) {
+	if !cfg.Enabled() {
+		return true, ""
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	keys := []struct {
+		key    string
+		window time.Duration
+		name   string
+	}{
+		{use.GuildID + "/user/" + use.UserID, cfg.User, "user"},
+		{use.GuildID + "/channel/" + use.ChannelID, cfg.Channel, "channel"},
+		{use.GuildID + "/code/" + use.Code, cfg.Code, "code"},
+	}
+	for _, k := range keys {
+		if k.window <= 0 {
+			continue
+		}
+		if until, ok := l.until[k.key]; ok && now.Before(until) {
+			return false, fmt.Sprintf("%s cooldown, %s left", k.name, until.Sub(now).Round(time.Second))
+		}
+	}
+
+	burst := l.bursts[use.GuildID]
+	if cfg.Burst > 0 && cfg.BurstWindow > 0 {
+		for len(burst) > 0 && now.Sub(burst[0]) >= cfg.BurstWindow {
+			burst = burst[1:]
+		}
+		if len(burst) >= cfg.Burst {
+			l.bursts[use.GuildID] = burst
+			return false, fmt.Sprintf("burst limit of %d per %s", cfg.Burst, cfg.BurstWindow)
+		}
+		l.bursts[use.GuildID] = append(burst, now)
+	}
+
+	for _, k := range keys {
+		if k.window > 0 {
+			l.until[k.key] = now.Add(k.window)
+		}
+	}
+	if len(l.until) > pruneAt {
+		l.pruneLocked(now)
+	}
+	return true, ""
+}
+
+// pruneLocked forgets cooldowns that have ended. Callers must hold the lock.
+func (l *Limiter) pruneLocked(now time.Time) {
+	for key, until := range l.until {
+		if !now.Before(until) {
+			delete(l.until, key)
+		}
+	}
+}
+
+// ParseDuration accepts a Go duration like 30s or 2m, or a plain number of
+// seconds. Zero or "off" turns a limit off.
+func ParseDuration(value string) (time.Duration, error) {
+	if value == "off" {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q, use seconds or something like 30s or 2m", value)
+	}
+	return d, nil
+}
@@ -0,0 +1,68 @@
+package cooldown
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimits(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := New()
+	l.now = func() time.Time { return now }
+
+	cfg := Config{User: 10 * time.Second, Code: 30 * time.Second}
+	use := Use{GuildID: "g1", UserID: "u1", ChannelID: "c1", Code: "gg"}
+
+	if ok, _ := l.Allow(cfg, use); !ok {
+		t.Fatal("The first use should be allowed")
+	}
+	if ok, reason := l.Allow(cfg, use); ok || reason == "" {
+		t.Fatalf("A repeat should be limited with a reason, got %v %q", ok, reason)
+	}
+
+	// Another user is free of u1's cooldown but not of the code's
+	if ok, _ := l.Allow(cfg, Use{GuildID: "g1", UserID: "u2", Code: "gg"}); ok {
+		t.Error("The code cooldown should apply to everyone")
+	}
+	if ok, _ := l.Allow(cfg, Use{GuildID: "g1", UserID: "u2", Code: "ty"}); !ok {
+		t.Error("Another user and code should be allowed")
+	}
+	if ok, _ := l.Allow(cfg, Use{GuildID: "g2", UserID: "u1", Code: "gg"}); !ok {
+		t.Error("Cooldowns should not leak between guilds")
+	}
+
+	// Limited attempts don't extend the cooldown
+	now = now.Add(31 * time.Second)
+	if ok, _ := l.Allow(cfg, use); !ok {
+		t.Error("The cooldown should have ended")
+	}
+}
+
+func TestBurst(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := New()
+	l.now = func() time.Time { return now }
+
+	cfg := Config{Burst: 2, BurstWindow: 10 * time.Second}
+	for i, want := range []bool{true, true, false} {
+		if ok, _ := l.Allow(cfg, Use{GuildID: "g1", UserID: "u1", Code: "gg"}); ok != want {
+			t.Errorf("Use %d: got %v, want %v", i+1, ok, want)
+		}
+	}
+
+	now = now.Add(10 * time.Second)
+	if ok, _ := l.Allow(cfg, Use{GuildID: "g1", UserID: "u1", Code: "gg"}); !ok {
+		t.Error("The burst window should have moved on")
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for value, want := range map[string]time.Duration{"5": 5 * time.Second, "2m": 2 * time.Minute, "off": 0, "0": 0} {
+		if got, err := ParseDuration(value); err != nil || got != want {
+			t.Errorf("ParseDuration(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	if _, err := ParseDuration("-3"); err == nil {
+		t.Error("Negative durations should be rejected")
+	}
+}
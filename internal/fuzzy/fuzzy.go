@@ -0,0 +1,141 @@
+// Package fuzzy finds the closest matches to a mistyped word
+package fuzzy
+
+import (
+	"sort"
+	"strings"
+)
+
+// Edit costs, in thirds of an edit so that hitting a neighbouring key can
+// cost a little less than a full edit without two such slips adding up to
+// less than one
+const (
+	editCost     = 3
+	adjacentCost = 2
+)
+
+// keyboardRows is a QWERTY layout, each row shifted half a key right of the
+// one above it
+var keyboardRows = []string{
+	"1234567890",
+	"qwertyuiop",
+	"asdfghjkl",
+	"zxcvbnm",
+}
+
+// keyPositions maps each key to its row and column
+var keyPositions = func() map[rune][2]int {
+	positions := make(map[rune][2]int)
+	for row, keys := range keyboardRows {
+		for col, key := range keys {
+			positions[key] = [2]int{row, col}
+		}
+	}
+	return positions
+}()
+
+// adjacent reports whether two keys touch on a QWERTY keyboard
+func adjacent(a rune, b rune) bool {
+	pa, okA := keyPositions[a]
+	pb, okB := keyPositions[b]
+	if !okA || !okB {
+		return false
+	}
+
+	switch pb[0] - pa[0] {
+	case 0:
+		return pb[1]-pa[1] == 1 || pa[1]-pb[1] == 1
+	case 1:
+		// The row below is shifted right, so it touches this column and the one before
+		return pb[1] == pa[1] || pb[1] == pa[1]-1
+	case -1:
+		return pb[1] == pa[1] || pb[1] == pa[1]+1
+	}
+	return false
+}
+
+// Distance is the edit distance between a and b, counting insertions,
+// deletions, substitutions and swaps of neighbouring letters. Substituting
+// a key next to the intended one counts as two thirds of an edit. The result
+// is in thirds of an edit.
+func Distance(a string, b string) int {
+	ra, rb := []rune(strings.ToLower(a)), []rune(strings.ToLower(b))
+
+	// d[i][j] is the distance between the first i runes of a and the first j of b
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i * editCost
+	}
+	for j := range d[0] {
+		d[0][j] = j * editCost
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			substitution := 0
+			if ra[i-1] != rb[j-1] {
+				substitution = editCost
+				if adjacent(ra[i-1], rb[j-1]) {
+					substitution = adjacentCost
+				}
+			}
+
+			d[i][j] = min(
+				d[i-1][j]+editCost,
+				d[i][j-1]+editCost,
+				d[i-1][j-1]+substitution,
+			)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+editCost)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+// MaxDistance is how far a candidate may be from a word of the given
+// length and still be suggested: one edit for short words, more for longer
+// ones
+func MaxDistance(length int) int {
+	edits := 1 + length/5
+	return edits * editCost
+}
+
+// Closest returns up to limit candidates within MaxDistance of word,
+// closest first. Exact matches are not suggested.
+func Closest(word string, candidates []string, limit int) []string {
+	type match struct {
+		candidate string
+		distance  int
+	}
+
+	word = strings.ToLower(word)
+	maxDistance := MaxDistance(len([]rune(word)))
+
+	var matches []match
+	for _, candidate := range candidates {
+		if strings.ToLower(candidate) == word {
+			continue
+		}
+		if distance := Distance(word, candidate); distance <= maxDistance {
+			matches = append(matches, match{candidate, distance})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].candidate < matches[j].candidate
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	closest := make([]string, len(matches))
+	for i, m := range matches {
+		closest[i] = m.candidate
+	}
+	return closest
+}
@@ -0,0 +1,48 @@
+package fuzzy
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		distance int
+	}{
+		{"gg", "gg", 0},
+		{"gg", "GG", 0},
+		{"gg", "gh", adjacentCost},   // h is next to g
+		{"gg", "gp", editCost},       // p is across the keyboard
+		{"ty", "yt", editCost},       // swapped letters are one edit
+		{"gg", "ggg", editCost},      // insertion
+		{"wave", "wav", editCost},    // deletion
+		{"lol", "kol", adjacentCost}, // k is next to l
+		{"abc", "xyz", 3 * editCost},
+	}
+	for _, test := range tests {
+		if got := Distance(test.a, test.b); got != test.distance {
+			t.Errorf("Distance(%q, %q) = %d, want %d", test.a, test.b, got, test.distance)
+		}
+	}
+}
+
+func TestClosest(t *testing.T) {
+	codes := []string{"gg", "gn", "ty", "wave", "hello", "lol"}
+
+	if got := Closest("gh", codes, 3); !slices.Equal(got, []string{"gg", "gn"}) {
+		t.Errorf("Expected gg before gn for gh, got %v", got)
+	}
+	if got := Closest("yt", codes, 3); !slices.Equal(got, []string{"ty"}) {
+		t.Errorf("Expected ty for yt, got %v", got)
+	}
+	if got := Closest("gg", codes, 3); slices.Contains(got, "gg") {
+		t.Errorf("Exact matches should not be suggested, got %v", got)
+	}
+	if got := Closest("banana", codes, 3); len(got) != 0 {
+		t.Errorf("Expected no suggestions for an unrelated word, got %v", got)
+	}
+	if got := Closest("g", codes, 1); len(got) != 1 {
+		t.Errorf("Expected the limit to be applied, got %v", got)
+	}
+}
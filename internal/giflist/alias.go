@@ -0,0 +1,118 @@
+package giflist
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// maxAliasDepth bounds alias chains so a damaged file can never loop forever
+const maxAliasDepth = 16
+
+// Resolve follows aliases and returns the code that owns the GIF pool.
+// Codes that aren't aliases, including unknown ones, resolve to themselves.
+func (g *GifList) Resolve(code string) string {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	name, _, _ := g.resolveLocked(code)
+	return name
+}
+
+// resolveLocked follows aliases from code to the canonical code. It reports
+// false if the chain is broken or loops. Callers must hold the lock.
+func (g *GifList) resolveLocked(code string) (string, *Code, bool) {
+	return resolveIn(g.codeMap, code)
+}
+
+// resolveIn follows aliases from code to the canonical code in codeMap
+func resolveIn(codeMap map[string]*Code, code string) (string, *Code, bool) {
+	name := code
+	for depth := 0; depth < maxAliasDepth; depth++ {
+		c, found := codeMap[name]
+		if !found {
+			return name, nil, false
+		}
+		if c.AliasOf == "" {
+			return name, c, true
+		}
+		name = c.AliasOf
+	}
+
+	log.Printf("Alias chain from %s is too deep or loops", code)
+	return code, nil, false
+}
+
+// SetAlias makes alias resolve to target's GIF pool
+func (g *GifList) SetAlias(alias string, target string, by string) error {
+	if err := g.validateCode(alias); err != nil {
+		return err
+	}
+	if alias == target {
+		return fmt.Errorf("a code can't be an alias of itself")
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.syncLocked()
+
+	canonical, _, ok := g.resolveLocked(target)
+	if !ok {
+		return fmt.Errorf("code not found: %s", target)
+	}
+
+	// Walk the chain from target, it must not pass back through alias
+	for name := target; name != canonical; name = g.codeMap[name].AliasOf {
+		if name == alias {
+			return fmt.Errorf("`%s` already leads to `%s`, that would create a loop", target, alias)
+		}
+	}
+	if canonical == alias {
+		return fmt.Errorf("`%s` already leads to `%s`, that would create a loop", target, alias)
+	}
+
+	if existing, found := g.codeMap[alias]; found && len(existing.Gifs) > 0 {
+		return fmt.Errorf("`%s` already has %d GIFs, remove them before making it an alias", alias, len(existing.Gifs))
+	}
+
+	before := g.snapshotLocked(alias)
+	g.codeMap[alias] = &Code{AliasOf: target}
+	g.resetSelection(alias)
+	log.Printf("Set alias %s -> %s (canonical %s)", alias, target, canonical)
+	g.commitChange(alias, ActionAlias, by, target, before)
+	return nil
+}
+
+// AliasesOf returns the aliases that point directly at code, sorted
+func (g *GifList) AliasesOf(code string) []string {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return g.aliasesOfLocked(code)
+}
+
+// aliasesOfLocked returns the aliases pointing directly at code.
+// Callers must hold the lock.
+func (g *GifList) aliasesOfLocked(code string) []string {
+	var aliases []string
+	for name, c := range g.codeMap {
+		if c.AliasOf == code {
+			aliases = append(aliases, name)
+		}
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// removeAliasesOf deletes every alias that leads to code, directly or through
+// other aliases, so no alias is left dangling. Callers must hold the write lock.
+func (g *GifList) removeAliasesOf(code string, by string) {
+	for _, alias := range g.aliasesOfLocked(code) {
+		before := g.snapshotLocked(alias)
+		delete(g.codeMap, alias)
+		g.resetSelection(alias)
+		log.Printf("Removed alias %s of deleted code %s", alias, code)
+		g.commitChange(alias, ActionRemoveAlias, by, code, before)
+		g.removeAliasesOf(alias, by)
+	}
+}
@@ -0,0 +1,122 @@
+package giflist
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// SelectionMode controls how GetGif picks among a code's GIFs
+type SelectionMode string
+
+// Supported selection modes
+const (
+	// ModeRandom picks independently every time, weighted by each GIF's weight
+	ModeRandom SelectionMode = "random"
+	// ModeShuffle deals every GIF once in random order before repeating any,
+	// ignoring weights
+	ModeShuffle SelectionMode = "shuffle"
+	// ModeRoundRobin cycles through the GIFs in the order they were added,
+	// ignoring weights
+	ModeRoundRobin SelectionMode = "roundrobin"
+)
+
+// SelectionModes lists every supported mode, for help text
+var SelectionModes = []SelectionMode{ModeRandom, ModeShuffle, ModeRoundRobin}
+
+// ParseSelectionMode converts user input into a SelectionMode
+func ParseSelectionMode(value string) (SelectionMode, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "random":
+		return ModeRandom, nil
+	case "shuffle", "shufflebag", "shuffle-bag", "bag":
+		return ModeShuffle, nil
+	case "roundrobin", "round-robin", "rr", "cycle":
+		return ModeRoundRobin, nil
+	}
+	return "", fmt.Errorf("unknown mode %q, use one of: random, shuffle, roundrobin", value)
+}
+
+// Code is everything stored under a single code
+type Code struct {
+	Gifs    []Gif         `json:"gifs"`
+	Mode    SelectionMode `json:"mode,omitempty"`     // Empty means ModeRandom
+	AliasOf string        `json:"alias_of,omitempty"` // Code whose GIF pool this code uses
+}
+
+// EffectiveMode returns the selection mode in use for the code
+func (c *Code) EffectiveMode() SelectionMode {
+	if c.Mode == "" {
+		return ModeRandom
+	}
+	return c.Mode
+}
+
+// copyCode returns a deep copy of a code
+func copyCode(c *Code) *Code {
+	return &Code{
+		Gifs:    copyGifs(c.Gifs),
+		Mode:    c.Mode,
+		AliasOf: c.AliasOf,
+	}
+}
+
+// copyCodeMap returns a deep copy of a code mapping
+func copyCodeMap(codeMap map[string]*Code) map[string]*Code {
+	copied := make(map[string]*Code, len(codeMap))
+	for name, c := range codeMap {
+		copied[name] = copyCode(c)
+	}
+	return copied
+}
+
+// decodeCodeMap parses a gif list file, migrating the older formats: a bare
+// list of GIFs per code, a list of URLs per code, and before that a single
+// URL per code
+func decodeCodeMap(data []byte) (map[string]*Code, error) {
+	codeMap := make(map[string]*Code)
+	err := json.Unmarshal(data, &codeMap)
+	if err == nil {
+		return codeMap, nil
+	}
+
+	// Try the GIF list format without code settings
+	var gifMap map[string][]Gif
+	if gifErr := json.Unmarshal(data, &gifMap); gifErr == nil {
+		log.Println("Detected GIF list format, converting to code format")
+		codeMap = make(map[string]*Code, len(gifMap))
+		for name, gifs := range gifMap {
+			codeMap[name] = &Code{Gifs: gifs}
+		}
+		return codeMap, nil
+	}
+
+	// Try the multi-URL format without metadata
+	var urlMap map[string][]string
+	if urlErr := json.Unmarshal(data, &urlMap); urlErr == nil {
+		log.Println("Detected URL list format, converting to code format")
+		codeMap = make(map[string]*Code, len(urlMap))
+		for name, urls := range urlMap {
+			c := &Code{}
+			for _, url := range urls {
+				c.Gifs = append(c.Gifs, Gif{URL: url})
+			}
+			codeMap[name] = c
+		}
+		return codeMap, nil
+	}
+
+	// Try to load legacy format (single URL per code)
+	var legacyMap map[string]string
+	if legacyErr := json.Unmarshal(data, &legacyMap); legacyErr == nil {
+		log.Println("Detected legacy format, converting to code format")
+		codeMap = make(map[string]*Code, len(legacyMap))
+		for name, url := range legacyMap {
+			codeMap[name] = &Code{Gifs: []Gif{{URL: url}}}
+		}
+		return codeMap, nil
+	}
+
+	return nil, fmt.Errorf("failed to parse config file: %v", err)
+}
@@ -0,0 +1,85 @@
+package giflist
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Gif is a single GIF stored under a code along with its metadata
+type Gif struct {
+	URL        string    `json:"url"`
+	AddedBy    string    `json:"added_by,omitempty"` // User ID of whoever added it
+	AddedAt    time.Time `json:"added_at"`
+	Tags       []string  `json:"tags,omitempty"`
+	PickCount  int       `json:"pick_count"`
+	LastPicked time.Time `json:"last_picked"`
+	Weight     int       `json:"weight,omitempty"` // Relative pick weight, 0 means DefaultWeight
+
+	// Results of the background link checker
+	CheckedAt   time.Time `json:"checked_at"`
+	CheckStatus int       `json:"check_status,omitempty"` // HTTP status of the last probe, 0 if there was no response
+	CheckError  string    `json:"check_error,omitempty"`  // Why the last probe failed
+	Failures    int       `json:"failures,omitempty"`     // Consecutive failed probes
+
+	Mirror string `json:"mirror,omitempty"` // Hash of the local copy, empty if not mirrored
+}
+
+// Bounds and default for per-GIF selection weights
+const (
+	DefaultWeight = 1
+	MaxWeight     = 100
+)
+
+// DeadAfterFailures is how many probes in a row must fail before a GIF is
+// treated as dead and left out of selection
+const DeadAfterFailures = 3
+
+// Dead reports whether the link checker has given up on the GIF
+func (gif Gif) Dead() bool {
+	return gif.Failures >= DeadAfterFailures
+}
+
+// EffectiveWeight returns the weight used for selection
+func (gif Gif) EffectiveWeight() int {
+	if gif.Weight <= 0 {
+		return DefaultWeight
+	}
+	return gif.Weight
+}
+
+// gifURLs returns just the URLs of a list of GIFs
+func gifURLs(gifs []Gif) []string {
+	urls := make([]string, len(gifs))
+	for i, gif := range gifs {
+		urls[i] = gif.URL
+	}
+	return urls
+}
+
+// copyGifs returns a deep copy of a list of GIFs
+func copyGifs(gifs []Gif) []Gif {
+	copied := make([]Gif, len(gifs))
+	for i, gif := range gifs {
+		copied[i] = gif
+		copied[i].Tags = append([]string(nil), gif.Tags...)
+	}
+	return copied
+}
+
+// pickWeighted returns the index of a GIF chosen with probability
+// proportional to its weight
+func pickWeighted(gifs []Gif, rng *rand.Rand) int {
+	total := 0
+	for _, gif := range gifs {
+		total += gif.EffectiveWeight()
+	}
+
+	target := rng.Intn(total)
+	for i, gif := range gifs {
+		target -= gif.EffectiveWeight()
+		if target < 0 {
+			return i
+		}
+	}
+	return len(gifs) - 1
+}
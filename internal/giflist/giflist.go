@@ -1,66 +1,89 @@
 package giflist
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
+	"theListBot/internal/fuzzy"
+	"theListBot/internal/mirror"
 	"time"
 )
 
-// Initialize random seed on package init
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
-
 // GifList manages the mappings between 2-character codes and GIF URLs
 type GifList struct {
-	codeMap    map[string][]string // Changed from map[string]string to map[string][]string
+	codeMap    map[string]*Code // Changed from map[string][]string to carry metadata and settings
 	mutex      sync.RWMutex
-	configFile string
+	store      Store
+	dirtyCodes map[string]bool            // Codes with changes, usually pick stats, not yet persisted
+	stored     map[string]*Code           // Codes as the store last held them, to tell outside edits from the bot's
+	rng        *rand.Rand                 // Guarded by mutex, replace with Seed for repeatable picks
+	selection  map[string]*selectionState // Per code and channel selection state
+	history    []Change                   // Recorded mutations, oldest first
+	mirror     *mirror.Cache              // Local copies of added GIFs, nil when mirroring is off
+	mirrors    sync.WaitGroup             // Downloads still in progress
+	policy     Policy                     // Which codes can be added and triggered
 }
 
-// NewGifList creates a new GifList and loads mappings from a file if available
+// NewGifList creates a new GifList and loads mappings from storage if available
 func NewGifList() *GifList {
-	log.Println("Initializing GifList")
+	// Determine configuration directory
+	return newGifListIn(getConfigDir())
+}
 
-	// Determine configuration directory and file
-	configDir := getConfigDir()
-	configFile := filepath.Join(configDir, "gifcodes.json")
+// newGifListIn creates a GifList backed by the configured store in dir,
+// seeding example mappings when nothing has been stored yet
+func newGifListIn(dir string) *GifList {
+	// Ensure the config directory exists
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Warning: Failed to create config directory: %v", err)
+	}
 
-	list := &GifList{
-		codeMap:    make(map[string][]string), // Changed to []string
-		configFile: configFile,
+	store, err := OpenStore(dir)
+	if err != nil {
+		log.Printf("Warning: Failed to open %s store, falling back to JSON: %v", storageBackend(), err)
+		store = NewJSONStore(filepath.Join(dir, jsonFileName))
 	}
 
-	// Ensure the config directory exists
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		log.Printf("Warning: Failed to create config directory: %v", err)
+	return newGifList(store)
+}
+
+// newGifList creates a GifList on top of an already opened store
+func newGifList(store Store) *GifList {
+	log.Printf("Initializing GifList from %s", store.Location())
+
+	list := &GifList{
+		codeMap:    make(map[string]*Code),
+		store:      store,
+		dirtyCodes: make(map[string]bool),
+		stored:     make(map[string]*Code),
+		rng:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		selection:  make(map[string]*selectionState),
+		policy:     PolicyFromEnv(),
 	}
 
 	// Try to load existing mappings
-	if err := list.LoadFromFile(); err != nil {
-		log.Printf("No existing mappings found or error loading: %v", err)
+	if err := list.Load(); errors.Is(err, os.ErrNotExist) {
+		log.Printf("No existing mappings found: %v", err)
 		log.Println("Adding default example mappings")
 
-		// Add some example mappings
+		// Add some example mappings, each one is persisted as it is added
 		list.AddGif("gg", "https://media.giphy.com/media/3o7abldj0b3rxrZUxW/giphy.gif")
 		list.AddGif("gg", "https://media.giphy.com/media/12XDYvMJNcmLgQ/giphy.gif") // Second URL for same code
 		list.AddGif("ty", "https://media.giphy.com/media/KB8C86UMgLDThpt4WT/giphy.gif")
-
-		// Save the default mappings
-		if err := list.SaveToFile(); err != nil {
-			log.Printf("Warning: Failed to save default mappings: %v", err)
-		}
+	} else if err != nil {
+		// Never reseed over data we failed to read, the damaged file has been set aside
+		log.Printf("Error: Failed to load mappings, starting with an empty list: %v", err)
 	}
 
 	// Log the number of codes and total GIFs
 	totalGifs := 0
-	for _, urls := range list.codeMap {
-		totalGifs += len(urls)
+	for _, c := range list.codeMap {
+		totalGifs += len(c.Gifs)
 	}
 	log.Printf("GifList initialized with %d codes and %d total GIFs", len(list.codeMap), totalGifs)
 
@@ -84,146 +107,391 @@ func getConfigDir() string {
 	return filepath.Join(homeDir, ".thelistbot")
 }
 
-// LoadFromFile loads the code mappings from the JSON file
-func (g *GifList) LoadFromFile() error {
+// Load replaces the in-memory code mappings with the ones in the store
+func (g *GifList) Load() error {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
-	// Check if the file exists
-	if _, err := os.Stat(g.configFile); os.IsNotExist(err) {
-		return fmt.Errorf("config file does not exist: %s", g.configFile)
-	}
-
-	// Read the file
-	data, err := os.ReadFile(g.configFile)
+	codeMap, err := g.store.Load()
 	if err != nil {
-		return fmt.Errorf("failed to read config file: %v", err)
+		return err
 	}
+	g.codeMap = codeMap
+	g.stored = copyCodeMap(codeMap)
+	g.dirtyCodes = make(map[string]bool)
+	g.selection = make(map[string]*selectionState)
 
-	// Parse the JSON
-	if err := json.Unmarshal(data, &g.codeMap); err != nil {
-		// Try to load legacy format (single URL per code)
-		var legacyMap map[string]string
-		if legacyErr := json.Unmarshal(data, &legacyMap); legacyErr == nil {
-			log.Println("Detected legacy format, converting to multi-gif format")
-			for code, url := range legacyMap {
-				g.codeMap[code] = []string{url}
-			}
-		} else {
-			return fmt.Errorf("failed to parse config file: %v", err)
-		}
+	history, err := g.store.LoadHistory()
+	if err != nil {
+		log.Printf("Warning: Failed to load change history: %v", err)
 	}
+	g.history = history
 
 	// Count total GIFs for logging
 	totalGifs := 0
-	for _, urls := range g.codeMap {
-		totalGifs += len(urls)
+	for _, c := range g.codeMap {
+		totalGifs += len(c.Gifs)
 	}
-	log.Printf("Loaded %d code mappings with %d total GIFs from %s", len(g.codeMap), totalGifs, g.configFile)
+	log.Printf("Loaded %d code mappings with %d total GIFs from %s", len(g.codeMap), totalGifs, g.store.Location())
 
 	return nil
 }
 
-// SaveToFile saves the current code mappings to the JSON file
-func (g *GifList) SaveToFile() error {
-	g.mutex.RLock()
-	defer g.mutex.RUnlock()
+// Save writes every code mapping to the store
+func (g *GifList) Save() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
 
-	// Serialize to JSON
-	data, err := json.MarshalIndent(g.codeMap, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to serialize code mappings: %v", err)
+	if err := g.store.SaveAll(g.codeMap); err != nil {
+		return err
 	}
+	g.stored = copyCodeMap(g.codeMap)
+	g.dirtyCodes = make(map[string]bool)
+	return nil
+}
 
-	// Write to file
-	if err := os.WriteFile(g.configFile, data, 0644); err != nil {
-		return fmt.Errorf("failed to write config file: %v", err)
+// Flush persists pick statistics that have changed since the last write
+func (g *GifList) Flush() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if len(g.dirtyCodes) == 0 {
+		return
 	}
+	g.syncLocked()
 
-	// Count total GIFs for logging
-	totalGifs := 0
-	for _, urls := range g.codeMap {
-		totalGifs += len(urls)
+	for code := range g.dirtyCodes {
+		g.persistCode(code)
 	}
-	log.Printf("Saved %d code mappings with %d total GIFs to %s", len(g.codeMap), totalGifs, g.configFile)
+}
 
-	return nil
+// Close flushes pending pick statistics and releases the underlying store
+func (g *GifList) Close() error {
+	// Let pending downloads record their results before the final flush
+	g.mirrors.Wait()
+	g.Flush()
+	return g.store.Close()
+}
+
+// persistCode writes a single code's GIFs to the store, removing the code
+// when it has none left. Callers must hold the write lock so the store sees
+// changes in the same order as the in-memory map.
+func (g *GifList) persistCode(code string) {
+	delete(g.dirtyCodes, code)
+
+	var err error
+	c, ok := g.codeMap[code]
+	if ok {
+		err = g.store.PutCode(code, copyCode(c))
+	} else {
+		err = g.store.DeleteCode(code)
+	}
+	if err != nil {
+		// Keep it dirty so the next Flush tries again
+		log.Printf("Warning: Failed to persist change to code %s: %v", code, err)
+		g.dirtyCodes[code] = true
+		return
+	}
+
+	if ok {
+		g.stored[code] = copyCode(c)
+	} else {
+		delete(g.stored, code)
+	}
 }
 
 // AddGif adds a GIF URL to a code's list, creates the code if it doesn't exist
 func (g *GifList) AddGif(code string, gifURL string) error {
-	if len(code) > 10 {
-		log.Printf("Rejected invalid code length: %s (%d chars)", code, len(code))
-		return fmt.Errorf("code must be less than 10 characters")
+	return g.AddGifBy(code, gifURL, "")
+}
+
+// AddGifBy adds a GIF URL to a code's list and records who added it
+func (g *GifList) AddGifBy(code string, gifURL string, addedBy string) error {
+	if err := g.validateCode(code); err != nil {
+		return err
+	}
+	if err := validateURL(gifURL); err != nil {
+		return err
 	}
 
 	g.mutex.Lock()
+	g.syncLocked()
+
+	gif := Gif{
+		URL:     gifURL,
+		AddedBy: addedBy,
+		AddedAt: time.Now(),
+	}
+
+	// Adding to an alias adds to the pool it points at
+	code, c, found := g.resolveLocked(code)
+	if !found && c == nil && g.codeMap[code] != nil {
+		g.mutex.Unlock()
+		return fmt.Errorf("alias %s is broken, remove it and add it again", code)
+	}
 
 	// Check if this URL is already in the list for this code
-	urls, found := g.codeMap[code]
+	before := g.snapshotLocked(code)
 	if found {
-		for _, existingURL := range urls {
-			if existingURL == gifURL {
-				g.mutex.Unlock()
-				log.Printf("URL already exists for code %s: %s", code, gifURL)
-				return fmt.Errorf("URL already exists for this code")
-			}
+		if indexOfURL(c.Gifs, gifURL) >= 0 {
+			g.mutex.Unlock()
+			log.Printf("URL already exists for code %s: %s", code, gifURL)
+			return fmt.Errorf("URL already exists for this code")
 		}
 		log.Printf("Adding new URL for existing code %s: %s", code, gifURL)
-		g.codeMap[code] = append(g.codeMap[code], gifURL)
+		c.Gifs = append(c.Gifs, gif)
 	} else {
 		log.Printf("Creating new code %s with URL: %s", code, gifURL)
-		g.codeMap[code] = []string{gifURL}
+		g.codeMap[code] = &Code{Gifs: []Gif{gif}}
 	}
 
-	// Release the lock before file I/O
+	// Persist and record the change
+	g.commitChange(code, ActionAdd, addedBy, gifURL, before)
 	g.mutex.Unlock()
 
-	// Persist the change
-	if err := g.SaveToFile(); err != nil {
-		log.Printf("Warning: Failed to persist code change: %v", err)
+	g.mirrorGif(gifURL)
+	return nil
+}
+
+// CheckAdd reports whether AddGif would accept a GIF, without adding it
+func (g *GifList) CheckAdd(code string, gifURL string) error {
+	if err := g.validateCode(code); err != nil {
+		return err
+	}
+	if err := validateURL(gifURL); err != nil {
+		return err
 	}
 
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	name, c, found := g.resolveLocked(code)
+	if !found && c == nil && g.codeMap[code] != nil {
+		return fmt.Errorf("alias %s is broken, remove it and add it again", code)
+	}
+	if found && indexOfURL(c.Gifs, gifURL) >= 0 {
+		return fmt.Errorf("URL already exists for code %s", name)
+	}
 	return nil
 }
 
-// GetGif returns a randomly selected GIF URL for the given code
+// Seed makes GIF selection repeatable, mainly for tests
+func (g *GifList) Seed(seed int64) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.rng = rand.New(rand.NewSource(seed))
+}
+
+// GetGif returns a GIF URL for the given code using the code's selection
+// mode, without any per-channel history
 func (g *GifList) GetGif(code string) (string, bool) {
-	g.mutex.RLock()
-	defer g.mutex.RUnlock()
+	return g.GetGifForChannel(code, "")
+}
 
-	urls, found := g.codeMap[code]
-	if !found || len(urls) == 0 {
-		return "", false
+// GetGifForChannel returns a GIF URL for the given code using the code's
+// selection mode, tracking shuffle and round-robin progress per channel, and
+// records the pick. Pick statistics are persisted on the next Flush.
+func (g *GifList) GetGifForChannel(code string, channelID string) (string, bool) {
+	gif, found := g.PickGif(code, channelID)
+	return gif.URL, found
+}
+
+// PickGif is GetGifForChannel returning a copy of the whole GIF. A dead GIF
+// is only picked when it has a mirrored copy to post instead.
+func (g *GifList) PickGif(code string, channelID string) (Gif, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	code, c, found := g.resolveLocked(code)
+	if !found || len(c.Gifs) == 0 {
+		return Gif{}, false
 	}
 
-	// If there's only one URL, return it
-	if len(urls) == 1 {
-		// Simplified logging
-		return urls[0], true
+	// Links the checker has given up on are never posted
+	live := g.postableGifs(c.Gifs)
+	if len(live) == 0 {
+		log.Printf("Every GIF for code %s is dead", code)
+		return Gif{}, false
+	}
+
+	picked := live[g.selectIndex(code, c.EffectiveMode(), live, channelID)]
+	index := indexOfURL(c.Gifs, picked.URL)
+
+	c.Gifs[index].PickCount++
+	c.Gifs[index].LastPicked = time.Now()
+	g.dirtyCodes[code] = true
+
+	return copyGifs(c.Gifs[index : index+1])[0], true
+}
+
+// RerollGif picks a GIF for a code other than excludeURL, when the code has
+// another, to swap a posted GIF for. Unlike PickGif it records no pick, so
+// a reroll isn't counted as a use.
+func (g *GifList) RerollGif(code string, excludeURL string) (Gif, bool) {
+	// Picking advances the random source, which needs the write lock
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	_, c, found := g.resolveLocked(code)
+	if !found {
+		return Gif{}, false
 	}
 
-	// Otherwise, randomly select one
-	selectedURL := urls[rand.Intn(len(urls))]
-	// Simplified logging for random selection
+	live := g.postableGifs(c.Gifs)
+	others := make([]Gif, 0, len(live))
+	for _, gif := range live {
+		if gif.URL != excludeURL {
+			others = append(others, gif)
+		}
+	}
+	if len(others) == 0 {
+		others = live
+	}
+	if len(others) == 0 {
+		return Gif{}, false
+	}
 
-	return selectedURL, true
+	index := pickWeighted(others, g.rng)
+	return copyGifs(others[index : index+1])[0], true
 }
 
-// GetAllGifsForCode returns all GIF URLs for a given code
+// GetAllGifsForCode returns all GIF URLs for a given code, following aliases
 func (g *GifList) GetAllGifsForCode(code string) ([]string, bool) {
 	g.mutex.RLock()
 	defer g.mutex.RUnlock()
 
-	urls, found := g.codeMap[code]
-	return urls, found && len(urls) > 0
+	_, c, found := g.resolveLocked(code)
+	if !found {
+		return nil, false
+	}
+	return gifURLs(c.Gifs), len(c.Gifs) > 0
+}
+
+// HasPostableGifs reports whether PickGif would find a GIF for a code,
+// following aliases and leaving out dead links without a local copy
+func (g *GifList) HasPostableGifs(code string) bool {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	_, c, found := g.resolveLocked(code)
+	return found && len(g.postableGifs(c.Gifs)) > 0
+}
+
+// GetGifDetails returns a copy of every GIF and its metadata for a code
+func (g *GifList) GetGifDetails(code string) ([]Gif, bool) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	_, c, found := g.resolveLocked(code)
+	if !found {
+		return nil, false
+	}
+	return copyGifs(c.Gifs), len(c.Gifs) > 0
+}
+
+// GetMode returns the selection mode of a code
+func (g *GifList) GetMode(code string) (SelectionMode, bool) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	_, c, found := g.resolveLocked(code)
+	if !found {
+		return "", false
+	}
+	return c.EffectiveMode(), true
+}
+
+// SetMode changes how GIFs are picked for a code and restarts every
+// channel's progress through it
+func (g *GifList) SetMode(code string, mode SelectionMode, by string) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.syncLocked()
+
+	code, c, found := g.resolveLocked(code)
+	if !found {
+		log.Printf("Attempted to set mode of non-existent code: %s", code)
+		return false
+	}
+
+	before := copyCode(c)
+	c.Mode = mode
+	g.resetSelection(code)
+	log.Printf("Set selection mode for code %s to %s", code, mode)
+	g.commitChange(code, ActionMode, by, string(mode), before)
+	return true
+}
+
+// findGif returns the canonical code and the GIF with the given URL in it,
+// or nil if there is no such GIF. Callers must hold the lock.
+func (g *GifList) findGif(code string, gifURL string) (string, *Gif) {
+	code, c, found := g.resolveLocked(code)
+	if !found {
+		return code, nil
+	}
+	if index := indexOfURL(c.Gifs, gifURL); index >= 0 {
+		return code, &c.Gifs[index]
+	}
+	return code, nil
+}
+
+// SetTags replaces the tags of one GIF
+func (g *GifList) SetTags(code string, gifURL string, tags []string, by string) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.syncLocked()
+
+	code, gif := g.findGif(code, gifURL)
+	if gif == nil {
+		log.Printf("URL not found for code %s: %s", code, gifURL)
+		return false
+	}
+
+	before := g.snapshotLocked(code)
+	gif.Tags = append([]string(nil), tags...)
+	log.Printf("Set tags for %s in code %s: %v", gifURL, code, tags)
+	g.commitChange(code, ActionTag, by, gifURL, before)
+	return true
+}
+
+// SetWeight changes how likely one GIF is to be picked relative to the
+// others in its code
+func (g *GifList) SetWeight(code string, gifURL string, weight int, by string) error {
+	if weight < 1 || weight > MaxWeight {
+		return fmt.Errorf("weight must be between 1 and %d", MaxWeight)
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.syncLocked()
+
+	code, gif := g.findGif(code, gifURL)
+	if gif == nil {
+		log.Printf("URL not found for code %s: %s", code, gifURL)
+		return fmt.Errorf("URL not found for code: %s", code)
+	}
+
+	before := g.snapshotLocked(code)
+	gif.Weight = weight
+	log.Printf("Set weight for %s in code %s to %d", gifURL, code, weight)
+	g.commitChange(code, ActionWeight, by, gifURL, before)
+	return nil
 }
 
 // RemoveGif removes a specific GIF URL from a code
 func (g *GifList) RemoveGif(code string, gifURL string) bool {
+	return g.RemoveGifBy(code, gifURL, "")
+}
+
+// RemoveGifBy removes a specific GIF URL from a code on behalf of a user.
+// With no URL the code itself is removed; removing an alias leaves the pool
+// it points at intact, while removing a real code also removes every alias of it.
+func (g *GifList) RemoveGifBy(code string, gifURL string, by string) bool {
 	g.mutex.Lock()
+	g.syncLocked()
 
-	urls, exists := g.codeMap[code]
+	c, exists := g.codeMap[code]
 	if !exists {
 		g.mutex.Unlock()
 		log.Printf("Attempted to remove from non-existent code: %s", code)
@@ -232,27 +500,41 @@ func (g *GifList) RemoveGif(code string, gifURL string) bool {
 
 	// If no specific URL provided, remove all URLs for the code
 	if gifURL == "" {
+		before := copyCode(c)
 		delete(g.codeMap, code)
-		log.Printf("Removed entire code: %s with %d GIFs", code, len(urls))
-
-		g.mutex.Unlock()
+		g.resetSelection(code)
 
-		// Persist the change
-		if err := g.SaveToFile(); err != nil {
-			log.Printf("Warning: Failed to persist removal: %v", err)
+		// Persist and record the change
+		if c.AliasOf != "" {
+			log.Printf("Removed alias: %s -> %s", code, c.AliasOf)
+			g.commitChange(code, ActionRemoveAlias, by, c.AliasOf, before)
+		} else {
+			log.Printf("Removed entire code: %s with %d GIFs", code, len(c.Gifs))
+			g.commitChange(code, ActionRemoveCode, by, "", before)
 		}
+		g.removeAliasesOf(code, by)
+		g.mutex.Unlock()
 
 		return true
 	}
 
+	// Removing a URL through an alias removes it from the aliased pool
+	code, c, exists = g.resolveLocked(code)
+	if !exists {
+		g.mutex.Unlock()
+		log.Printf("Alias %s does not lead to a code", code)
+		return false
+	}
+
 	// Find and remove the specific URL
+	before := copyCode(c)
 	found := false
-	newURLs := make([]string, 0, len(urls))
-	for _, url := range urls {
-		if url == gifURL {
+	newGifs := make([]Gif, 0, len(c.Gifs))
+	for _, gif := range c.Gifs {
+		if gif.URL == gifURL {
 			found = true
 		} else {
-			newURLs = append(newURLs, url)
+			newGifs = append(newGifs, gif)
 		}
 	}
 
@@ -263,28 +545,33 @@ func (g *GifList) RemoveGif(code string, gifURL string) bool {
 	}
 
 	// If removing the last URL for this code, delete the code entirely
-	if len(newURLs) == 0 {
+	if len(newGifs) == 0 {
 		delete(g.codeMap, code)
+		g.resetSelection(code)
 		log.Printf("Removed last URL for code %s, deleting code", code)
 	} else {
-		g.codeMap[code] = newURLs
-		log.Printf("Removed URL for code %s, %d URLs remaining", code, len(newURLs))
+		c.Gifs = newGifs
+		log.Printf("Removed URL for code %s, %d URLs remaining", code, len(newGifs))
 	}
 
-	// Release lock before file I/O
-	g.mutex.Unlock()
-
-	// Persist the change
-	if err := g.SaveToFile(); err != nil {
-		log.Printf("Warning: Failed to persist removal: %v", err)
+	// Persist and record the change
+	g.commitChange(code, ActionRemove, by, gifURL, before)
+	if len(newGifs) == 0 {
+		g.removeAliasesOf(code, by)
 	}
+	g.mutex.Unlock()
 
 	return true
 }
 
 // RemoveCode removes all GIFs associated with a code
 func (g *GifList) RemoveCode(code string) bool {
-	return g.RemoveGif(code, "")
+	return g.RemoveGifBy(code, "", "")
+}
+
+// RemoveCodeBy removes all GIFs associated with a code on behalf of a user
+func (g *GifList) RemoveCodeBy(code string, by string) bool {
+	return g.RemoveGifBy(code, "", by)
 }
 
 // ListAllCodes returns all available codes
@@ -300,10 +587,23 @@ func (g *GifList) ListAllCodes() []string {
 	return codes
 }
 
+// Suggest returns up to limit existing codes that look like typos of code,
+// closest first. It returns nothing if code exists.
+func (g *GifList) Suggest(code string, limit int) []string {
+	codes := g.ListAllCodes()
+	if slices.Contains(codes, code) {
+		return nil
+	}
+	return fuzzy.Closest(code, codes, limit)
+}
+
 // GetCodeDetails returns the number of GIFs for each code
 type CodeDetails struct {
 	Code     string
 	GifCount int
+	Mode     SelectionMode
+	AliasOf  string // Set when the code is an alias, GifCount is then the aliased pool's
+	Picks    int    // Total picks of the code's GIFs
 }
 
 // ListCodesWithCounts returns details about all codes and their GIF counts
@@ -312,11 +612,19 @@ func (g *GifList) ListCodesWithCounts() []CodeDetails {
 	defer g.mutex.RUnlock()
 
 	details := make([]CodeDetails, 0, len(g.codeMap))
-	for code, urls := range g.codeMap {
-		details = append(details, CodeDetails{
-			Code:     code,
-			GifCount: len(urls),
-		})
+	for code, c := range g.codeMap {
+		detail := CodeDetails{
+			Code:    code,
+			AliasOf: c.AliasOf,
+		}
+		if _, target, found := g.resolveLocked(code); found {
+			detail.GifCount = len(target.Gifs)
+			detail.Mode = target.EffectiveMode()
+			for _, gif := range target.Gifs {
+				detail.Picks += gif.PickCount
+			}
+		}
+		details = append(details, detail)
 	}
 
 	return details
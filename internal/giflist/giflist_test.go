@@ -1,10 +1,22 @@
 package giflist
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"theListBot/internal/linkcheck"
+	"theListBot/internal/mirror"
+	"theListBot/internal/safefile"
+	"time"
 )
 
 func TestGifListPersistence(t *testing.T) {
@@ -77,12 +89,12 @@ func TestGifListPersistence(t *testing.T) {
 		t.Fatalf("Failed to read config file: %v", err)
 	}
 
-	var codeMap map[string][]string
+	var codeMap map[string]*Code
 	if err := json.Unmarshal(data, &codeMap); err != nil {
 		t.Fatalf("Failed to parse config file: %v", err)
 	}
 
-	if len(codeMap["t2"]) != 1 || codeMap["t2"][0] != "https://test2.gif" {
+	if codeMap["t2"] == nil || len(codeMap["t2"].Gifs) != 1 || codeMap["t2"].Gifs[0].URL != "https://test2.gif" {
 		t.Errorf("Unexpected content in config file: %v", codeMap)
 	}
 }
@@ -151,3 +163,1101 @@ func TestRandomSelectionFromMultipleGifs(t *testing.T) {
 		}
 	}
 }
+
+func TestRegistryIsolatesGuilds(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "giflist_registry_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.Setenv("GIFLIST_CONFIG_PATH", tempDir)
+	defer os.Unsetenv("GIFLIST_CONFIG_PATH")
+
+	// Write a legacy global file that should be assigned to the default guild
+	legacy := map[string][]string{"lg": {"https://legacy.gif"}}
+	data, _ := json.Marshal(legacy)
+	if err := os.WriteFile(filepath.Join(tempDir, "gifcodes.json"), data, 0644); err != nil {
+		t.Fatalf("Failed to write legacy file: %v", err)
+	}
+
+	os.Setenv("GIFLIST_DEFAULT_GUILD", "111")
+	defer os.Unsetenv("GIFLIST_DEFAULT_GUILD")
+
+	registry := NewRegistry()
+
+	if _, err := os.Stat(filepath.Join(tempDir, "gifcodes.json")); !os.IsNotExist(err) {
+		t.Error("Legacy file should have been moved into the default guild")
+	}
+	if _, found := registry.ForGuild("111").GetAllGifsForCode("lg"); !found {
+		t.Error("Default guild should own the legacy codes")
+	}
+	if _, found := registry.ForGuild("222").GetAllGifsForCode("lg"); found {
+		t.Error("Other guilds should not see the legacy codes")
+	}
+
+	// Codes added in one guild stay in that guild
+	registry.ForGuild("222").AddGif("g2", "https://guild2.gif")
+	if _, found := registry.ForGuild("111").GetAllGifsForCode("g2"); found {
+		t.Error("Guild 111 should not see codes added in guild 222")
+	}
+
+	// And are persisted to the guild's own file
+	reloaded := NewRegistry()
+	if _, found := reloaded.ForGuild("222").GetAllGifsForCode("g2"); !found {
+		t.Error("Guild 222 codes should be reloaded from disk")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "guilds", "222", "gifcodes.json")); err != nil {
+		t.Errorf("Guild 222 should have its own file: %v", err)
+	}
+
+	// Path separators in guild IDs never escape the guilds directory
+	if key := guildKey("../etc"); key != "etc" {
+		t.Errorf("Expected sanitized guild key, got %q", key)
+	}
+}
+
+func TestGifMetadataAndMigration(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "giflist_metadata_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.Setenv("GIFLIST_CONFIG_PATH", tempDir)
+	defer os.Unsetenv("GIFLIST_CONFIG_PATH")
+
+	// Write a file in the previous URL list format
+	oldFormat := map[string][]string{"md": {"https://old.gif"}}
+	data, _ := json.Marshal(oldFormat)
+	if err := os.WriteFile(filepath.Join(tempDir, "gifcodes.json"), data, 0644); err != nil {
+		t.Fatalf("Failed to write old format file: %v", err)
+	}
+
+	list := NewGifList()
+	if urls, found := list.GetAllGifsForCode("md"); !found || urls[0] != "https://old.gif" {
+		t.Fatalf("Old format should be migrated, got %v", urls)
+	}
+
+	if err := list.AddGifBy("md", "https://new.gif", "12345"); err != nil {
+		t.Fatalf("Failed to add GIF: %v", err)
+	}
+	if !list.SetTags("md", "https://new.gif", []string{"dance", "cat"}, "") {
+		t.Fatal("Failed to set tags")
+	}
+	for i := 0; i < 3; i++ {
+		list.GetGif("md")
+	}
+	list.Close()
+
+	reloaded := NewGifList()
+	gifs, found := reloaded.GetGifDetails("md")
+	if !found || len(gifs) != 2 {
+		t.Fatalf("Expected 2 GIFs after reload, got %v", gifs)
+	}
+
+	added := gifs[1]
+	if added.AddedBy != "12345" || added.AddedAt.IsZero() {
+		t.Errorf("Adder metadata was not kept: %+v", added)
+	}
+	if len(added.Tags) != 2 || added.Tags[0] != "dance" {
+		t.Errorf("Tags were not kept: %v", added.Tags)
+	}
+	if picks := gifs[0].PickCount + gifs[1].PickCount; picks != 3 {
+		t.Errorf("Expected 3 recorded picks after flush, got %d", picks)
+	}
+}
+
+func TestWeightedSelectionIsSeedable(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "giflist_weight_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.Setenv("GIFLIST_CONFIG_PATH", tempDir)
+	defer os.Unsetenv("GIFLIST_CONFIG_PATH")
+
+	list := NewGifList()
+	list.AddGif("wt", "https://rare.gif")
+	list.AddGif("wt", "https://common.gif")
+
+	if err := list.SetWeight("wt", "https://common.gif", 9, ""); err != nil {
+		t.Fatalf("Failed to set weight: %v", err)
+	}
+	if err := list.SetWeight("wt", "https://common.gif", 0, ""); err == nil {
+		t.Error("Weight 0 should be rejected")
+	}
+	if err := list.SetWeight("wt", "https://missing.gif", 2, ""); err == nil {
+		t.Error("Setting the weight of an unknown URL should fail")
+	}
+
+	pick := func(seed int64, n int) []string {
+		list.Seed(seed)
+		picks := make([]string, n)
+		for i := range picks {
+			picks[i], _ = list.GetGif("wt")
+		}
+		return picks
+	}
+
+	// The same seed gives the same sequence
+	first, second := pick(7, 20), pick(7, 20)
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Seeded selection differs at pick %d: %s vs %s", i, first[i], second[i])
+		}
+	}
+
+	// A 9:1 weight should pick the common GIF about 90% of the time
+	common := 0
+	for _, url := range pick(42, 1000) {
+		if url == "https://common.gif" {
+			common++
+		}
+	}
+	if common < 850 || common > 950 {
+		t.Errorf("Expected about 900 picks of the weighted GIF, got %d", common)
+	}
+}
+
+func TestRerollRecordsNoPick(t *testing.T) {
+	t.Setenv("GIFLIST_CONFIG_PATH", t.TempDir())
+
+	list := NewGifList()
+	list.AddGif("rr", "https://one.gif")
+	list.AddGif("rr", "https://two.gif")
+
+	for i := 0; i < 20; i++ {
+		gif, found := list.RerollGif("rr", "https://one.gif")
+		if !found || gif.URL != "https://two.gif" {
+			t.Fatalf("Expected the reroll to avoid the excluded GIF, got %+v", gif)
+		}
+	}
+	if gif, found := list.RerollGif("rr", "https://gone.gif"); !found || gif.URL == "" {
+		t.Errorf("Expected a reroll of an unknown URL to pick any GIF, got %+v", gif)
+	}
+
+	gifs, _ := list.GetGifDetails("rr")
+	for _, gif := range gifs {
+		if gif.PickCount != 0 || !gif.LastPicked.IsZero() {
+			t.Errorf("Rerolls should not count as picks, got %+v", gif)
+		}
+	}
+
+	list.AddGif("solo", "https://solo.gif")
+	if gif, found := list.RerollGif("solo", "https://solo.gif"); !found || gif.URL != "https://solo.gif" {
+		t.Errorf("Expected a single-GIF code to reroll to itself, got %+v", gif)
+	}
+}
+
+func TestSelectionModes(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "giflist_mode_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.Setenv("GIFLIST_CONFIG_PATH", tempDir)
+	defer os.Unsetenv("GIFLIST_CONFIG_PATH")
+
+	list := NewGifList()
+	list.Seed(1)
+	urls := []string{"https://m1.gif", "https://m2.gif", "https://m3.gif", "https://m4.gif"}
+	for _, url := range urls {
+		list.AddGif("md", url)
+	}
+
+	// Shuffle mode shows every GIF once per cycle and never repeats back to back
+	if !list.SetMode("md", ModeShuffle, "") {
+		t.Fatal("Failed to set shuffle mode")
+	}
+	previous := ""
+	for cycle := 0; cycle < 5; cycle++ {
+		seen := make(map[string]bool)
+		for i := 0; i < len(urls); i++ {
+			url, _ := list.GetGifForChannel("md", "chan-a")
+			if url == previous {
+				t.Fatalf("Shuffle mode repeated %s back to back", url)
+			}
+			seen[url] = true
+			previous = url
+		}
+		if len(seen) != len(urls) {
+			t.Fatalf("Cycle %d did not show every GIF: %v", cycle, seen)
+		}
+	}
+
+	// Round-robin cycles in order, tracked separately per channel
+	list.SetMode("md", ModeRoundRobin, "")
+	for i := 0; i < 2*len(urls); i++ {
+		url, _ := list.GetGifForChannel("md", "chan-a")
+		if url != urls[i%len(urls)] {
+			t.Fatalf("Round-robin pick %d: expected %s, got %s", i, urls[i%len(urls)], url)
+		}
+	}
+	if url, _ := list.GetGifForChannel("md", "chan-b"); url != urls[0] {
+		t.Errorf("A new channel should start at the first GIF, got %s", url)
+	}
+
+	// The mode is persisted with the list
+	list.Close()
+	reloaded := NewGifList()
+	if mode, _ := reloaded.GetMode("md"); mode != ModeRoundRobin {
+		t.Errorf("Expected round-robin mode after reload, got %s", mode)
+	}
+
+	if _, err := ParseSelectionMode("sometimes"); err == nil {
+		t.Error("Unknown modes should be rejected")
+	}
+}
+
+func TestRoundRobinMovesOnFromMissingGifs(t *testing.T) {
+	t.Setenv("GIFLIST_CONFIG_PATH", t.TempDir())
+
+	list := NewGifList()
+	urls := []string{"https://rr1.gif", "https://rr2.gif", "https://rr3.gif", "https://rr4.gif"}
+	for _, url := range urls {
+		list.AddGif("rr", url)
+	}
+	list.SetMode("rr", ModeRoundRobin, "")
+
+	list.GetGifForChannel("rr", "c1")
+	list.GetGifForChannel("rr", "c1")
+
+	// The last GIF served is removed, the one after it is next
+	list.RemoveGif("rr", urls[1])
+	if url, _ := list.GetGifForChannel("rr", "c1"); url != urls[2] {
+		t.Errorf("Expected %s after the removed GIF, got %s", urls[2], url)
+	}
+
+	// The last GIF served dies, the one after it is next
+	for i := 0; i < DeadAfterFailures; i++ {
+		list.RecordLinkChecks([]linkcheck.Result{{URL: urls[2], Status: 404, CheckedAt: time.Now()}})
+	}
+	if url, _ := list.GetGifForChannel("rr", "c1"); url != urls[3] {
+		t.Errorf("Expected %s after the dead GIF, got %s", urls[3], url)
+	}
+	if url, _ := list.GetGifForChannel("rr", "c1"); url != urls[0] {
+		t.Errorf("Expected the turn to wrap around to %s, got %s", urls[0], url)
+	}
+}
+
+func TestAliasesSharePool(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "giflist_alias_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.Setenv("GIFLIST_CONFIG_PATH", tempDir)
+	defer os.Unsetenv("GIFLIST_CONFIG_PATH")
+
+	list := NewGifList()
+	if err := list.SetAlias("ggs", "gg", ""); err != nil {
+		t.Fatalf("Failed to set alias: %v", err)
+	}
+	if err := list.SetAlias("goodgame", "ggs", ""); err != nil {
+		t.Fatalf("Failed to chain alias: %v", err)
+	}
+
+	// Aliases resolve to the canonical pool, including through chains
+	if canonical := list.Resolve("goodgame"); canonical != "gg" {
+		t.Errorf("Expected goodgame to resolve to gg, got %s", canonical)
+	}
+	if url, found := list.GetGif("goodgame"); !found || url == "" {
+		t.Error("GetGif should follow aliases")
+	}
+
+	// Adding through an alias adds to the shared pool
+	list.AddGif("ggs", "https://shared.gif")
+	urls, _ := list.GetAllGifsForCode("gg")
+	if len(urls) != 3 {
+		t.Errorf("Expected gg to have 3 GIFs after adding through alias, got %v", urls)
+	}
+
+	// Cycles and self aliases are rejected
+	if err := list.SetAlias("gg", "goodgame", ""); err == nil {
+		t.Error("Aliasing gg to goodgame should be rejected as a loop")
+	}
+	if err := list.SetAlias("ggs", "ggs", ""); err == nil {
+		t.Error("Self aliases should be rejected")
+	}
+	if err := list.SetAlias("ty", "gg", ""); err == nil {
+		t.Error("A code with GIFs should not silently become an alias")
+	}
+
+	// Aliases survive a reload
+	list.Close()
+	reloaded := NewGifList()
+	if canonical := reloaded.Resolve("goodgame"); canonical != "gg" {
+		t.Errorf("Expected aliases to be persisted, goodgame resolves to %s", canonical)
+	}
+
+	// Removing an alias keeps the pool, removing the pool removes its aliases
+	reloaded.RemoveCode("goodgame")
+	if _, found := reloaded.GetAllGifsForCode("gg"); !found {
+		t.Error("Removing an alias should not remove the aliased code")
+	}
+	reloaded.RemoveCode("gg")
+	if _, found := reloaded.GetAllGifsForCode("ggs"); found {
+		t.Error("Aliases of a removed code should be removed too")
+	}
+}
+
+func TestHistoryAndRevert(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "giflist_history_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.Setenv("GIFLIST_CONFIG_PATH", tempDir)
+	defer os.Unsetenv("GIFLIST_CONFIG_PATH")
+
+	list := NewGifList()
+	list.AddGifBy("gg", "https://extra.gif", "alice")
+	list.RemoveCodeBy("gg", "vandal")
+
+	changes := list.History("gg", 10)
+	if len(changes) < 2 {
+		t.Fatalf("Expected at least 2 changes for gg, got %d", len(changes))
+	}
+	removal := changes[0]
+	if removal.Action != ActionRemoveCode || removal.By != "vandal" || removal.After != nil {
+		t.Fatalf("Unexpected newest change: %+v", removal)
+	}
+	if changes[1].Action != ActionAdd || changes[1].By != "alice" || changes[1].Detail != "https://extra.gif" {
+		t.Errorf("Unexpected add change: %+v", changes[1])
+	}
+
+	// History survives a reload and the removal can be reverted
+	list.Close()
+	reloaded := NewGifList()
+	revert, err := reloaded.Revert(removal.ID, "mod", false)
+	if err != nil {
+		t.Fatalf("Failed to revert removal: %v", err)
+	}
+	if revert.Action != ActionRevert || revert.By != "mod" {
+		t.Errorf("Unexpected revert change: %+v", revert)
+	}
+	urls, found := reloaded.GetAllGifsForCode("gg")
+	if !found || len(urls) != 3 {
+		t.Errorf("Expected gg restored with 3 GIFs, got %v", urls)
+	}
+
+	// Reverting an older change that has since been superseded needs force
+	addID := changes[1].ID
+	if _, err := reloaded.Revert(addID, "mod", false); err != nil {
+		t.Errorf("Reverting the add should apply cleanly after restoring, got %v", err)
+	}
+	reloaded.AddGif("gg", "https://later.gif")
+	if _, err := reloaded.Revert(removal.ID, "mod", false); err == nil {
+		t.Error("Reverting a change to a code edited since should require force")
+	}
+	if _, err := reloaded.Revert(removal.ID, "mod", true); err != nil {
+		t.Errorf("Forced revert should succeed: %v", err)
+	}
+	if _, err := reloaded.Revert(9999, "mod", false); err == nil {
+		t.Error("Unknown change IDs should be rejected")
+	}
+}
+
+func TestForcedRevertKeepsAliasesValid(t *testing.T) {
+	t.Setenv("GIFLIST_CONFIG_PATH", t.TempDir())
+
+	list := NewGifList()
+	list.AddGifBy("wave", "https://wave.gif", "u1")
+	added := list.History("wave", 1)[0]
+	list.AddGifBy("wave", "https://wave2.gif", "u1")
+	if err := list.SetAlias("hi", "wave", "u1"); err != nil {
+		t.Fatalf("SetAlias failed: %v", err)
+	}
+
+	// Undoing the creation of wave deletes it, and its alias with it
+	if _, err := list.Revert(added.ID, "mod", true); err != nil {
+		t.Fatalf("Forced revert failed: %v", err)
+	}
+	if _, found := list.GetAllGifsForCode("wave"); found {
+		t.Error("Expected wave to be deleted by the revert")
+	}
+	if slices.Contains(list.ListAllCodes(), "hi") {
+		t.Error("Expected the alias of the deleted code to be removed")
+	}
+
+	// Restoring b as an alias of a is refused once a leads to b
+	list.AddGif("a", "https://a.gif")
+	list.SetAlias("b", "a", "u1")
+	list.RemoveCode("b")
+	removal := list.History("b", 1)[0]
+	list.RemoveCode("a")
+	list.AddGif("b", "https://b.gif")
+	list.SetAlias("a", "b", "u1")
+	if _, err := list.Revert(removal.ID, "mod", true); err == nil {
+		t.Error("Expected a revert that would create an alias loop to fail")
+	}
+	if urls, _ := list.GetAllGifsForCode("a"); !slices.Equal(urls, []string{"https://b.gif"}) {
+		t.Errorf("Expected the refused revert to leave b alone, got %v", urls)
+	}
+}
+
+func TestImportStrategies(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "giflist_import_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.Setenv("GIFLIST_CONFIG_PATH", tempDir)
+	defer os.Unsetenv("GIFLIST_CONFIG_PATH")
+
+	list := NewGifList()
+	list.RemoveCode("ty")
+	list.AddGif("wave", "https://wave.gif")
+
+	exported, err := list.Export()
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	roundTrip, err := ParseImport(exported)
+	if err != nil || len(roundTrip["gg"].Gifs) != 2 {
+		t.Fatalf("Export didn't round trip: %v %+v", err, roundTrip)
+	}
+
+	imported := map[string]*Code{
+		"gg":             {Gifs: []Gif{{URL: "https://new-gg.gif"}, {URL: "not a url"}}},
+		"hi":             {Gifs: []Gif{{URL: "https://hi.gif"}}},
+		"hello":          {AliasOf: "hi"},
+		"waytoolongcode": {Gifs: []Gif{{URL: "https://long.gif"}}},
+	}
+
+	// A dry run reports without changing anything
+	report := list.Import(imported, ImportMerge, true, "importer")
+	if len(report.Added) != 3 || len(report.Skipped) != 2 {
+		t.Errorf("Unexpected merge preview: %+v", report)
+	}
+	if _, found := list.GetAllGifsForCode("hi"); found {
+		t.Error("Dry run should not create codes")
+	}
+
+	// Skip-existing leaves gg alone but creates the new codes
+	report = list.Import(imported, ImportSkipExisting, false, "importer")
+	if urls, _ := list.GetAllGifsForCode("gg"); len(urls) != 2 {
+		t.Errorf("Skip-existing should not touch gg, got %v", urls)
+	}
+	if list.Resolve("hello") != "hi" {
+		t.Errorf("Expected hello to be imported as an alias of hi")
+	}
+	details, _ := list.GetGifDetails("hi")
+	if len(details) != 1 || details[0].AddedBy != "importer" || details[0].AddedAt.IsZero() {
+		t.Errorf("Imported GIF without metadata should be credited to the importer: %+v", details)
+	}
+
+	// Merge adds the new URL to gg
+	list.Import(imported, ImportMerge, false, "importer")
+	if urls, _ := list.GetAllGifsForCode("gg"); len(urls) != 3 {
+		t.Errorf("Merge should add to gg, got %v", urls)
+	}
+
+	// Replace makes the list match the file and records each change
+	report = list.Import(imported, ImportReplace, false, "importer")
+	if urls, _ := list.GetAllGifsForCode("gg"); len(urls) != 1 || urls[0] != "https://new-gg.gif" {
+		t.Errorf("Replace should leave only the imported gg GIF, got %v", urls)
+	}
+	if _, found := list.GetAllGifsForCode("wave"); found {
+		t.Error("Replace should remove codes missing from the file")
+	}
+	if len(report.Removed) != 3 {
+		t.Errorf("Expected 3 removals (2 gg GIFs and wave), got %+v", report.Removed)
+	}
+	changes := list.History("wave", 1)
+	if len(changes) != 1 || changes[0].Action != ActionImport {
+		t.Errorf("Expected the import to be recorded in history, got %+v", changes)
+	}
+}
+
+func TestImportDropsOtherBotsState(t *testing.T) {
+	t.Setenv("GIFLIST_CONFIG_PATH", t.TempDir())
+
+	list := NewGifList()
+	list.AddGif("oops", "https://oops.gif")
+	policy := DefaultPolicy()
+	policy.Blocklist = []string{"oops"}
+	list.SetPolicy(policy)
+
+	checked := time.Now().Add(-time.Hour)
+	imported := map[string]*Code{
+		"gg": {Gifs: []Gif{{
+			URL: "https://gg.gif", AddedBy: "u1", AddedAt: checked, Tags: []string{"happy"}, Weight: 3,
+			PickCount: 9, LastPicked: checked, CheckedAt: checked, CheckStatus: 404, CheckError: "gone",
+			Failures: DeadAfterFailures, Mirror: "0123",
+		}}},
+		"oops": {Gifs: []Gif{{URL: "https://other-oops.gif"}}},
+	}
+
+	report := list.Import(imported, ImportReplace, false, "importer")
+	gifs, _ := list.GetGifDetails("gg")
+	want := Gif{URL: "https://gg.gif", AddedBy: "u1", AddedAt: checked, Tags: []string{"happy"}, Weight: 3}
+	if len(gifs) != 1 || gifs[0].URL != want.URL || gifs[0].AddedBy != want.AddedBy || !gifs[0].AddedAt.Equal(want.AddedAt) ||
+		!slices.Equal(gifs[0].Tags, want.Tags) || gifs[0].Weight != want.Weight {
+		t.Fatalf("Expected the GIF's own details to be imported, got %+v", gifs)
+	}
+	if gif := gifs[0]; gif.PickCount != 0 || !gif.LastPicked.IsZero() || !gif.CheckedAt.IsZero() ||
+		gif.CheckStatus != 0 || gif.CheckError != "" || gif.Failures != 0 || gif.Mirror != "" {
+		t.Errorf("Expected the exporting bot's stats, checks and mirror to be dropped, got %+v", gif)
+	}
+	if _, found := list.PickGif("gg", ""); !found {
+		t.Error("Imported failures should not make the GIF dead")
+	}
+
+	// A code rejected by the policy isn't imported, so replace removes the local one
+	if _, found := list.GetAllGifsForCode("oops"); found {
+		t.Error("Expected replace to remove a local code whose import was rejected")
+	}
+	skipped := slices.ContainsFunc(report.Skipped, func(item ImportItem) bool { return item.Code == "oops" })
+	removed := slices.ContainsFunc(report.Removed, func(item ImportItem) bool { return item.URL == "https://oops.gif" })
+	if !skipped || !removed {
+		t.Errorf("Expected oops to be reported as skipped and removed, got %+v", report)
+	}
+}
+
+func TestImportReportsAmbiguousEntries(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("GIFLIST_CONFIG_PATH", tempDir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("GIF89a" + r.URL.Path))
+	}))
+	defer server.Close()
+
+	// The test server is on loopback, which the default client refuses
+	cache := mirror.New(filepath.Join(tempDir, "mirror"))
+	cache.Client = server.Client()
+
+	list := NewGifList()
+	list.SetMirror(cache)
+	imported := map[string]*Code{
+		"Wave":  {Gifs: []Gif{{URL: server.URL + "/wave.gif"}}},
+		"wave":  {Gifs: []Gif{{URL: server.URL + "/other-wave.gif"}}},
+		"hello": {AliasOf: "wave", Gifs: []Gif{{URL: server.URL + "/hello.gif"}}},
+	}
+
+	report := list.Import(imported, ImportMerge, false, "importer")
+	if len(report.Added) != 2 || len(report.Skipped) != 2 {
+		t.Errorf("Expected the case duplicate and the alias's GIF to be skipped, got %+v", report)
+	}
+	if urls, _ := list.GetAllGifsForCode("wave"); !slices.Equal(urls, []string{server.URL + "/wave.gif"}) {
+		t.Errorf("Expected only the first of the case duplicates, got %v", urls)
+	}
+	if list.Resolve("hello") != "wave" {
+		t.Error("Expected hello to still be imported as an alias")
+	}
+
+	// Imported GIFs are mirrored like added ones
+	list.Close()
+	reloaded := NewGifList()
+	if details, _ := reloaded.GetGifDetails("wave"); len(details) != 1 || details[0].Mirror == "" {
+		t.Errorf("Expected the imported GIF to be mirrored, got %+v", details)
+	}
+}
+
+func TestDeadLinksAreNotPicked(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "giflist_links_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.Setenv("GIFLIST_CONFIG_PATH", tempDir)
+	defer os.Unsetenv("GIFLIST_CONFIG_PATH")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dead.gif" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	list := NewGifList()
+	list.RemoveCode("gg")
+	list.RemoveCode("ty")
+	list.AddGif("wave", server.URL+"/live.gif")
+	list.AddGif("wave", server.URL+"/dead.gif")
+
+	// The test server is on loopback, which the default client refuses
+	checker := linkcheck.NewChecker()
+	checker.Client = server.Client()
+	for i := 0; i < DeadAfterFailures; i++ {
+		list.CheckLinks(context.Background(), checker)
+
+		broken := list.BrokenGifs()
+		if len(broken) != 1 || broken[0].Gif.URL != server.URL+"/dead.gif" || broken[0].Gif.Failures != i+1 {
+			t.Fatalf("Unexpected broken GIFs after check %d: %+v", i+1, broken)
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		if url, _ := list.GetGif("wave"); url != server.URL+"/live.gif" {
+			t.Fatalf("Dead GIF was picked: %s", url)
+		}
+	}
+
+	// Check results survive a reload
+	list.Close()
+	reloaded := NewGifList()
+	if broken := reloaded.BrokenGifs(); len(broken) != 1 || !broken[0].Gif.Dead() {
+		t.Errorf("Expected the dead GIF to stay dead after reload, got %+v", broken)
+	}
+}
+
+func TestDeadLinksFallBackToMirror(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "giflist_mirror_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.Setenv("GIFLIST_CONFIG_PATH", tempDir)
+	defer os.Unsetenv("GIFLIST_CONFIG_PATH")
+
+	var gone atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if gone.Load() {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("GIF89a-wave"))
+	}))
+	defer server.Close()
+
+	// The test server is on loopback, which the default client refuses
+	cache := mirror.New(filepath.Join(tempDir, "mirror"))
+	cache.Client = server.Client()
+
+	list := NewGifList()
+	list.SetMirror(cache)
+	list.RemoveCode("gg")
+	list.RemoveCode("ty")
+	list.AddGif("wave", server.URL+"/wave.gif")
+	list.Close()
+
+	reloaded := NewGifList()
+	reloaded.SetMirror(mirror.New(filepath.Join(tempDir, "mirror")))
+	details, _ := reloaded.GetGifDetails("wave")
+	if len(details) != 1 || details[0].Mirror == "" {
+		t.Fatalf("Expected the added GIF to be mirrored, got %+v", details)
+	}
+
+	gone.Store(true)
+	checker := linkcheck.NewChecker()
+	checker.Client = server.Client()
+	for i := 0; i < DeadAfterFailures; i++ {
+		reloaded.CheckLinks(context.Background(), checker)
+	}
+
+	gif, found := reloaded.PickGif("wave", "")
+	if !found || !gif.Dead() {
+		t.Fatalf("Expected the dead but mirrored GIF to be picked, got %+v", gif)
+	}
+	file, err := reloaded.OpenMirror(gif)
+	if err != nil {
+		t.Fatalf("Failed to open mirrored copy: %v", err)
+	}
+	defer file.Close()
+	data, _ := io.ReadAll(file)
+	if string(data) != "GIF89a-wave" {
+		t.Errorf("Unexpected mirrored contents %q", data)
+	}
+
+	// Without the mirror the dead GIF can't be posted at all
+	reloaded.SetMirror(nil)
+	if _, found := reloaded.PickGif("wave", ""); found {
+		t.Error("A dead GIF without a usable mirror should not be picked")
+	}
+}
+
+func TestSearchRanksMatches(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "giflist_search_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.Setenv("GIFLIST_CONFIG_PATH", tempDir)
+	defer os.Unsetenv("GIFLIST_CONFIG_PATH")
+
+	list := NewGifList()
+	list.AddGif("cat", "https://example.com/sleepy.gif")
+	list.AddGif("dance", "https://example.com/dancing-cat.gif")
+	list.AddGif("party", "https://example.com/confetti.gif")
+	list.SetTags("party", "https://example.com/confetti.gif", []string{"cat", "dance"}, "")
+	list.SetAlias("kitty", "cat", "")
+	list.SetAlias("kitten", "kitty", "")
+
+	results := list.Search("cat")
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results for cat, got %+v", results)
+	}
+	// Code name beats tag, which beats URL
+	order := []string{"cat", "party", "dance"}
+	for i, code := range order {
+		if results[i].Code != code {
+			t.Errorf("Result %d: expected %s, got %s (score %d)", i, code, results[i].Code, results[i].Score)
+		}
+	}
+
+	// Every word has to match
+	if results := list.Search("cat dance"); len(results) != 2 {
+		t.Errorf("Expected party and dance for \"cat dance\", got %+v", results)
+	}
+
+	// Aliases find their code's GIFs
+	if results := list.Search("kitty"); len(results) != 1 || results[0].Code != "cat" {
+		t.Errorf("Expected the alias to find cat, got %+v", results)
+	}
+	if results := list.Search("kitten"); len(results) != 1 || results[0].Code != "cat" {
+		t.Errorf("Expected an alias of an alias to find cat, got %+v", results)
+	}
+
+	if results := list.Search("nothing-like-this"); len(results) != 0 {
+		t.Errorf("Expected no results, got %+v", results)
+	}
+}
+
+func TestReloadPicksUpOutsideEdits(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "giflist_reload_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.Setenv("GIFLIST_CONFIG_PATH", tempDir)
+	defer os.Unsetenv("GIFLIST_CONFIG_PATH")
+
+	list := NewGifList()
+	list.AddGif("wave", "https://wave.gif")
+	if _, _, err := list.ReloadIfChanged(); err != nil {
+		t.Fatalf("ReloadIfChanged failed: %v", err)
+	}
+	if _, reloaded, _ := list.ReloadIfChanged(); reloaded {
+		t.Fatal("The bot's own writes should not count as outside edits")
+	}
+
+	// Picking leaves unsaved statistics on gg
+	list.GetGif("gg")
+
+	// Edit the file by hand
+	configFile := filepath.Join(tempDir, "gifcodes.json")
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatalf("Failed to read config file: %v", err)
+	}
+	var onDisk map[string]*Code
+	if err := json.Unmarshal(data, &onDisk); err != nil {
+		t.Fatalf("Failed to parse config file: %v", err)
+	}
+	onDisk["ty"].Gifs = append(onDisk["ty"].Gifs, Gif{URL: "https://manual.gif"})
+	onDisk["gg"].Gifs = onDisk["gg"].Gifs[:1]
+	delete(onDisk, "wave")
+	data, _ = json.Marshal(onDisk)
+	if err := os.WriteFile(configFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(configFile, later, later)
+
+	report, reloaded, err := list.ReloadIfChanged()
+	if err != nil || !reloaded {
+		t.Fatalf("Expected the outside edit to be reloaded, got %v %v", reloaded, err)
+	}
+	if !slices.Equal(report.Changed, []string{"gg", "ty", "wave"}) || !slices.Equal(report.Conflicts, []string{"gg"}) {
+		t.Errorf("Unexpected reload report: %+v", report)
+	}
+	if urls, _ := list.GetAllGifsForCode("ty"); len(urls) != 2 {
+		t.Errorf("Expected the manually added GIF on ty, got %v", urls)
+	}
+	if _, found := list.GetAllGifsForCode("wave"); found {
+		t.Error("Expected wave to be removed by the outside edit")
+	}
+	if changes := list.History("wave", 1); len(changes) != 1 || changes[0].Action != ActionReload {
+		t.Errorf("Expected the reload to be recorded, got %+v", changes)
+	}
+
+	// Later changes by the bot keep the outside edit
+	list.AddGif("new", "https://new.gif")
+	list.Close()
+	reopened := NewGifList()
+	if urls, _ := reopened.GetAllGifsForCode("ty"); len(urls) != 2 {
+		t.Errorf("The outside edit was overwritten, ty has %v", urls)
+	}
+}
+
+func TestWritesKeepOutsideEdits(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("GIFLIST_CONFIG_PATH", tempDir)
+
+	list := NewGifList()
+	list.GetGif("gg")
+
+	// Edit the file by hand without telling the bot
+	configFile := filepath.Join(tempDir, "gifcodes.json")
+	editFile := func(edit func(map[string]*Code)) {
+		t.Helper()
+		data, err := os.ReadFile(configFile)
+		if err != nil {
+			t.Fatalf("Failed to read config file: %v", err)
+		}
+		var onDisk map[string]*Code
+		if err := json.Unmarshal(data, &onDisk); err != nil {
+			t.Fatalf("Failed to parse config file: %v", err)
+		}
+		edit(onDisk)
+		data, _ = json.Marshal(onDisk)
+		if err := os.WriteFile(configFile, data, 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(configFile, later, later)
+	}
+
+	// An add before the watcher notices keeps the outside edit
+	editFile(func(onDisk map[string]*Code) {
+		onDisk["ty"].Gifs = append(onDisk["ty"].Gifs, Gif{URL: "https://manual.gif"})
+	})
+	if err := list.AddGif("wave", "https://wave.gif"); err != nil {
+		t.Fatalf("AddGif failed: %v", err)
+	}
+
+	// So does a stats flush, which also keeps the unsaved pick
+	editFile(func(onDisk map[string]*Code) {
+		onDisk["hi"] = &Code{Gifs: []Gif{{URL: "https://hi.gif"}}}
+	})
+	list.Flush()
+
+	reopened := NewGifList()
+	if urls, _ := reopened.GetAllGifsForCode("ty"); len(urls) != 2 {
+		t.Errorf("The outside edit to ty was overwritten, it has %v", urls)
+	}
+	if _, found := reopened.GetAllGifsForCode("hi"); !found {
+		t.Error("The outside edit adding hi was overwritten by the flush")
+	}
+	if _, found := reopened.GetAllGifsForCode("wave"); !found {
+		t.Error("Expected the bot's own add to be saved too")
+	}
+	gifs, _ := reopened.GetGifDetails("gg")
+	picks := 0
+	for _, gif := range gifs {
+		picks += gif.PickCount
+	}
+	if picks != 1 {
+		t.Errorf("Expected the unsaved pick on gg to be flushed, got %d", picks)
+	}
+}
+
+func TestReloadLeavesTheStoreAlone(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("GIFLIST_CONFIG_PATH", tempDir)
+	configFile := filepath.Join(tempDir, "gifcodes.json")
+
+	list := NewGifList()
+	for _, code := range []string{"a", "b", "c", "d"} {
+		list.AddGif(code, "https://"+code+".gif")
+	}
+	backups := safefile.Backups(configFile)
+
+	// Delete every code by hand at once
+	data := []byte("{ }\n")
+	if err := os.WriteFile(configFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(configFile, later, later)
+
+	report, reloaded, err := list.ReloadIfChanged()
+	if err != nil || !reloaded || len(report.Changed) == 0 {
+		t.Fatalf("Expected the outside edit to be reloaded, got %+v %v %v", report, reloaded, err)
+	}
+	if after, _ := os.ReadFile(configFile); string(after) != string(data) {
+		t.Errorf("Expected the reload to leave the file as edited, got %s", after)
+	}
+	if after := safefile.Backups(configFile); !slices.Equal(after, backups) {
+		t.Errorf("Expected the reload not to rotate backups, had %d now %d", len(backups), len(after))
+	}
+	if changes := list.History("a", 1); len(changes) != 1 || changes[0].Action != ActionReload {
+		t.Errorf("Expected the reload to be recorded, got %+v", changes)
+	}
+}
+
+func TestReloadNoticesSameSizeEdits(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("GIFLIST_CONFIG_PATH", tempDir)
+
+	list := NewGifList()
+	list.AddGif("wave", "https://wave1.gif")
+
+	// Same size and modification time, as when an edit lands within the
+	// filesystem's timestamp resolution
+	configFile := filepath.Join(tempDir, "gifcodes.json")
+	info, err := os.Stat(configFile)
+	if err != nil {
+		t.Fatalf("Failed to stat config file: %v", err)
+	}
+	data, _ := os.ReadFile(configFile)
+	data = []byte(strings.Replace(string(data), "https://wave1.gif", "https://wave2.gif", 1))
+	if err := os.WriteFile(configFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	os.Chtimes(configFile, info.ModTime(), info.ModTime())
+
+	if _, reloaded, err := list.ReloadIfChanged(); !reloaded || err != nil {
+		t.Fatalf("Expected the same-size edit to be reloaded, got %v %v", reloaded, err)
+	}
+	if urls, _ := list.GetAllGifsForCode("wave"); !slices.Equal(urls, []string{"https://wave2.gif"}) {
+		t.Errorf("Expected the edited URL, got %v", urls)
+	}
+}
+
+// failingStore is a store whose writes can be made to fail
+type failingStore struct {
+	Store
+	fail bool
+}
+
+func (f *failingStore) PutCode(name string, c *Code) error {
+	if f.fail {
+		return errors.New("disk full")
+	}
+	return f.Store.PutCode(name, c)
+}
+
+func TestReloadConflictsWithPendingChanges(t *testing.T) {
+	tempDir := t.TempDir()
+	configFile := filepath.Join(tempDir, "gifcodes.json")
+	store := &failingStore{Store: NewJSONStore(configFile)}
+	list := newGifList(store)
+
+	// The bot changes gg and ty but can't save either
+	store.fail = true
+	list.AddGif("gg", "https://bot.gif")
+	list.AddGif("ty", "https://bot-ty.gif")
+	store.fail = false
+
+	// Meanwhile gg is also edited by hand
+	data, _ := os.ReadFile(configFile)
+	var onDisk map[string]*Code
+	if err := json.Unmarshal(data, &onDisk); err != nil {
+		t.Fatalf("Failed to parse config file: %v", err)
+	}
+	onDisk["gg"].Gifs = append(onDisk["gg"].Gifs, Gif{URL: "https://manual.gif"})
+	data, _ = json.Marshal(onDisk)
+	os.WriteFile(configFile, data, 0644)
+
+	report, reloaded, err := list.ReloadIfChanged()
+	if err != nil || !reloaded {
+		t.Fatalf("Expected the outside edit to be reloaded, got %v %v", reloaded, err)
+	}
+	if !slices.Equal(report.Changed, []string{"gg"}) || !slices.Equal(report.Conflicts, []string{"gg"}) {
+		t.Errorf("Expected only gg to conflict, got %+v", report)
+	}
+	if urls, _ := list.GetAllGifsForCode("gg"); !slices.Contains(urls, "https://manual.gif") || slices.Contains(urls, "https://bot.gif") {
+		t.Errorf("Expected the outside edit to win on gg, got %v", urls)
+	}
+	if changes := list.History("gg", 1); len(changes) != 1 || changes[0].Before == nil || indexOfURL(changes[0].Before.Gifs, "https://bot.gif") < 0 {
+		t.Errorf("Expected the bot's version of gg in the history, got %+v", changes)
+	}
+
+	// The unsaved change to ty wasn't edited by hand, so it stays and is saved
+	list.Flush()
+	reopened := newGifList(NewJSONStore(configFile))
+	if urls, _ := reopened.GetAllGifsForCode("ty"); !slices.Contains(urls, "https://bot-ty.gif") {
+		t.Errorf("Expected the bot's pending change to ty to be kept, got %v", urls)
+	}
+	if urls, _ := reopened.GetAllGifsForCode("gg"); !slices.Contains(urls, "https://manual.gif") {
+		t.Errorf("Expected the outside edit to gg to be saved, got %v", urls)
+	}
+}
+
+func TestStatsFlushesKeepBackups(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("GIFLIST_CONFIG_PATH", tempDir)
+	configFile := filepath.Join(tempDir, "gifcodes.json")
+
+	list := NewGifList()
+	list.AddGif("wave", "https://wave.gif")
+	backups := safefile.Backups(configFile)
+
+	for i := 0; i < 10; i++ {
+		list.GetGif("wave")
+		list.Flush()
+	}
+	if after := safefile.Backups(configFile); !slices.Equal(after, backups) {
+		t.Errorf("Stats flushes should not rotate backups, had %d now %d", len(backups), len(after))
+	}
+
+	list.AddGif("wave", "https://wave2.gif")
+	if after := safefile.Backups(configFile); len(after) != min(len(backups)+1, safefile.BackupCount()) {
+		t.Errorf("Expected an edit to rotate a backup, had %d now %d", len(backups), len(after))
+	}
+}
+
+func TestCodePolicy(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.Blocklist = []string{"darn"}
+
+	valid := []string{"gg", "ty", "a", "v1.0", "tenletters"}
+	for _, code := range valid {
+		if err := policy.Validate(code); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", code, err)
+		}
+		if matched, ok := policy.Match(strings.ToUpper(code)); !ok || matched != code {
+			t.Errorf("Expected %q to trigger %q, got %q %v", strings.ToUpper(code), code, matched, ok)
+		}
+	}
+
+	invalid := map[string]string{
+		"elevenchars": "1 to 10 characters",
+		"":            "1 to 10 characters",
+		"gg!":         "letters, numbers and `.`",
+		"gg world":    "letters, numbers and `.`",
+		"list":        "reserved",
+		"darnit":      "isn't allowed",
+	}
+	for code, message := range invalid {
+		err := policy.Validate(code)
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected %q to be rejected with %q, got %v", code, message, err)
+		}
+		if _, ok := policy.Match(code); ok {
+			t.Errorf("Expected %q not to trigger a code", code)
+		}
+	}
+
+	// The environment can tighten the policy
+	os.Setenv("GIFLIST_CODE_MIN_LENGTH", "2")
+	os.Setenv("GIFLIST_CODE_MAX_LENGTH", "2")
+	os.Setenv("GIFLIST_CODE_CHARS", "letters")
+	os.Setenv("GIFLIST_CODE_BLOCKLIST", "Zz, qq")
+	os.Setenv("GIFLIST_CODE_RESERVED", "no")
+	defer func() {
+		for _, name := range []string{"GIFLIST_CODE_MIN_LENGTH", "GIFLIST_CODE_MAX_LENGTH", "GIFLIST_CODE_CHARS", "GIFLIST_CODE_BLOCKLIST", "GIFLIST_CODE_RESERVED"} {
+			os.Unsetenv(name)
+		}
+	}()
+
+	strict := PolicyFromEnv()
+	if err := strict.Validate("g1"); err == nil || !strings.Contains(err.Error(), "can only contain letters,") {
+		t.Errorf("Expected digits to be rejected, got %v", err)
+	}
+	if err := strict.Validate("ggg"); err == nil || !strings.Contains(err.Error(), "exactly 2 characters") {
+		t.Errorf("Expected a length error, got %v", err)
+	}
+	if err := strict.Validate("zz"); err == nil {
+		t.Error("Expected the blocklist from the environment to apply")
+	}
+	if err := strict.Validate("no"); err == nil {
+		t.Error("Expected the reserved codes from the environment to apply")
+	}
+	if err := strict.Validate("gg"); err != nil {
+		t.Errorf("Expected gg to be valid, got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package giflist
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// maxHistory is how many changes are kept per list, oldest are dropped first
+const maxHistory = 1000
+
+// Actions recorded in the change history
+const (
+	ActionAdd         = "add"
+	ActionRemove      = "remove"
+	ActionRemoveCode  = "remove-code"
+	ActionRemoveAlias = "remove-alias"
+	ActionTag         = "tag"
+	ActionWeight      = "weight"
+	ActionMode        = "mode"
+	ActionAlias       = "alias"
+	ActionRevert      = "revert"
+	ActionImport      = "import"
+	ActionReload      = "reload"
+)
+
+// Change is one recorded mutation of a code
+type Change struct {
+	ID     int       `json:"id"`
+	Code   string    `json:"code"`
+	Action string    `json:"action"`
+	By     string    `json:"by,omitempty"` // User ID of whoever made the change
+	At     time.Time `json:"at"`
+	Detail string    `json:"detail,omitempty"` // The URL or setting involved
+	Before *Code     `json:"before,omitempty"` // Nil when the code didn't exist
+	After  *Code     `json:"after,omitempty"`  // Nil when the code was removed
+}
+
+// snapshotLocked returns a copy of a code, or nil if it doesn't exist.
+// Callers must hold the lock.
+func (g *GifList) snapshotLocked(name string) *Code {
+	if c, found := g.codeMap[name]; found {
+		return copyCode(c)
+	}
+	return nil
+}
+
+// commitChange persists a code after a mutation and records the change in
+// the history. Callers must hold the write lock.
+func (g *GifList) commitChange(name string, action string, by string, detail string, before *Code) {
+	g.persistCode(name)
+	g.recordChange(name, action, by, detail, before)
+}
+
+// recordChange adds a change to the history without writing the code, for
+// changes the store already holds. Callers must hold the write lock.
+func (g *GifList) recordChange(name string, action string, by string, detail string, before *Code) {
+	nextID := 1
+	if len(g.history) > 0 {
+		nextID = g.history[len(g.history)-1].ID + 1
+	}
+
+	change := Change{
+		ID:     nextID,
+		Code:   name,
+		Action: action,
+		By:     by,
+		At:     time.Now(),
+		Detail: detail,
+		Before: before,
+		After:  g.snapshotLocked(name),
+	}
+
+	g.history = append(g.history, change)
+	if len(g.history) > maxHistory {
+		g.history = slices.Clone(g.history[len(g.history)-maxHistory:])
+	}
+
+	if err := g.store.AppendChange(change, maxHistory); err != nil {
+		log.Printf("Warning: Failed to record change %d to code %s: %v", change.ID, name, err)
+	}
+}
+
+// History returns up to limit of the most recent changes, newest first,
+// optionally only those touching one code
+func (g *GifList) History(code string, limit int) []Change {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	changes := make([]Change, 0, limit)
+	for i := len(g.history) - 1; i >= 0 && len(changes) < limit; i-- {
+		if code == "" || g.history[i].Code == code {
+			changes = append(changes, g.history[i])
+		}
+	}
+	return changes
+}
+
+// Revert puts a code back the way it was before a change. If the code has
+// been changed again since, Revert refuses unless force is set, so a revert
+// never silently throws away later edits.
+func (g *GifList) Revert(changeID int, by string, force bool) (Change, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.syncLocked()
+
+	index := slices.IndexFunc(g.history, func(change Change) bool { return change.ID == changeID })
+	if index < 0 {
+		return Change{}, fmt.Errorf("change %d not found", changeID)
+	}
+	change := g.history[index]
+
+	current := g.snapshotLocked(change.Code)
+	if !force && !sameContent(current, change.After) {
+		return Change{}, fmt.Errorf("`%s` has changed since change %d, use `force` to revert anyway", change.Code, changeID)
+	}
+
+	if change.Before != nil && change.Before.AliasOf != "" {
+		if _, _, found := g.resolveLocked(change.Before.AliasOf); !found {
+			return Change{}, fmt.Errorf("can't restore alias `%s`, `%s` no longer exists", change.Code, change.Before.AliasOf)
+		}
+	}
+
+	if change.Before == nil {
+		delete(g.codeMap, change.Code)
+	} else {
+		g.codeMap[change.Code] = copyCode(change.Before)
+	}
+
+	// A forced revert can bring back an alias whose target has since
+	// become an alias of this code
+	if _, _, ok := g.resolveLocked(change.Code); change.Before != nil && !ok {
+		if current == nil {
+			delete(g.codeMap, change.Code)
+		} else {
+			g.codeMap[change.Code] = current
+		}
+		return Change{}, fmt.Errorf("can't restore alias `%s`, `%s` now leads back to it", change.Code, change.Before.AliasOf)
+	}
+	g.resetSelection(change.Code)
+
+	log.Printf("Reverted change %d to code %s", changeID, change.Code)
+	g.commitChange(change.Code, ActionRevert, by, fmt.Sprintf("change %d", changeID), current)
+	revert := g.history[len(g.history)-1]
+
+	// Like RemoveCodeBy, deleting a code takes its aliases with it
+	if change.Before == nil {
+		g.removeAliasesOf(change.Code, by)
+	}
+	return revert, nil
+}
+
+// sameContent compares two code snapshots, ignoring pick statistics
+func sameContent(a *Code, b *Code) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if a.AliasOf != b.AliasOf || a.EffectiveMode() != b.EffectiveMode() || len(a.Gifs) != len(b.Gifs) {
+		return false
+	}
+	for i := range a.Gifs {
+		if a.Gifs[i].URL != b.Gifs[i].URL ||
+			a.Gifs[i].EffectiveWeight() != b.Gifs[i].EffectiveWeight() ||
+			!slices.Equal(a.Gifs[i].Tags, b.Gifs[i].Tags) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,190 @@
+package giflist
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"theListBot/internal/safefile"
+)
+
+// JSONStore keeps all code mappings in a single JSON file that is rewritten
+// on every change, with the change history in a second file beside it
+type JSONStore struct {
+	path        string
+	historyPath string
+	codeMap     map[string]*Code // Mirror of the file contents
+	history     []Change         // Mirror of the history file
+	lastSeen    os.FileInfo      // The file as of the last load or write
+	lastHash    []byte           // SHA-256 of the file as of the last load or write
+}
+
+// NewJSONStore creates a store backed by the JSON file at path
+func NewJSONStore(path string) *JSONStore {
+	return &JSONStore{
+		path:        path,
+		historyPath: filepath.Join(filepath.Dir(path), historyFileName),
+		codeMap:     make(map[string]*Code),
+	}
+}
+
+// Load reads the JSON file, converting older formats if found
+func (j *JSONStore) Load() (map[string]*Code, error) {
+	// Parse the JSON, falling back to the newest valid backup if the file is damaged
+	var codeMap map[string]*Code
+	err := safefile.ReadFile(j.path, func(data []byte) error {
+		decoded, err := decodeCodeMap(data)
+		if err != nil {
+			return err
+		}
+		codeMap = decoded
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	j.codeMap = codeMap
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		log.Printf("Warning: Failed to read %s: %v", j.path, err)
+	}
+	j.remember(data)
+	return copyCodeMap(codeMap), nil
+}
+
+// SaveAll replaces the file contents with the given mappings
+func (j *JSONStore) SaveAll(codeMap map[string]*Code) error {
+	j.codeMap = copyCodeMap(codeMap)
+	return j.write(true)
+}
+
+// PutCode updates one code and rewrites the file. Writes that only change
+// statistics, like every stats flush, don't rotate a backup, or the backups
+// from before the last real edit would be gone within a few flushes.
+func (j *JSONStore) PutCode(name string, c *Code) error {
+	statsOnly := sameContent(j.codeMap[name], c)
+	j.codeMap[name] = copyCode(c)
+	return j.write(!statsOnly)
+}
+
+// DeleteCode removes one code and rewrites the file
+func (j *JSONStore) DeleteCode(name string) error {
+	delete(j.codeMap, name)
+	return j.write(true)
+}
+
+// LoadHistory reads the history file, which may not exist yet
+func (j *JSONStore) LoadHistory() ([]Change, error) {
+	var history []Change
+	err := safefile.ReadFile(j.historyPath, func(data []byte) error {
+		history = nil
+		return json.Unmarshal(data, &history)
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	j.history = history
+	return slices.Clone(history), nil
+}
+
+// AppendChange adds a change and rewrites the history file
+func (j *JSONStore) AppendChange(change Change, limit int) error {
+	j.history = append(j.history, change)
+	if len(j.history) > limit {
+		j.history = slices.Clone(j.history[len(j.history)-limit:])
+	}
+
+	data, err := json.MarshalIndent(j.history, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize change history: %v", err)
+	}
+	if err := safefile.WriteFile(j.historyPath, data, 0644, safefile.BackupCount()); err != nil {
+		return fmt.Errorf("failed to write change history: %v", err)
+	}
+	return nil
+}
+
+// ChangedExternally compares the file with what it was after the last load
+// or write. A different modification time or size settles it, otherwise
+// the contents are hashed, since an edit of the same size within the
+// timestamp resolution leaves both alone.
+func (j *JSONStore) ChangedExternally() bool {
+	info, err := os.Stat(j.path)
+	if err != nil {
+		// A deleted file is left alone, the next write recreates it
+		return false
+	}
+	if j.lastSeen == nil || !info.ModTime().Equal(j.lastSeen.ModTime()) || info.Size() != j.lastSeen.Size() {
+		return true
+	}
+
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		log.Printf("Warning: Failed to read %s: %v", j.path, err)
+		return false
+	}
+	sum := sha256.Sum256(data)
+	return !bytes.Equal(sum[:], j.lastHash)
+}
+
+// remember records the file as it is now, holding data, so only later
+// changes by others count as external
+func (j *JSONStore) remember(data []byte) {
+	info, err := os.Stat(j.path)
+	if err != nil {
+		log.Printf("Warning: Failed to stat %s: %v", j.path, err)
+		return
+	}
+	sum := sha256.Sum256(data)
+	j.lastSeen = info
+	j.lastHash = sum[:]
+}
+
+// Location returns the path of the JSON file
+func (j *JSONStore) Location() string {
+	return j.path
+}
+
+// Close is a no-op, the file is never held open
+func (j *JSONStore) Close() error {
+	return nil
+}
+
+// write serializes the mirrored mappings to the file, keeping the previous
+// version as a backup if backup is set
+func (j *JSONStore) write(backup bool) error {
+	// Serialize to JSON
+	data, err := json.MarshalIndent(j.codeMap, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize code mappings: %v", err)
+	}
+
+	// Write to file atomically
+	keep := 0
+	if backup {
+		keep = safefile.BackupCount()
+	}
+	if err := safefile.WriteFile(j.path, data, 0644, keep); err != nil {
+		return fmt.Errorf("failed to write config file: %v", err)
+	}
+	j.remember(data)
+
+	// Count total GIFs for logging
+	totalGifs := 0
+	for _, c := range j.codeMap {
+		totalGifs += len(c.Gifs)
+	}
+	log.Printf("Saved %d code mappings with %d total GIFs to %s", len(j.codeMap), totalGifs, j.path)
+
+	return nil
+}
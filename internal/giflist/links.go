@@ -0,0 +1,127 @@
+package giflist
+
+import (
+	"context"
+	"log"
+	"sort"
+	"theListBot/internal/linkcheck"
+)
+
+// BrokenGif is a GIF whose link has failed at least one check
+type BrokenGif struct {
+	Code string
+	Gif  Gif
+}
+
+// LinkURLs returns every distinct URL in the list, sorted
+func (g *GifList) LinkURLs() []string {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	seen := make(map[string]bool)
+	var urls []string
+	for _, c := range g.codeMap {
+		for _, gif := range c.Gifs {
+			if !seen[gif.URL] {
+				seen[gif.URL] = true
+				urls = append(urls, gif.URL)
+			}
+		}
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// RecordLinkChecks stores probe results on every GIF with a checked URL.
+// A success resets the failure count. Like pick statistics, the results
+// are persisted on the next Flush and don't appear in the change history.
+func (g *GifList) RecordLinkChecks(results []linkcheck.Result) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	byURL := make(map[string]linkcheck.Result, len(results))
+	for _, result := range results {
+		byURL[result.URL] = result
+	}
+
+	for name, c := range g.codeMap {
+		for i := range c.Gifs {
+			result, ok := byURL[c.Gifs[i].URL]
+			if !ok {
+				continue
+			}
+
+			gif := &c.Gifs[i]
+			wasDead := gif.Dead()
+			gif.CheckedAt = result.CheckedAt
+			gif.CheckStatus = result.Status
+			gif.CheckError = result.Error
+			if result.OK {
+				gif.Failures = 0
+			} else {
+				gif.Failures++
+			}
+			g.dirtyCodes[name] = true
+
+			if gif.Dead() && !wasDead {
+				log.Printf("GIF %s for code %s is dead after %d failed checks: %s", gif.URL, name, gif.Failures, gif.CheckError)
+			} else if wasDead && !gif.Dead() {
+				log.Printf("GIF %s for code %s is working again", gif.URL, name)
+			}
+		}
+	}
+}
+
+// BrokenGifs returns every GIF whose last check failed, dead ones first,
+// then by code
+func (g *GifList) BrokenGifs() []BrokenGif {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	var broken []BrokenGif
+	for name, c := range g.codeMap {
+		for _, gif := range c.Gifs {
+			if gif.Failures > 0 {
+				broken = append(broken, BrokenGif{Code: name, Gif: copyGifs([]Gif{gif})[0]})
+			}
+		}
+	}
+
+	sort.Slice(broken, func(i, j int) bool {
+		if broken[i].Gif.Dead() != broken[j].Gif.Dead() {
+			return broken[i].Gif.Dead()
+		}
+		if broken[i].Code != broken[j].Code {
+			return broken[i].Code < broken[j].Code
+		}
+		return broken[i].Gif.URL < broken[j].Gif.URL
+	})
+	return broken
+}
+
+// CheckLinks probes every URL of a list and records the results
+func (g *GifList) CheckLinks(ctx context.Context, checker *linkcheck.Checker) {
+	urls := g.LinkURLs()
+	if len(urls) == 0 {
+		return
+	}
+
+	results := checker.CheckAll(ctx, urls)
+	if ctx.Err() != nil {
+		// Results cut short by shutdown would count as failures
+		return
+	}
+	g.RecordLinkChecks(results)
+	g.Flush()
+}
+
+// CheckAllLinks runs the link checker over every guild's list
+func (r *Registry) CheckAllLinks(ctx context.Context, checker *linkcheck.Checker) {
+	for _, key := range r.Guilds() {
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Checking links for guild %s", key)
+		r.ForGuild(key).CheckLinks(ctx, checker)
+	}
+}
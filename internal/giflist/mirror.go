@@ -0,0 +1,81 @@
+package giflist
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"theListBot/internal/mirror"
+)
+
+// SetMirror turns on mirroring of newly added GIFs into cache, or off with nil
+func (g *GifList) SetMirror(cache *mirror.Cache) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.mirror = cache
+}
+
+// OpenMirror returns the local copy of a GIF
+func (g *GifList) OpenMirror(gif Gif) (*os.File, error) {
+	g.mutex.RLock()
+	cache := g.mirror
+	g.mutex.RUnlock()
+
+	if cache == nil || gif.Mirror == "" {
+		return nil, fmt.Errorf("no local copy of %s", gif.URL)
+	}
+	return cache.Open(gif.Mirror)
+}
+
+// postableGifs returns the GIFs that can still be posted: those with working
+// links, and dead ones that have a local copy. Callers must hold the lock.
+func (g *GifList) postableGifs(gifs []Gif) []Gif {
+	postable := make([]Gif, 0, len(gifs))
+	for _, gif := range gifs {
+		if !gif.Dead() || (g.mirror != nil && gif.Mirror != "") {
+			postable = append(postable, gif)
+		}
+	}
+	return postable
+}
+
+// mirrorGif downloads a GIF into the mirror in the background so adding a
+// GIF never waits on the download
+func (g *GifList) mirrorGif(gifURL string) {
+	g.mutex.RLock()
+	cache := g.mirror
+	g.mutex.RUnlock()
+
+	if cache == nil {
+		return
+	}
+
+	g.mirrors.Add(1)
+	go func() {
+		defer g.mirrors.Done()
+
+		hash, err := cache.Fetch(gifURL)
+		if err != nil {
+			log.Printf("Warning: Failed to mirror GIF: %v", err)
+			return
+		}
+		g.recordMirror(gifURL, hash)
+	}()
+}
+
+// recordMirror stores the hash of a mirrored copy on every GIF with the URL.
+// Like pick statistics it is persisted on the next Flush.
+func (g *GifList) recordMirror(gifURL string, hash string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for name, c := range g.codeMap {
+		for i := range c.Gifs {
+			if c.Gifs[i].URL == gifURL && c.Gifs[i].Mirror != hash {
+				c.Gifs[i].Mirror = hash
+				g.dirtyCodes[name] = true
+			}
+		}
+	}
+	log.Printf("Mirrored %s as %s", gifURL, hash)
+}
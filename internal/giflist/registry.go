@@ -0,0 +1,228 @@
+package giflist
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"theListBot/internal/mirror"
+)
+
+// directMessageKey is the namespace used for messages that don't come from a
+// guild. Every DM user shares it, so the bot doesn't let DMs change it.
+const directMessageKey = "dm"
+
+// Registry keeps a separate GifList for every guild so codes added in one
+// server never leak into or overwrite another server's codes
+type Registry struct {
+	lists        map[string]*GifList
+	mutex        sync.Mutex
+	configDir    string
+	defaultGuild string
+	mirror       *mirror.Cache // Shared by every guild, nil when mirroring is off
+}
+
+// NewRegistry creates a Registry rooted at the configuration directory and
+// migrates a legacy global gifcodes.json to the default guild if one is set
+func NewRegistry() *Registry {
+	return NewRegistryIn(getConfigDir(), os.Getenv("GIFLIST_DEFAULT_GUILD"), mirror.Enabled())
+}
+
+// NewRegistryIn creates a Registry rooted at configDir without reading the
+// environment. An empty defaultGuild skips the legacy file migration and
+// mirrored turns on the GIF mirror under configDir.
+func NewRegistryIn(configDir, defaultGuild string, mirrored bool) *Registry {
+	r := &Registry{
+		lists:        make(map[string]*GifList),
+		configDir:    configDir,
+		defaultGuild: defaultGuild,
+	}
+
+	if err := r.migrateLegacyFile(); err != nil {
+		log.Printf("Warning: Failed to migrate legacy gif list: %v", err)
+	}
+
+	if mirrored {
+		mirrorDir := filepath.Join(r.configDir, "mirror")
+		log.Printf("Mirroring added GIFs to %s", mirrorDir)
+		r.mirror = mirror.New(mirrorDir)
+	}
+
+	return r
+}
+
+// Close releases the stores of every loaded guild list
+func (r *Registry) Close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for key, list := range r.lists {
+		if err := list.Close(); err != nil {
+			log.Printf("Warning: Failed to close gif list for guild %s: %v", key, err)
+		}
+	}
+}
+
+// FlushAll persists pending pick statistics of every loaded guild list
+func (r *Registry) FlushAll() {
+	for _, list := range r.loadedLists() {
+		list.Flush()
+	}
+}
+
+// loadedLists returns every guild list loaded so far, by guild key
+func (r *Registry) loadedLists() map[string]*GifList {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	lists := make(map[string]*GifList, len(r.lists))
+	for key, list := range r.lists {
+		lists[key] = list
+	}
+	return lists
+}
+
+// ReloadChanged reloads every loaded guild list whose store was edited
+// outside the bot. Lists not loaded yet will read the edits when they are.
+func (r *Registry) ReloadChanged() {
+	for key, list := range r.loadedLists() {
+		report, reloaded, err := list.ReloadIfChanged()
+		if err != nil {
+			log.Printf("Warning: Failed to reload gif list for guild %s: %v", key, err)
+		} else if reloaded {
+			log.Printf("Reloaded gif list for guild %s after an outside edit (%d changed, %d conflicts)",
+				key, len(report.Changed), len(report.Conflicts))
+		}
+	}
+}
+
+// ReloadAll reloads every loaded guild list from its store
+func (r *Registry) ReloadAll() {
+	for key, list := range r.loadedLists() {
+		if _, err := list.Reload(); err != nil {
+			log.Printf("Warning: Failed to reload gif list for guild %s: %v", key, err)
+		}
+	}
+}
+
+// ForGuild returns the GifList for a guild, loading it on first use.
+// Direct messages (empty guild ID) share their own namespace.
+func (r *Registry) ForGuild(guildID string) *GifList {
+	key := guildKey(guildID)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if list, ok := r.lists[key]; ok {
+		return list
+	}
+
+	list := newGifListIn(r.guildDir(key))
+	if r.mirror != nil {
+		list.SetMirror(r.mirror)
+	}
+	r.lists[key] = list
+	return list
+}
+
+// Guilds returns the keys of every guild with a list on disk or in memory
+func (r *Registry) Guilds() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	seen := make(map[string]bool)
+	for key := range r.lists {
+		seen[key] = true
+	}
+
+	entries, err := os.ReadDir(filepath.Join(r.configDir, "guilds"))
+	if err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() {
+				seen[entry.Name()] = true
+			}
+		}
+	}
+
+	guilds := make([]string, 0, len(seen))
+	for key := range seen {
+		guilds = append(guilds, key)
+	}
+	sort.Strings(guilds)
+	return guilds
+}
+
+// DefaultGuild returns the guild that inherits files from before each guild
+// had its own, or an empty string if none is set
+func (r *Registry) DefaultGuild() string {
+	return r.defaultGuild
+}
+
+// GuildDir returns the directory that holds all files for a guild, so other
+// per-guild state can live beside its gif list
+func (r *Registry) GuildDir(guildID string) string {
+	return r.guildDir(guildKey(guildID))
+}
+
+// guildDir returns the directory that holds all files for a guild
+func (r *Registry) guildDir(key string) string {
+	return filepath.Join(r.configDir, "guilds", key)
+}
+
+// guildFile returns the JSON gif list file for a guild
+func (r *Registry) guildFile(key string) string {
+	return filepath.Join(r.guildDir(key), jsonFileName)
+}
+
+// migrateLegacyFile moves the pre-guild global gifcodes.json into the
+// default guild's directory. Without a default guild the file is left alone.
+func (r *Registry) migrateLegacyFile() error {
+	legacyFile := filepath.Join(r.configDir, jsonFileName)
+	if _, err := os.Stat(legacyFile); os.IsNotExist(err) {
+		return nil
+	}
+
+	if r.defaultGuild == "" {
+		log.Printf("Found legacy gif list %s but GIFLIST_DEFAULT_GUILD is not set, leaving it unassigned", legacyFile)
+		return nil
+	}
+
+	key := guildKey(r.defaultGuild)
+	target := r.guildFile(key)
+	if _, err := os.Stat(target); err == nil {
+		log.Printf("Guild %s already has a gif list, not migrating %s", key, legacyFile)
+		return nil
+	}
+
+	if err := os.MkdirAll(r.guildDir(key), 0755); err != nil {
+		return fmt.Errorf("failed to create guild directory: %v", err)
+	}
+	if err := os.Rename(legacyFile, target); err != nil {
+		return fmt.Errorf("failed to move legacy gif list: %v", err)
+	}
+
+	log.Printf("Migrated legacy gif list %s to guild %s", legacyFile, key)
+	return nil
+}
+
+// guildKey maps a Discord guild ID to a safe directory name
+func guildKey(guildID string) string {
+	if guildID == "" {
+		return directMessageKey
+	}
+
+	// Guild IDs are numeric snowflakes, anything else is sanitized so it
+	// can never escape the guilds directory
+	safe := make([]rune, 0, len(guildID))
+	for _, ch := range guildID {
+		if (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch == '-' || ch == '_' {
+			safe = append(safe, ch)
+		}
+	}
+	if len(safe) == 0 {
+		return directMessageKey
+	}
+	return string(safe)
+}
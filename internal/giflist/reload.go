@@ -0,0 +1,172 @@
+package giflist
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// defaultReloadInterval is how often stores are checked for outside edits
+const defaultReloadInterval = 10 * time.Second
+
+// ReloadInterval returns how often to check for outside edits, or 0 if
+// GIFLIST_RELOAD_INTERVAL turns watching off
+func ReloadInterval() time.Duration {
+	value := os.Getenv("GIFLIST_RELOAD_INTERVAL")
+	switch value {
+	case "":
+		return defaultReloadInterval
+	case "0", "off":
+		return 0
+	}
+	if interval, err := time.ParseDuration(value); err == nil && interval >= 0 {
+		return interval
+	}
+	log.Printf("Invalid GIFLIST_RELOAD_INTERVAL %q, using %s", value, defaultReloadInterval)
+	return defaultReloadInterval
+}
+
+// ReloadReport lists the codes a reload changed
+type ReloadReport struct {
+	Changed []string // Codes that now match the store
+	// Conflicts are codes that were edited in the store while the bot had
+	// unsaved changes to them. The store's version wins, and the bot's
+	// version is kept in the history so it can be reverted to. Unsaved
+	// changes to codes the store still has as before are kept.
+	Conflicts []string
+}
+
+// ReloadIfChanged reloads the list if its store was edited by something
+// other than the bot, such as an admin editing gifcodes.json by hand
+func (g *GifList) ReloadIfChanged() (ReloadReport, bool, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if !g.store.ChangedExternally() {
+		return ReloadReport{}, false, nil
+	}
+	report, err := g.reloadLocked()
+	return report, true, err
+}
+
+// syncLocked picks up outside edits before the bot writes to the store.
+// Stores rewrite what they hold in memory, so writing first would overwrite
+// the edit. Callers must hold the write lock.
+func (g *GifList) syncLocked() {
+	if !g.store.ChangedExternally() {
+		return
+	}
+	log.Printf("%s was edited outside the bot, reloading before writing", g.store.Location())
+	if _, err := g.reloadLocked(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// Reload reads the store again and applies any differences to the list.
+// Each changed code is recorded in the history as a reload.
+func (g *GifList) Reload() (ReloadReport, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.reloadLocked()
+}
+
+// reloadLocked does the work of Reload. Callers must hold the write lock.
+func (g *GifList) reloadLocked() (ReloadReport, error) {
+	var report ReloadReport
+
+	stored, err := g.store.Load()
+	if err != nil {
+		// Keep running on what we have rather than on an empty list
+		return report, fmt.Errorf("failed to reload %s: %v", g.store.Location(), err)
+	}
+
+	names := make(map[string]bool)
+	for name := range g.codeMap {
+		names[name] = true
+	}
+	for name := range stored {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		current, next := g.codeMap[name], stored[name]
+
+		if sameContent(current, next) {
+			// Only statistics differ. Unsaved ones in memory are newer,
+			// otherwise the store's are taken as they are.
+			if !g.dirtyCodes[name] && next != nil {
+				g.codeMap[name] = next
+			}
+			continue
+		}
+
+		if sameContent(g.stored[name], next) {
+			// Only the bot changed it and couldn't save yet, keep its
+			// version for the next Flush
+			g.dirtyCodes[name] = true
+			continue
+		}
+
+		detail := "outside edit"
+		if g.dirtyCodes[name] || !sameContent(g.stored[name], current) {
+			log.Printf("Warning: Code %s was edited outside the bot while it had unsaved changes, keeping the outside edit", name)
+			report.Conflicts = append(report.Conflicts, name)
+			detail = "outside edit, replaced unsaved changes"
+			if current != nil && next != nil {
+				carryStats(current, next)
+			}
+		}
+
+		before := g.snapshotLocked(name)
+		if next == nil {
+			delete(g.codeMap, name)
+		} else {
+			g.codeMap[name] = next
+		}
+		g.resetSelection(name)
+		// The code now matches the store, so there is nothing to write back.
+		// Writing would rewrite the file and rotate a backup for every code
+		// in a bulk edit.
+		delete(g.dirtyCodes, name)
+		g.recordChange(name, ActionReload, "", detail, before)
+		report.Changed = append(report.Changed, name)
+	}
+
+	g.stored = copyCodeMap(stored)
+
+	log.Printf("Reloaded %s: %d codes changed, %d conflicts", g.store.Location(), len(report.Changed), len(report.Conflicts))
+	return report, nil
+}
+
+// carryStats copies statistics gathered in memory onto the reloaded
+// version of a code, for GIFs that are in both
+func carryStats(from *Code, to *Code) {
+	for i := range to.Gifs {
+		index := indexOfURL(from.Gifs, to.Gifs[i].URL)
+		if index < 0 {
+			continue
+		}
+		old := from.Gifs[index]
+		if old.PickCount > to.Gifs[i].PickCount {
+			to.Gifs[i].PickCount = old.PickCount
+			to.Gifs[i].LastPicked = old.LastPicked
+		}
+		if old.CheckedAt.After(to.Gifs[i].CheckedAt) {
+			to.Gifs[i].CheckedAt = old.CheckedAt
+			to.Gifs[i].CheckStatus = old.CheckStatus
+			to.Gifs[i].CheckError = old.CheckError
+			to.Gifs[i].Failures = old.Failures
+		}
+		if to.Gifs[i].Mirror == "" {
+			to.Gifs[i].Mirror = old.Mirror
+		}
+	}
+}
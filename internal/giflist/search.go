@@ -0,0 +1,119 @@
+package giflist
+
+import (
+	"sort"
+	"strings"
+)
+
+// Scores for the ways a search term can match a GIF. Code names count for
+// the most because that's what people remember.
+const (
+	scoreCodeExact  = 100
+	scoreCodePrefix = 50
+	scoreCodeSubstr = 30
+	scoreTagExact   = 40
+	scoreTagSubstr  = 20
+	scoreURLSubstr  = 10
+)
+
+// SearchResult is a GIF matching a search, with how well it matched
+type SearchResult struct {
+	Code  string // Canonical code holding the GIF
+	Gif   Gif
+	Score int
+}
+
+// Search finds GIFs whose code, alias, tags or URL match every word of
+// query, best matches first
+func (g *GifList) Search(query string) []SearchResult {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return nil
+	}
+
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	// A GIF can be found by any name that leads to its code, including
+	// aliases of aliases
+	aliases := make(map[string][]string)
+	for name, c := range g.codeMap {
+		if c.AliasOf == "" {
+			continue
+		}
+		if canonical, _, ok := g.resolveLocked(name); ok {
+			aliases[canonical] = append(aliases[canonical], name)
+		}
+	}
+
+	var results []SearchResult
+	for name, c := range g.codeMap {
+		if c.AliasOf != "" {
+			continue
+		}
+
+		names := append([]string{name}, aliases[name]...)
+
+		for _, gif := range c.Gifs {
+			total := 0
+			for _, term := range terms {
+				score := scoreTerm(term, names, gif)
+				if score == 0 {
+					total = 0
+					break
+				}
+				total += score
+			}
+			if total > 0 {
+				results = append(results, SearchResult{Code: name, Gif: copyGifs([]Gif{gif})[0], Score: total})
+			}
+		}
+	}
+
+	// Ties go to the GIFs people pick most
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Gif.PickCount != b.Gif.PickCount {
+			return a.Gif.PickCount > b.Gif.PickCount
+		}
+		if a.Code != b.Code {
+			return a.Code < b.Code
+		}
+		return a.Gif.URL < b.Gif.URL
+	})
+	return results
+}
+
+// scoreTerm returns the best score of one search term against a GIF and
+// the names of its code, or 0 if it doesn't match
+func scoreTerm(term string, names []string, gif Gif) int {
+	best := 0
+	for _, name := range names {
+		switch {
+		case name == term:
+			best = max(best, scoreCodeExact)
+		case strings.HasPrefix(name, term):
+			best = max(best, scoreCodePrefix)
+		case strings.Contains(name, term):
+			best = max(best, scoreCodeSubstr)
+		}
+	}
+
+	for _, tag := range gif.Tags {
+		tag = strings.ToLower(tag)
+		switch {
+		case tag == term:
+			best = max(best, scoreTagExact)
+		case strings.Contains(tag, term):
+			best = max(best, scoreTagSubstr)
+		}
+	}
+
+	if strings.Contains(strings.ToLower(gif.URL), term) {
+		best = max(best, scoreURLSubstr)
+	}
+	return best
+}
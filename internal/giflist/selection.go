@@ -0,0 +1,103 @@
+package giflist
+
+import "strings"
+
+// selectionState remembers what one channel has been shown for one code
+type selectionState struct {
+	bag       []string // URLs still to be dealt in shuffle mode
+	lastURL   string   // Most recent pick, drives round-robin and avoids repeats between bags
+	lastIndex int      // Position of the most recent pick, for when that GIF is gone
+}
+
+// selectionKey identifies the state of a code in a channel
+func selectionKey(code string, channelID string) string {
+	return code + "\x00" + channelID
+}
+
+// selectIndex picks the next GIF from a code's pool for a channel according
+// to the code's selection mode and returns its index in gifs. Callers must
+// hold the write lock.
+func (g *GifList) selectIndex(name string, mode SelectionMode, gifs []Gif, channelID string) int {
+	key := selectionKey(name, channelID)
+	state, ok := g.selection[key]
+	if !ok {
+		state = &selectionState{}
+		g.selection[key] = state
+	}
+
+	index := 0
+	if len(gifs) > 1 {
+		switch mode {
+		case ModeShuffle:
+			index = g.nextFromBag(gifs, state)
+		case ModeRoundRobin:
+			index = nextInTurn(gifs, state)
+		default:
+			index = pickWeighted(gifs, g.rng)
+		}
+	}
+
+	state.lastURL = gifs[index].URL
+	state.lastIndex = index
+	return index
+}
+
+// nextInTurn returns the GIF after the channel's last round-robin pick. If
+// that GIF has since been removed or found dead, the one that took its place
+// is next, rather than going back to the start.
+func nextInTurn(gifs []Gif, state *selectionState) int {
+	if state.lastURL == "" {
+		return 0
+	}
+	if last := indexOfURL(gifs, state.lastURL); last >= 0 {
+		return (last + 1) % len(gifs)
+	}
+	return state.lastIndex % len(gifs)
+}
+
+// nextFromBag deals the next GIF from the channel's shuffle bag, refilling
+// it once every GIF has been shown
+func (g *GifList) nextFromBag(gifs []Gif, state *selectionState) int {
+	for {
+		if len(state.bag) == 0 {
+			state.bag = gifURLs(gifs)
+			g.rng.Shuffle(len(state.bag), func(i, j int) {
+				state.bag[i], state.bag[j] = state.bag[j], state.bag[i]
+			})
+			// Don't start a new bag with the GIF that ended the last one
+			if len(state.bag) > 1 && state.bag[0] == state.lastURL {
+				last := len(state.bag) - 1
+				state.bag[0], state.bag[last] = state.bag[last], state.bag[0]
+			}
+		}
+
+		url := state.bag[0]
+		state.bag = state.bag[1:]
+
+		// GIFs removed or found dead since the bag was filled are skipped
+		if index := indexOfURL(gifs, url); index >= 0 {
+			return index
+		}
+	}
+}
+
+// resetSelection forgets every channel's selection state for a code.
+// Callers must hold the write lock.
+func (g *GifList) resetSelection(name string) {
+	prefix := selectionKey(name, "")
+	for key := range g.selection {
+		if strings.HasPrefix(key, prefix) {
+			delete(g.selection, key)
+		}
+	}
+}
+
+// indexOfURL returns the position of url in gifs, or -1
+func indexOfURL(gifs []Gif, url string) int {
+	for i, gif := range gifs {
+		if gif.URL == url {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,406 @@
+package giflist
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	_ "modernc.org/sqlite" // Pure-Go SQLite driver, no cgo needed
+)
+
+// SQLiteStore keeps code mappings in an embedded SQLite database so changes
+// only touch the rows of the affected code
+type SQLiteStore struct {
+	db      *sql.DB
+	path    string
+	created bool // True when the schema was created by this open
+
+	dataVersion int64 // PRAGMA data_version after the last load
+}
+
+// NewSQLiteStore opens (and if needed creates) the database at path
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	// SQLite only allows one writer, keep everything on one connection
+	db.SetMaxOpenConns(1)
+
+	s := &SQLiteStore{db: db, path: path}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// sqliteMigrations upgrade the schema one version at a time. The index of
+// each entry plus one is the user_version it produces.
+var sqliteMigrations = []string{
+	`CREATE TABLE gifs (
+		code     TEXT    NOT NULL,
+		position INTEGER NOT NULL,
+		url      TEXT    NOT NULL,
+		PRIMARY KEY (code, url)
+	)`,
+	`ALTER TABLE gifs ADD COLUMN added_by    TEXT    NOT NULL DEFAULT '';
+	 ALTER TABLE gifs ADD COLUMN added_at    TEXT    NOT NULL DEFAULT '';
+	 ALTER TABLE gifs ADD COLUMN tags        TEXT    NOT NULL DEFAULT '[]';
+	 ALTER TABLE gifs ADD COLUMN pick_count  INTEGER NOT NULL DEFAULT 0;
+	 ALTER TABLE gifs ADD COLUMN last_picked TEXT    NOT NULL DEFAULT ''`,
+	`ALTER TABLE gifs ADD COLUMN weight INTEGER NOT NULL DEFAULT 1`,
+	`CREATE TABLE codes (
+		code TEXT PRIMARY KEY,
+		mode TEXT NOT NULL DEFAULT ''
+	);
+	 INSERT INTO codes (code) SELECT DISTINCT code FROM gifs`,
+	`ALTER TABLE codes ADD COLUMN alias_of TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE history (
+		id          INTEGER PRIMARY KEY,
+		code        TEXT NOT NULL,
+		action      TEXT NOT NULL,
+		changed_by  TEXT NOT NULL DEFAULT '',
+		changed_at  TEXT NOT NULL,
+		detail      TEXT NOT NULL DEFAULT '',
+		before_json TEXT NOT NULL DEFAULT '',
+		after_json  TEXT NOT NULL DEFAULT ''
+	)`,
+	`ALTER TABLE gifs ADD COLUMN checked_at   TEXT    NOT NULL DEFAULT '';
+	 ALTER TABLE gifs ADD COLUMN check_status INTEGER NOT NULL DEFAULT 0;
+	 ALTER TABLE gifs ADD COLUMN check_error  TEXT    NOT NULL DEFAULT '';
+	 ALTER TABLE gifs ADD COLUMN failures     INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE gifs ADD COLUMN mirror TEXT NOT NULL DEFAULT ''`,
+}
+
+// migrate creates the schema if the database is new and upgrades older schemas
+func (s *SQLiteStore) migrate() error {
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %v", err)
+	}
+
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'gifs'`).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to inspect database: %v", err)
+	}
+	if count == 0 {
+		s.created = true
+	} else if version == 0 {
+		// Databases from before versioning already have the first schema
+		version = 1
+	}
+
+	for ; version < len(sqliteMigrations); version++ {
+		if err := s.migrateTo(version + 1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateTo applies the migration producing version together with the
+// version bump in one transaction, so a crash never leaves a step half done
+func (s *SQLiteStore) migrateTo(version int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(sqliteMigrations[version-1]); err != nil {
+		return fmt.Errorf("failed to migrate schema to version %d: %v", version, err)
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version)); err != nil {
+		return fmt.Errorf("failed to record schema version: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit schema version %d: %v", version, err)
+	}
+	return nil
+}
+
+// Load reads every code mapping, with GIFs ordered as they were added
+func (s *SQLiteStore) Load() (map[string]*Code, error) {
+	if s.created {
+		return nil, fmt.Errorf("database is new: %s: %w", s.path, os.ErrNotExist)
+	}
+
+	s.dataVersion = s.readDataVersion()
+
+	codeMap := make(map[string]*Code)
+	codeRows, err := s.db.Query(`SELECT code, mode, alias_of FROM codes`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query codes: %v", err)
+	}
+	defer codeRows.Close()
+
+	for codeRows.Next() {
+		var name, mode, aliasOf string
+		if err := codeRows.Scan(&name, &mode, &aliasOf); err != nil {
+			return nil, fmt.Errorf("failed to read code row: %v", err)
+		}
+		codeMap[name] = &Code{Mode: SelectionMode(mode), AliasOf: aliasOf}
+	}
+	if err := codeRows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT code, url, added_by, added_at, tags, pick_count, last_picked, weight,
+		checked_at, check_status, check_error, failures, mirror
+		FROM gifs ORDER BY code, position`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query gifs: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var code, addedAt, tags, lastPicked, checkedAt string
+		var gif Gif
+		if err := rows.Scan(&code, &gif.URL, &gif.AddedBy, &addedAt, &tags, &gif.PickCount, &lastPicked, &gif.Weight,
+			&checkedAt, &gif.CheckStatus, &gif.CheckError, &gif.Failures, &gif.Mirror); err != nil {
+			return nil, fmt.Errorf("failed to read gif row: %v", err)
+		}
+		gif.AddedAt = parseSQLiteTime(addedAt)
+		gif.LastPicked = parseSQLiteTime(lastPicked)
+		gif.CheckedAt = parseSQLiteTime(checkedAt)
+		if err := json.Unmarshal([]byte(tags), &gif.Tags); err != nil {
+			log.Printf("Ignoring invalid tags for %s in code %s: %v", gif.URL, code, err)
+		}
+		c, ok := codeMap[code]
+		if !ok {
+			c = &Code{}
+			codeMap[code] = c
+		}
+		c.Gifs = append(c.Gifs, gif)
+	}
+	return codeMap, rows.Err()
+}
+
+// SaveAll replaces every row in a single transaction
+func (s *SQLiteStore) SaveAll(codeMap map[string]*Code) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM gifs`); err != nil {
+		return fmt.Errorf("failed to clear gifs: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM codes`); err != nil {
+		return fmt.Errorf("failed to clear codes: %v", err)
+	}
+	for name, c := range codeMap {
+		if err := insertCode(tx, name, c); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %v", err)
+	}
+	// Once something has been saved the database counts as initialized
+	s.created = false
+	return nil
+}
+
+// PutCode replaces the rows of a single code
+func (s *SQLiteStore) PutCode(name string, c *Code) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := deleteCode(tx, name); err != nil {
+		return err
+	}
+	if err := insertCode(tx, name, c); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %v", err)
+	}
+	s.created = false
+	return nil
+}
+
+// DeleteCode removes the rows of a single code
+func (s *SQLiteStore) DeleteCode(name string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := deleteCode(tx, name); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %v", err)
+	}
+	s.created = false
+	return nil
+}
+
+// LoadHistory reads every recorded change, oldest first
+func (s *SQLiteStore) LoadHistory() ([]Change, error) {
+	rows, err := s.db.Query(`SELECT id, code, action, changed_by, changed_at, detail, before_json, after_json
+		FROM history ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %v", err)
+	}
+	defer rows.Close()
+
+	var history []Change
+	for rows.Next() {
+		var change Change
+		var changedAt, before, after string
+		err := rows.Scan(&change.ID, &change.Code, &change.Action, &change.By, &changedAt, &change.Detail, &before, &after)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history row: %v", err)
+		}
+		change.At = parseSQLiteTime(changedAt)
+		change.Before = decodeSnapshot(before)
+		change.After = decodeSnapshot(after)
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
+// AppendChange records a change and prunes the oldest beyond limit
+func (s *SQLiteStore) AppendChange(change Change, limit int) error {
+	before, err := encodeSnapshot(change.Before)
+	if err != nil {
+		return err
+	}
+	after, err := encodeSnapshot(change.After)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO history (id, code, action, changed_by, changed_at, detail, before_json, after_json)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		change.ID, change.Code, change.Action, change.By, formatSQLiteTime(change.At), change.Detail, before, after)
+	if err != nil {
+		return fmt.Errorf("failed to insert change %d: %v", change.ID, err)
+	}
+
+	if _, err := s.db.Exec(`DELETE FROM history WHERE id <= ?`, change.ID-limit); err != nil {
+		return fmt.Errorf("failed to prune history: %v", err)
+	}
+	return nil
+}
+
+// ChangedExternally reports whether another connection, such as the
+// sqlite3 shell, has committed changes since the last load. SQLite bumps
+// data_version only for commits made by other connections.
+func (s *SQLiteStore) ChangedExternally() bool {
+	return s.readDataVersion() != s.dataVersion
+}
+
+// readDataVersion returns the current PRAGMA data_version
+func (s *SQLiteStore) readDataVersion() int64 {
+	var version int64
+	if err := s.db.QueryRow(`PRAGMA data_version`).Scan(&version); err != nil {
+		log.Printf("Warning: Failed to read data version of %s: %v", s.path, err)
+		return s.dataVersion
+	}
+	return version
+}
+
+// Location returns the path of the database file
+func (s *SQLiteStore) Location() string {
+	return s.path
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// insertCode writes a code's settings and its GIFs in order
+func insertCode(tx *sql.Tx, name string, c *Code) error {
+	_, err := tx.Exec(`INSERT INTO codes (code, mode, alias_of) VALUES (?, ?, ?)`, name, string(c.Mode), c.AliasOf)
+	if err != nil {
+		return fmt.Errorf("failed to insert code %s: %v", name, err)
+	}
+
+	for i, gif := range c.Gifs {
+		tags, err := json.Marshal(append([]string{}, gif.Tags...))
+		if err != nil {
+			return fmt.Errorf("failed to encode tags for %s: %v", gif.URL, err)
+		}
+		_, err = tx.Exec(`INSERT INTO gifs (code, position, url, added_by, added_at, tags, pick_count, last_picked, weight,
+				checked_at, check_status, check_error, failures, mirror)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			name, i, gif.URL, gif.AddedBy, formatSQLiteTime(gif.AddedAt), string(tags), gif.PickCount,
+			formatSQLiteTime(gif.LastPicked), gif.EffectiveWeight(),
+			formatSQLiteTime(gif.CheckedAt), gif.CheckStatus, gif.CheckError, gif.Failures, gif.Mirror)
+		if err != nil {
+			return fmt.Errorf("failed to insert %s for code %s: %v", gif.URL, name, err)
+		}
+	}
+	return nil
+}
+
+// deleteCode removes a code's settings and GIFs
+func deleteCode(tx *sql.Tx, name string) error {
+	if _, err := tx.Exec(`DELETE FROM gifs WHERE code = ?`, name); err != nil {
+		return fmt.Errorf("failed to delete GIFs of code %s: %v", name, err)
+	}
+	if _, err := tx.Exec(`DELETE FROM codes WHERE code = ?`, name); err != nil {
+		return fmt.Errorf("failed to delete code %s: %v", name, err)
+	}
+	return nil
+}
+
+// formatSQLiteTime stores times as RFC 3339 text, empty when unset
+func formatSQLiteTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// parseSQLiteTime reads a time written by formatSQLiteTime
+func parseSQLiteTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// encodeSnapshot stores a code snapshot as JSON, empty for nil
+func encodeSnapshot(c *Code) (string, error) {
+	if c == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode snapshot: %v", err)
+	}
+	return string(data), nil
+}
+
+// decodeSnapshot reads a snapshot written by encodeSnapshot
+func decodeSnapshot(value string) *Code {
+	if value == "" {
+		return nil
+	}
+	var c Code
+	if err := json.Unmarshal([]byte(value), &c); err != nil {
+		log.Printf("Ignoring invalid history snapshot: %v", err)
+		return nil
+	}
+	return &c
+}
@@ -0,0 +1,110 @@
+package giflist
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File names used by the storage backends inside a list's directory
+const (
+	jsonFileName    = "gifcodes.json"
+	sqliteFileName  = "gifcodes.db"
+	historyFileName = "history.json"
+)
+
+// Store persists the code mappings of a GifList. Implementations only need
+// to be safe for use by a single GifList, which serializes all calls.
+type Store interface {
+	// Load returns every stored code mapping. It returns an error wrapping
+	// os.ErrNotExist when nothing has ever been stored.
+	Load() (map[string]*Code, error)
+
+	// SaveAll replaces everything in the store with the given mappings
+	SaveAll(codeMap map[string]*Code) error
+
+	// PutCode stores the GIFs and settings of a single code
+	PutCode(name string, c *Code) error
+
+	// DeleteCode removes a code and all of its GIFs
+	DeleteCode(name string) error
+
+	// LoadHistory returns every recorded change, oldest first
+	LoadHistory() ([]Change, error)
+
+	// AppendChange records a change, keeping at most limit changes
+	AppendChange(change Change, limit int) error
+
+	// ChangedExternally reports whether something other than this store
+	// has changed the data since it was last loaded or written
+	ChangedExternally() bool
+
+	// Location describes where the data lives, for logging
+	Location() string
+
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// storageBackend returns the configured backend name, "json" by default
+func storageBackend() string {
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("GIFLIST_STORAGE")))
+	if backend == "" {
+		return "json"
+	}
+	return backend
+}
+
+// OpenStore opens the backend selected by GIFLIST_STORAGE in dir
+func OpenStore(dir string) (Store, error) {
+	switch backend := storageBackend(); backend {
+	case "json":
+		return NewJSONStore(filepath.Join(dir, jsonFileName)), nil
+	case "sqlite":
+		store, err := NewSQLiteStore(filepath.Join(dir, sqliteFileName))
+		if err != nil {
+			return nil, err
+		}
+		if err := importJSONIfNew(store, filepath.Join(dir, jsonFileName)); err != nil {
+			store.Close()
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", backend)
+	}
+}
+
+// importJSONIfNew copies an existing JSON list into a freshly created SQLite
+// database so switching backends keeps all codes
+func importJSONIfNew(store *SQLiteStore, jsonFile string) error {
+	if !store.created {
+		return nil
+	}
+	if _, err := os.Stat(jsonFile); os.IsNotExist(err) {
+		return nil
+	}
+
+	codeMap, err := NewJSONStore(jsonFile).Load()
+	if err != nil {
+		return fmt.Errorf("failed to read %s for import: %v", jsonFile, err)
+	}
+	if err := store.SaveAll(codeMap); err != nil {
+		return fmt.Errorf("failed to import %s: %v", jsonFile, err)
+	}
+
+	history, err := NewJSONStore(jsonFile).LoadHistory()
+	if err != nil {
+		log.Printf("Warning: Failed to read change history for import: %v", err)
+	}
+	for _, change := range history {
+		if err := store.AppendChange(change, maxHistory); err != nil {
+			return fmt.Errorf("failed to import change %d: %v", change.ID, err)
+		}
+	}
+
+	log.Printf("Imported %d codes from %s into %s", len(codeMap), jsonFile, store.Location())
+	return nil
+}
@@ -0,0 +1,190 @@
+package giflist
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"theListBot/internal/linkcheck"
+	"time"
+)
+
+func TestSQLiteStoreRoundTrip(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "giflist_sqlite_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.Setenv("GIFLIST_CONFIG_PATH", tempDir)
+	defer os.Unsetenv("GIFLIST_CONFIG_PATH")
+	os.Setenv("GIFLIST_STORAGE", "sqlite")
+	defer os.Unsetenv("GIFLIST_STORAGE")
+
+	list := NewGifList()
+	list.AddGif("s1", "https://sqlite1.gif")
+	list.AddGifBy("s1", "https://sqlite2.gif", "42")
+	list.SetTags("s1", "https://sqlite2.gif", []string{"wave"}, "")
+	list.AddGif("s2", "https://sqlite3.gif")
+	list.RemoveGif("s1", "https://sqlite1.gif")
+	list.RemoveCode("gg")
+	list.RecordLinkChecks([]linkcheck.Result{{URL: "https://sqlite3.gif", Status: 404, Error: "404 Not Found", CheckedAt: time.Now()}})
+	list.Close()
+
+	if _, err := os.Stat(filepath.Join(tempDir, "gifcodes.db")); err != nil {
+		t.Fatalf("Expected a SQLite database to be created: %v", err)
+	}
+
+	reloaded := NewGifList()
+	defer reloaded.Close()
+
+	urls, found := reloaded.GetAllGifsForCode("s1")
+	if !found || len(urls) != 1 || urls[0] != "https://sqlite2.gif" {
+		t.Errorf("Unexpected URLs for s1 after reload: %v", urls)
+	}
+	if gifs, _ := reloaded.GetGifDetails("s1"); gifs[0].AddedBy != "42" || gifs[0].AddedAt.IsZero() || len(gifs[0].Tags) != 1 {
+		t.Errorf("Metadata for s1 was not kept: %+v", gifs[0])
+	}
+	if gifs, _ := reloaded.GetGifDetails("s2"); gifs[0].Failures != 1 || gifs[0].CheckStatus != 404 || gifs[0].CheckedAt.IsZero() {
+		t.Errorf("Link check results for s2 were not kept: %+v", gifs[0])
+	}
+	if _, found := reloaded.GetAllGifsForCode("gg"); found {
+		t.Error("Removed code gg should not come back after reload")
+	}
+	if _, found := reloaded.GetAllGifsForCode("ty"); !found {
+		t.Error("Seeded code ty should be kept")
+	}
+	if changes := reloaded.History("s1", 10); len(changes) != 4 || changes[0].Action != ActionRemove {
+		t.Errorf("Expected 4 recorded changes to s1, newest a removal, got %+v", changes)
+	}
+}
+
+func TestSQLiteStoreImportsExistingJSON(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "giflist_import_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	jsonStore := NewJSONStore(filepath.Join(tempDir, jsonFileName))
+	if err := jsonStore.SaveAll(map[string]*Code{"im": {Gifs: []Gif{{URL: "https://imported.gif"}}}}); err != nil {
+		t.Fatalf("Failed to write JSON store: %v", err)
+	}
+
+	os.Setenv("GIFLIST_STORAGE", "sqlite")
+	defer os.Unsetenv("GIFLIST_STORAGE")
+
+	store, err := OpenStore(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+
+	codeMap, err := store.Load()
+	if err != nil {
+		t.Fatalf("Failed to load imported data: %v", err)
+	}
+	if len(codeMap) != 1 || codeMap["im"] == nil || len(codeMap["im"].Gifs) != 1 {
+		t.Errorf("Expected the JSON list to be imported, got %v", codeMap)
+	}
+}
+
+func TestSQLiteStoreMigratesUnversionedSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), sqliteFileName)
+
+	// Create a database with the original schema and no version
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_, err = db.Exec(sqliteMigrations[0])
+	if err == nil {
+		_, err = db.Exec(`INSERT INTO gifs (code, position, url) VALUES ('old', 0, 'https://old.gif')`)
+	}
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to set up old schema: %v", err)
+	}
+
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	defer store.Close()
+
+	codeMap, err := store.Load()
+	if err != nil {
+		t.Fatalf("Failed to load migrated database: %v", err)
+	}
+	old := codeMap["old"]
+	if old == nil || len(old.Gifs) != 1 || old.Gifs[0].URL != "https://old.gif" || old.EffectiveMode() != ModeRandom {
+		t.Errorf("Unexpected rows after migration: %v", codeMap)
+	}
+}
+
+func TestSQLiteStoreMigrationsAreAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), sqliteFileName)
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	store.Close()
+
+	// A step that fails halfway must leave neither its first statement nor
+	// the version bump behind
+	migrations := sqliteMigrations
+	t.Cleanup(func() { sqliteMigrations = migrations })
+	sqliteMigrations = append(slices.Clone(migrations),
+		`ALTER TABLE gifs ADD COLUMN extra TEXT NOT NULL DEFAULT '';
+		 ALTER TABLE missing ADD COLUMN extra TEXT`)
+
+	if _, err := NewSQLiteStore(path); err == nil {
+		t.Fatal("Expected the broken migration to fail")
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	var version, extra int
+	db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('gifs') WHERE name = 'extra'`).Scan(&extra)
+	if version != len(migrations) || extra != 0 {
+		t.Errorf("Expected the failed step to be rolled back, got version %d and %d extra columns", version, extra)
+	}
+}
+
+func TestSQLiteStoreDetectsOutsideChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), sqliteFileName)
+
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+
+	store.SaveAll(map[string]*Code{"s1": {Gifs: []Gif{{URL: "https://sqlite1.gif"}}}})
+	if _, err := store.Load(); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	store.PutCode("s2", &Code{Gifs: []Gif{{URL: "https://sqlite2.gif"}}})
+	if store.ChangedExternally() {
+		t.Error("The store's own writes should not count as outside changes")
+	}
+
+	// Another connection, like the sqlite3 shell, edits the database
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`DELETE FROM gifs WHERE code = 's1'`); err != nil {
+		t.Fatalf("Failed to edit database: %v", err)
+	}
+
+	if !store.ChangedExternally() {
+		t.Error("Expected a commit from another connection to be detected")
+	}
+}
@@ -0,0 +1,347 @@
+package giflist
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ImportStrategy decides what happens to codes that exist on both sides
+type ImportStrategy string
+
+// Supported import strategies
+const (
+	// ImportMerge adds imported URLs to existing codes and creates new codes
+	ImportMerge ImportStrategy = "merge"
+	// ImportReplace makes the list exactly match the imported file
+	ImportReplace ImportStrategy = "replace"
+	// ImportSkipExisting only creates codes that don't exist yet
+	ImportSkipExisting ImportStrategy = "skip-existing"
+)
+
+// ParseImportStrategy converts user input into an ImportStrategy
+func ParseImportStrategy(value string) (ImportStrategy, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "merge":
+		return ImportMerge, nil
+	case "replace":
+		return ImportReplace, nil
+	case "skip-existing", "skip", "skipexisting":
+		return ImportSkipExisting, nil
+	}
+	return "", fmt.Errorf("unknown strategy %q, use one of: merge, replace, skip-existing", value)
+}
+
+// ImportItem is one GIF or alias affected by an import
+type ImportItem struct {
+	Code    string
+	URL     string // Empty for aliases and whole-code entries
+	AliasOf string // Set for aliases
+	Reason  string // Why the item was skipped
+}
+
+// ImportReport lists what an import changed, or would change for a dry run
+type ImportReport struct {
+	Strategy ImportStrategy
+	DryRun   bool
+	Added    []ImportItem
+	Removed  []ImportItem
+	Skipped  []ImportItem
+}
+
+// Export serializes the whole list in the same format as gifcodes.json
+func (g *GifList) Export() ([]byte, error) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	data, err := json.MarshalIndent(g.codeMap, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize code mappings: %v", err)
+	}
+	return data, nil
+}
+
+// ParseImport reads an exported list, accepting every format gifcodes.json
+// has ever had
+func ParseImport(data []byte) (map[string]*Code, error) {
+	return decodeCodeMap(data)
+}
+
+// Import applies an imported list using the given strategy. Every code and
+// URL goes through the same validation as AddGif, and added GIFs are
+// mirrored like added ones. With dryRun set nothing is changed and the
+// report previews the result.
+func (g *GifList) Import(imported map[string]*Code, strategy ImportStrategy, dryRun bool, by string) ImportReport {
+	g.mutex.Lock()
+	report := g.importLocked(imported, strategy, dryRun, by)
+	g.mutex.Unlock()
+
+	if !dryRun {
+		for _, item := range report.Added {
+			if item.URL != "" {
+				g.mirrorGif(item.URL)
+			}
+		}
+	}
+	return report
+}
+
+// importLocked does the work of Import. Callers must hold the write lock.
+func (g *GifList) importLocked(imported map[string]*Code, strategy ImportStrategy, dryRun bool, by string) ImportReport {
+	g.syncLocked()
+
+	report := ImportReport{Strategy: strategy, DryRun: dryRun}
+	next := copyCodeMap(g.codeMap)
+
+	sorted := make([]string, 0, len(imported))
+	for name := range imported {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	// Only codes that pass the policy count as imported, so replace removes
+	// the local copy of a code whose imported version was rejected. Codes
+	// are case-insensitive, so of names differing only in case the first
+	// one wins.
+	names := make([]string, 0, len(sorted))
+	importedNames := make(map[string]bool, len(sorted))
+	for _, name := range sorted {
+		code := strings.ToLower(name)
+		if imported[name] == nil {
+			continue
+		}
+		if err := g.policy.Validate(code); err != nil {
+			report.Skipped = append(report.Skipped, ImportItem{Code: code, Reason: err.Error()})
+			continue
+		}
+		if importedNames[code] {
+			report.Skipped = append(report.Skipped, ImportItem{Code: name, Reason: "another entry has the same code in different case"})
+			continue
+		}
+		names = append(names, name)
+		importedNames[code] = true
+	}
+
+	// Replace starts by dropping every code the file doesn't have
+	if strategy == ImportReplace {
+		existing := make([]string, 0, len(next))
+		for name := range next {
+			existing = append(existing, name)
+		}
+		sort.Strings(existing)
+		for _, name := range existing {
+			if !importedNames[name] {
+				report.Removed = append(report.Removed, itemsFor(name, next[name])...)
+				delete(next, name)
+			}
+		}
+	}
+
+	// Real codes first so aliases can point at codes created by this import
+	var aliases []string
+	for _, name := range names {
+		code := strings.ToLower(name)
+		in := imported[name]
+		if in.AliasOf != "" {
+			// An alias has no pool of its own, so GIFs listed with it are dropped
+			for _, gif := range in.Gifs {
+				report.Skipped = append(report.Skipped, ImportItem{Code: code, URL: gif.URL, Reason: "entry is an alias, its GIFs are ignored"})
+			}
+			aliases = append(aliases, name)
+			continue
+		}
+
+		current, exists := next[code]
+		if exists && strategy == ImportSkipExisting {
+			report.Skipped = append(report.Skipped, ImportItem{Code: code, Reason: "code already exists"})
+			continue
+		}
+		if exists && current.AliasOf != "" && strategy == ImportMerge {
+			report.Skipped = append(report.Skipped, ImportItem{Code: code, Reason: "code is an alias here"})
+			continue
+		}
+
+		target := &Code{Mode: importMode(in.Mode)}
+		if exists && strategy == ImportMerge {
+			target = current
+		}
+
+		valid := make([]Gif, 0, len(in.Gifs))
+		for _, gif := range in.Gifs {
+			if err := validateURL(gif.URL); err != nil {
+				report.Skipped = append(report.Skipped, ImportItem{Code: code, URL: gif.URL, Reason: err.Error()})
+				continue
+			}
+			if indexOfURL(valid, gif.URL) >= 0 {
+				continue
+			}
+			valid = append(valid, importGif(gif, by))
+		}
+
+		if strategy == ImportMerge {
+			for _, gif := range valid {
+				if indexOfURL(target.Gifs, gif.URL) < 0 {
+					target.Gifs = append(target.Gifs, gif)
+					report.Added = append(report.Added, ImportItem{Code: code, URL: gif.URL})
+				}
+			}
+		} else {
+			// Replace or a brand new code: the imported GIFs are the whole pool
+			var old []Gif
+			if exists {
+				old = current.Gifs
+			}
+			for _, gif := range old {
+				if indexOfURL(valid, gif.URL) < 0 {
+					report.Removed = append(report.Removed, ImportItem{Code: code, URL: gif.URL})
+				}
+			}
+			for _, gif := range valid {
+				if indexOfURL(old, gif.URL) < 0 {
+					report.Added = append(report.Added, ImportItem{Code: code, URL: gif.URL})
+				}
+			}
+			target.Gifs = valid
+		}
+
+		if len(target.Gifs) == 0 {
+			delete(next, code)
+		} else {
+			next[code] = target
+		}
+	}
+
+	for _, name := range aliases {
+		code := strings.ToLower(name)
+		aliasOf := strings.ToLower(imported[name].AliasOf)
+		current, exists := next[code]
+
+		switch {
+		case exists && strategy == ImportSkipExisting:
+			report.Skipped = append(report.Skipped, ImportItem{Code: code, AliasOf: aliasOf, Reason: "code already exists"})
+			continue
+		case exists && current.AliasOf == "" && len(current.Gifs) > 0 && strategy == ImportMerge:
+			report.Skipped = append(report.Skipped, ImportItem{Code: code, AliasOf: aliasOf, Reason: "code has its own GIFs here"})
+			continue
+		case exists && current.AliasOf == aliasOf:
+			continue
+		}
+
+		// Check the alias against the list as it will be after the import
+		previous := next[code]
+		next[code] = &Code{AliasOf: aliasOf}
+		if _, _, ok := resolveIn(next, code); !ok {
+			if previous != nil {
+				next[code] = previous
+			} else {
+				delete(next, code)
+			}
+			report.Skipped = append(report.Skipped, ImportItem{Code: code, AliasOf: aliasOf, Reason: "alias target missing or loops"})
+			continue
+		}
+		if previous != nil {
+			report.Removed = append(report.Removed, itemsFor(code, previous)...)
+		}
+		report.Added = append(report.Added, ImportItem{Code: code, AliasOf: aliasOf})
+	}
+
+	// Drop aliases left pointing at codes the import removed
+	for changed := true; changed; {
+		changed = false
+		for name, c := range next {
+			if c.AliasOf == "" {
+				continue
+			}
+			if _, _, ok := resolveIn(next, name); !ok {
+				report.Removed = append(report.Removed, itemsFor(name, c)...)
+				delete(next, name)
+				changed = true
+			}
+		}
+	}
+
+	if dryRun {
+		return report
+	}
+
+	// Commit every code that changed so each one is in the history and revertible
+	touched := make(map[string]bool)
+	for name := range g.codeMap {
+		touched[name] = true
+	}
+	for name := range next {
+		touched[name] = true
+	}
+	changed := make([]string, 0, len(touched))
+	for name := range touched {
+		changed = append(changed, name)
+	}
+	sort.Strings(changed)
+	for _, name := range changed {
+		before, after := g.codeMap[name], next[name]
+		if sameContent(before, after) {
+			continue
+		}
+
+		snapshot := g.snapshotLocked(name)
+		if after == nil {
+			delete(g.codeMap, name)
+		} else {
+			g.codeMap[name] = after
+		}
+		g.resetSelection(name)
+		g.commitChange(name, ActionImport, by, string(strategy), snapshot)
+	}
+
+	log.Printf("Imported list with %s strategy: %d added, %d removed, %d skipped",
+		strategy, len(report.Added), len(report.Removed), len(report.Skipped))
+	return report
+}
+
+// itemsFor lists a code's contents as import items
+func itemsFor(name string, c *Code) []ImportItem {
+	if c.AliasOf != "" {
+		return []ImportItem{{Code: name, AliasOf: c.AliasOf}}
+	}
+	items := make([]ImportItem, 0, len(c.Gifs))
+	for _, gif := range c.Gifs {
+		items = append(items, ImportItem{Code: name, URL: gif.URL})
+	}
+	return items
+}
+
+// importGif keeps what describes an imported GIF and drops the state the
+// exporting bot gathered. Its pick counts, link checks and mirror path are
+// about another bot's history and disk, and old failures could get the GIF
+// treated as dead here before it was ever checked.
+func importGif(gif Gif, by string) Gif {
+	imported := Gif{
+		URL:     gif.URL,
+		AddedBy: gif.AddedBy,
+		AddedAt: gif.AddedAt,
+		Tags:    append([]string(nil), gif.Tags...),
+	}
+	if gif.Weight >= DefaultWeight && gif.Weight <= MaxWeight {
+		imported.Weight = gif.Weight
+	}
+	if imported.AddedAt.IsZero() {
+		imported.AddedAt = time.Now()
+		imported.AddedBy = by
+	}
+	return imported
+}
+
+// importMode keeps a known selection mode from an imported file
+func importMode(mode SelectionMode) SelectionMode {
+	if mode == "" {
+		return ""
+	}
+	parsed, err := ParseSelectionMode(string(mode))
+	if err != nil {
+		return ""
+	}
+	return parsed
+}
@@ -0,0 +1,250 @@
+package giflist
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Default code policy: short codes of letters, digits and dots, so that
+// codes look like the shorthand people already type in chat
+const (
+	defaultMinCodeLength = 1
+	defaultMaxCodeLength = 10
+	defaultCodeSymbols   = "."
+)
+
+// defaultReservedCodes are words the bot uses for its own commands
+var defaultReservedCodes = []string{"list", "counts", "help"}
+
+// Policy decides which codes can be added and which messages trigger a code.
+// Adding and matching share one policy so every code that can be added can
+// also be triggered.
+type Policy struct {
+	MinLength int
+	MaxLength int
+	Letters   bool     // Allow ASCII letters
+	Digits    bool     // Allow digits
+	Symbols   string   // Other characters allowed in codes
+	Reserved  []string // Codes that can't be used
+	Blocklist []string // Words no code may contain
+}
+
+// DefaultPolicy returns the policy used when nothing is configured
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength: defaultMinCodeLength,
+		MaxLength: defaultMaxCodeLength,
+		Letters:   true,
+		Digits:    true,
+		Symbols:   defaultCodeSymbols,
+		Reserved:  slices.Clone(defaultReservedCodes),
+	}
+}
+
+// PolicyFromEnv returns the default policy adjusted by the GIFLIST_CODE_*
+// environment variables
+func PolicyFromEnv() Policy {
+	p := DefaultPolicy()
+
+	p.MinLength = envInt("GIFLIST_CODE_MIN_LENGTH", p.MinLength)
+	p.MaxLength = envInt("GIFLIST_CODE_MAX_LENGTH", p.MaxLength)
+	if p.MinLength < 1 {
+		p.MinLength = 1
+	}
+	if p.MaxLength < p.MinLength {
+		log.Printf("GIFLIST_CODE_MAX_LENGTH is below the minimum length, using %d", p.MinLength)
+		p.MaxLength = p.MinLength
+	}
+
+	// A comma separated list of "letters", "digits" and symbol characters
+	if value, ok := os.LookupEnv("GIFLIST_CODE_CHARS"); ok {
+		p.Letters, p.Digits, p.Symbols = false, false, ""
+		for _, class := range strings.Split(value, ",") {
+			switch class = strings.TrimSpace(class); class {
+			case "letters":
+				p.Letters = true
+			case "digits":
+				p.Digits = true
+			default:
+				p.Symbols += class
+			}
+		}
+	}
+
+	if value, ok := os.LookupEnv("GIFLIST_CODE_RESERVED"); ok {
+		p.Reserved = splitWords(value)
+	}
+	p.Blocklist = splitWords(os.Getenv("GIFLIST_CODE_BLOCKLIST"))
+	if path := os.Getenv("GIFLIST_CODE_BLOCKLIST_FILE"); path != "" {
+		words, err := readWordList(path)
+		if err != nil {
+			log.Printf("Warning: Failed to read code blocklist %s: %v", path, err)
+		}
+		p.Blocklist = append(p.Blocklist, words...)
+	}
+
+	return p
+}
+
+// Validate checks that a code can be added, explaining what's wrong if not
+func (p Policy) Validate(code string) error {
+	length := len([]rune(code))
+	if length < p.MinLength || length > p.MaxLength {
+		if p.MinLength == p.MaxLength {
+			return fmt.Errorf("codes must be exactly %d characters long, `%s` has %d", p.MaxLength, code, length)
+		}
+		return fmt.Errorf("codes must be %d to %d characters long, `%s` has %d", p.MinLength, p.MaxLength, code, length)
+	}
+
+	for _, ch := range code {
+		if !p.allows(ch) {
+			return fmt.Errorf("codes can only contain %s, `%s` has %q", p.describeChars(), code, ch)
+		}
+	}
+
+	lower := strings.ToLower(code)
+	if slices.Contains(p.Reserved, lower) {
+		return fmt.Errorf("`%s` is reserved for the bot's own commands", code)
+	}
+	for _, word := range p.Blocklist {
+		if strings.Contains(lower, word) {
+			log.Printf("Rejected blocklisted code: %s", code)
+			return fmt.Errorf("`%s` isn't allowed as a code", code)
+		}
+	}
+	return nil
+}
+
+// Match returns the code a message triggers. Only a message consisting of
+// nothing but a valid code triggers it.
+func (p Policy) Match(message string) (string, bool) {
+	code := strings.ToLower(message)
+	if p.Validate(code) != nil {
+		return "", false
+	}
+	return code, true
+}
+
+// allows reports whether ch may appear in a code
+func (p Policy) allows(ch rune) bool {
+	switch {
+	case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z':
+		return p.Letters
+	case ch >= '0' && ch <= '9':
+		return p.Digits
+	}
+	return strings.ContainsRune(p.Symbols, ch)
+}
+
+// describeChars lists the allowed characters for error messages
+func (p Policy) describeChars() string {
+	var classes []string
+	if p.Letters {
+		classes = append(classes, "letters")
+	}
+	if p.Digits {
+		classes = append(classes, "numbers")
+	}
+	for _, ch := range p.Symbols {
+		classes = append(classes, "`"+string(ch)+"`")
+	}
+
+	switch len(classes) {
+	case 0:
+		return "nothing"
+	case 1:
+		return classes[0]
+	}
+	return strings.Join(classes[:len(classes)-1], ", ") + " and " + classes[len(classes)-1]
+}
+
+// SetPolicy replaces the code policy of the list
+func (g *GifList) SetPolicy(p Policy) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.policy = p
+}
+
+// Policy returns the code policy of the list
+func (g *GifList) Policy() Policy {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return g.policy
+}
+
+// MatchCode returns the code a chat message triggers, if any
+func (g *GifList) MatchCode(message string) (string, bool) {
+	return g.Policy().Match(message)
+}
+
+// validateCode checks that a code can be stored under the list's policy
+func (g *GifList) validateCode(code string) error {
+	if err := g.Policy().Validate(code); err != nil {
+		log.Printf("Rejected invalid code %q: %v", code, err)
+		return err
+	}
+	return nil
+}
+
+// validateURL checks that a GIF URL is an absolute http(s) link
+func validateURL(gifURL string) error {
+	parsed, err := url.Parse(gifURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		log.Printf("Rejected invalid URL: %s", gifURL)
+		return fmt.Errorf("URL must be a full http or https link")
+	}
+	return nil
+}
+
+// envInt reads a positive integer from the environment
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("Invalid %s %q, using %d", name, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// splitWords parses a comma separated list into lowercase words
+func splitWords(value string) []string {
+	var words []string
+	for _, word := range strings.Split(value, ",") {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// readWordList reads one lowercase word per line, skipping blank lines and
+// lines starting with #
+func readWordList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	return words, scanner.Err()
+}
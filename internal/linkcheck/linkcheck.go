@@ -0,0 +1,141 @@
+// Package linkcheck probes URLs to find links that have stopped working
+package linkcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"theListBot/internal/publicnet"
+	"time"
+)
+
+// Defaults for the checker and the background schedule
+const (
+	defaultConcurrency = 4
+	defaultTimeout     = 10 * time.Second
+	defaultInterval    = 6 * time.Hour
+)
+
+// maxBodyRead is how much of a GET response is read before giving up on
+// the body, enough to know the host is really serving something
+const maxBodyRead = 512
+
+// Result is the outcome of probing one URL
+type Result struct {
+	URL       string
+	OK        bool
+	Status    int    // HTTP status, 0 if there was no response
+	Error     string // Why the probe failed, empty when OK
+	CheckedAt time.Time
+}
+
+// Checker probes URLs with a HEAD request, falling back to GET for hosts
+// that don't answer HEAD properly
+type Checker struct {
+	Client      *http.Client  // Only connects to public addresses unless replaced
+	Concurrency int           // How many URLs are probed at once
+	Timeout     time.Duration // Limit for each probe, including the GET fallback
+}
+
+// NewChecker returns a Checker with the default limits. Its client only
+// connects to public addresses, since the URLs come from users and the
+// results are shown back in chat.
+func NewChecker() *Checker {
+	return &Checker{
+		Client:      publicnet.Client(0),
+		Concurrency: defaultConcurrency,
+		Timeout:     defaultTimeout,
+	}
+}
+
+// Interval returns how often the background checker runs, or 0 if
+// GIFLIST_LINK_CHECK_INTERVAL turns it off
+func Interval() time.Duration {
+	value := os.Getenv("GIFLIST_LINK_CHECK_INTERVAL")
+	switch value {
+	case "":
+		return defaultInterval
+	case "0", "off":
+		return 0
+	}
+	if interval, err := time.ParseDuration(value); err == nil && interval >= 0 {
+		return interval
+	}
+	log.Printf("Invalid GIFLIST_LINK_CHECK_INTERVAL %q, using %s", value, defaultInterval)
+	return defaultInterval
+}
+
+// Check probes a single URL
+func (c *Checker) Check(ctx context.Context, url string) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	result := c.probe(ctx, http.MethodHead, url)
+	if !result.OK && ctx.Err() == nil {
+		// Plenty of hosts reject or mishandle HEAD, only trust a GET failure
+		result = c.probe(ctx, http.MethodGet, url)
+	}
+	result.CheckedAt = time.Now()
+	return result
+}
+
+// CheckAll probes every URL, at most Concurrency at a time, and returns the
+// results in the same order as urls
+func (c *Checker) CheckAll(ctx context.Context, urls []string) []Result {
+	results := make([]Result, len(urls))
+
+	concurrency := c.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, url string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = c.Check(ctx, url)
+		}(i, url)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// probe makes one request and reports whether it succeeded
+func (c *Checker) probe(ctx context.Context, method string, url string) Result {
+	result := Result{URL: url}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		result.Error = fmt.Sprintf("invalid URL: %v", err)
+		return result
+	}
+	req.Header.Set("User-Agent", "theListBot link checker")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	if method == http.MethodGet {
+		io.CopyN(io.Discard, resp.Body, maxBodyRead)
+	}
+
+	result.Status = resp.StatusCode
+	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
+		result.OK = true
+	} else {
+		result.Error = resp.Status
+	}
+	return result
+}
@@ -0,0 +1,116 @@
+package linkcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckStatuses(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok.gif", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/no-head.gif", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Write([]byte("GIF89a"))
+	})
+	mux.HandleFunc("/moved.gif", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok.gif", http.StatusFound)
+	})
+	mux.HandleFunc("/slow.gif", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// The test server is on loopback, which the default client refuses
+	checker := NewChecker()
+	checker.Client = server.Client()
+	checker.Timeout = 200 * time.Millisecond
+
+	tests := []struct {
+		path   string
+		ok     bool
+		status int
+	}{
+		{"/ok.gif", true, http.StatusOK},
+		{"/no-head.gif", true, http.StatusOK},
+		{"/moved.gif", true, http.StatusOK},
+		{"/missing.gif", false, http.StatusNotFound},
+		{"/slow.gif", false, 0},
+	}
+	for _, test := range tests {
+		result := checker.Check(context.Background(), server.URL+test.path)
+		if result.OK != test.ok || result.Status != test.status {
+			t.Errorf("%s: expected ok=%v status=%d, got %+v", test.path, test.ok, test.status, result)
+		}
+		if !result.OK && result.Error == "" {
+			t.Errorf("%s: failed check should explain why", test.path)
+		}
+		if result.CheckedAt.IsZero() {
+			t.Errorf("%s: check time not recorded", test.path)
+		}
+	}
+}
+
+func TestCheckRefusesPrivateAddresses(t *testing.T) {
+	var contacted atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contacted.Store(true)
+	}))
+	defer server.Close()
+
+	result := NewChecker().Check(context.Background(), server.URL+"/secret.gif")
+	if result.OK || !strings.Contains(result.Error, "non-public address") {
+		t.Errorf("Expected a loopback URL to be refused, got %+v", result)
+	}
+	if contacted.Load() {
+		t.Error("The loopback server should never have been contacted")
+	}
+}
+
+func TestCheckAllBoundsConcurrency(t *testing.T) {
+	var active, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	checker := NewChecker()
+	checker.Client = server.Client()
+	checker.Concurrency = 2
+
+	urls := make([]string, 8)
+	for i := range urls {
+		urls[i] = server.URL + "/" + string(rune('a'+i)) + ".gif"
+	}
+
+	results := checker.CheckAll(context.Background(), urls)
+	for i, result := range results {
+		if result.URL != urls[i] || !result.OK {
+			t.Errorf("Unexpected result %d: %+v", i, result)
+		}
+	}
+	if peak > 2 {
+		t.Errorf("Expected at most 2 concurrent probes, saw %d", peak)
+	}
+}
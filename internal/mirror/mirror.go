@@ -0,0 +1,129 @@
+// Package mirror keeps local copies of GIFs so they can still be posted
+// after the original host deletes them
+package mirror
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"theListBot/internal/publicnet"
+	"theListBot/internal/safefile"
+	"time"
+)
+
+// MaxSize is the largest GIF the cache keeps. Anything bigger couldn't be
+// uploaded to Discord as an attachment anyway.
+const MaxSize = 10 << 20
+
+// Cache stores downloaded files by the SHA-256 of their contents, so a GIF
+// added under several codes or guilds is only stored once
+type Cache struct {
+	dir    string
+	Client *http.Client // Only connects to public addresses unless replaced
+}
+
+// Enabled reports whether GIFLIST_MIRROR turns the local mirror on
+func Enabled() bool {
+	switch strings.ToLower(os.Getenv("GIFLIST_MIRROR")) {
+	case "1", "true", "on", "yes":
+		return true
+	}
+	return false
+}
+
+// New creates a Cache that keeps its files in dir
+func New(dir string) *Cache {
+	return &Cache{
+		dir:    dir,
+		Client: publicnet.Client(time.Minute),
+	}
+}
+
+// Fetch downloads url into the cache and returns the hash it is stored under.
+// Only images and videos are kept.
+func (c *Cache) Fetch(url string) (string, error) {
+	resp, err := c.Client.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", url, err)
+	}
+	if len(data) > MaxSize {
+		return "", fmt.Errorf("%s is larger than %d bytes, not mirroring it", url, MaxSize)
+	}
+	if !isMedia(resp.Header.Get("Content-Type"), data) {
+		return "", fmt.Errorf("%s is not an image or video, not mirroring it", url)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if c.Has(hash) {
+		return hash, nil
+	}
+
+	path := c.path(hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create mirror directory: %v", err)
+	}
+	if err := safefile.WriteFile(path, data, 0644, 0); err != nil {
+		return "", fmt.Errorf("failed to store %s: %v", url, err)
+	}
+	return hash, nil
+}
+
+// isMedia reports whether a download is an image or video. Hosts that
+// don't say, or only say octet-stream, are judged by the contents instead.
+func isMedia(header string, data []byte) bool {
+	declared, _, _ := mime.ParseMediaType(header)
+	if declared == "" || declared == "application/octet-stream" {
+		declared, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+	return strings.HasPrefix(declared, "image/") || strings.HasPrefix(declared, "video/")
+}
+
+// Has reports whether a file with the given hash is in the cache
+func (c *Cache) Has(hash string) bool {
+	if !validHash(hash) {
+		return false
+	}
+	_, err := os.Stat(c.path(hash))
+	return err == nil
+}
+
+// Open returns the cached file with the given hash
+func (c *Cache) Open(hash string) (*os.File, error) {
+	if !validHash(hash) {
+		return nil, fmt.Errorf("invalid mirror hash %q", hash)
+	}
+	return os.Open(c.path(hash))
+}
+
+// path spreads files over subdirectories named after the first two hex
+// digits so no directory gets too large
+func (c *Cache) path(hash string) string {
+	return filepath.Join(c.dir, hash[:2], hash)
+}
+
+// validHash checks that hash is a hex SHA-256, which also keeps a damaged
+// gif list from pointing the cache outside its directory
+func validHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
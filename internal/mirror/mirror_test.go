@@ -0,0 +1,97 @@
+package mirror
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFetchStoresByContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a.gif", "/copy-of-a.gif":
+			w.Write([]byte("GIF89a-a"))
+		case "/huge.gif":
+			w.Header().Set("Content-Type", "image/gif")
+			w.Write(bytes.Repeat([]byte{'x'}, MaxSize+1))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cache := New(t.TempDir())
+	cache.Client = server.Client()
+
+	hash, err := cache.Fetch(server.URL + "/a.gif")
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	copyHash, err := cache.Fetch(server.URL + "/copy-of-a.gif")
+	if err != nil || copyHash != hash {
+		t.Errorf("Identical content should share a hash, got %s and %s (%v)", hash, copyHash, err)
+	}
+
+	file, err := cache.Open(hash)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	data, _ := io.ReadAll(file)
+	file.Close()
+	if string(data) != "GIF89a-a" {
+		t.Errorf("Unexpected cached contents %q", data)
+	}
+
+	if _, err := cache.Fetch(server.URL + "/missing.gif"); err == nil {
+		t.Error("Fetching a missing GIF should fail")
+	}
+	if _, err := cache.Fetch(server.URL + "/huge.gif"); err == nil {
+		t.Error("GIFs over MaxSize should not be mirrored")
+	}
+	if _, err := cache.Open("../../etc/passwd"); err == nil {
+		t.Error("Open should reject anything that isn't a hash")
+	}
+}
+
+func TestFetchRejectsPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("GIF89a-secret"))
+	}))
+	defer server.Close()
+
+	cache := New(t.TempDir())
+	if _, err := cache.Fetch(server.URL + "/a.gif"); err == nil || !strings.Contains(err.Error(), "non-public address") {
+		t.Errorf("Expected a loopback server to be refused, got %v", err)
+	}
+}
+
+func TestFetchRejectsNonMedia(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page.gif":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html>internal dashboard</html>"))
+		case "/unlabelled.gif":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte(`{"secret": true}`))
+		case "/clip.mp4":
+			w.Header().Set("Content-Type", "video/mp4")
+			w.Write([]byte("mp4 data"))
+		}
+	}))
+	defer server.Close()
+
+	cache := New(t.TempDir())
+	cache.Client = server.Client()
+	for _, path := range []string{"/page.gif", "/unlabelled.gif"} {
+		if _, err := cache.Fetch(server.URL + path); err == nil {
+			t.Errorf("Expected %s to be refused as not an image or video", path)
+		}
+	}
+	if _, err := cache.Fetch(server.URL + "/clip.mp4"); err != nil {
+		t.Errorf("Expected videos to be mirrored, got %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+// Package paginate splits long listings into pages that fit in a chat
+// message
+package paginate
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Discord limits
+const (
+	// MessageLimit is the most characters a plain message can hold
+	MessageLimit = 2000
+	// defaultPageChars keeps a page well inside an embed description
+	defaultPageChars = 1800
+	// defaultPageLines keeps a page short enough to read at a glance
+	defaultPageLines = 20
+)
+
+// SortOrder is how the items of a listing are ordered
+type SortOrder string
+
+// Supported sort orders
+const (
+	// SortNone keeps the items in the order they were given
+	SortNone SortOrder = ""
+	// SortName orders items alphabetically by key
+	SortName SortOrder = "name"
+	// SortUsage puts the most used items first
+	SortUsage SortOrder = "usage"
+)
+
+// ParseSortOrder converts user input into a SortOrder
+func ParseSortOrder(value string) (SortOrder, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "name", "alpha", "alphabetical", "az", "a-z":
+		return SortName, true
+	case "usage", "used", "popular", "count":
+		return SortUsage, true
+	}
+	return SortNone, false
+}
+
+// Describe returns a short label for the sort order
+func (s SortOrder) Describe() string {
+	switch s {
+	case SortName:
+		return "A-Z"
+	case SortUsage:
+		return "most used"
+	}
+	return ""
+}
+
+// Toggle returns the other sortable order
+func (s SortOrder) Toggle() SortOrder {
+	if s == SortName {
+		return SortUsage
+	}
+	return SortName
+}
+
+// Item is one line of a listing
+type Item struct {
+	Key   string // Sort key for SortName
+	Usage int    // Sort key for SortUsage
+	Line  string // What is shown
+}
+
+// Listing is a titled list of items to show a page at a time
+type Listing struct {
+	Title    string
+	Items    []Item
+	Sort     SortOrder
+	MaxLines int // Lines per page, defaultPageLines if 0
+	MaxChars int // Characters per page, defaultPageChars if 0
+}
+
+// Lines returns the item lines in the listing's sort order
+func (l Listing) Lines() []string {
+	items := make([]Item, len(l.Items))
+	copy(items, l.Items)
+
+	switch l.Sort {
+	case SortName:
+		sort.SliceStable(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	case SortUsage:
+		sort.SliceStable(items, func(i, j int) bool {
+			if items[i].Usage != items[j].Usage {
+				return items[i].Usage > items[j].Usage
+			}
+			return items[i].Key < items[j].Key
+		})
+	}
+
+	lines := make([]string, len(items))
+	for i, item := range items {
+		lines[i] = item.Line
+	}
+	return lines
+}
+
+// Pages splits the sorted lines into pages. There is always at least one
+// page, even for an empty listing.
+func (l Listing) Pages() [][]string {
+	maxLines, maxChars := l.MaxLines, l.MaxChars
+	if maxLines <= 0 {
+		maxLines = defaultPageLines
+	}
+	if maxChars <= 0 {
+		maxChars = defaultPageChars
+	}
+
+	pages := [][]string{nil}
+	chars := 0
+	for _, line := range l.Lines() {
+		line = truncate(line, maxChars)
+		current := pages[len(pages)-1]
+		if len(current) > 0 && (len(current) == maxLines || chars+len(line)+1 > maxChars) {
+			pages = append(pages, nil)
+			chars = 0
+		}
+		pages[len(pages)-1] = append(pages[len(pages)-1], line)
+		chars += len(line) + 1
+	}
+	return pages
+}
+
+// Messages renders the whole listing as plain messages of at most limit
+// characters each, for places that can't show paged embeds
+func (l Listing) Messages(limit int) []string {
+	var messages []string
+	current := "**" + l.Title + "**\n"
+	for _, line := range l.Lines() {
+		line = truncate(line, limit-1)
+		if len(current)+len(line)+1 > limit {
+			messages = append(messages, current)
+			current = ""
+		}
+		current += line + "\n"
+	}
+	return append(messages, current)
+}
+
+// truncate shortens a line to at most limit bytes without splitting a
+// character
+func truncate(line string, limit int) string {
+	if len(line) <= limit {
+		return line
+	}
+	const ellipsis = "…"
+	cut := limit - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut] + ellipsis
+}
@@ -0,0 +1,83 @@
+package paginate
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestListingSortsItems(t *testing.T) {
+	listing := Listing{Items: []Item{
+		{Key: "ty", Usage: 5, Line: "ty"},
+		{Key: "gg", Usage: 9, Line: "gg"},
+		{Key: "lol", Usage: 5, Line: "lol"},
+	}}
+
+	if lines := listing.Lines(); !slices.Equal(lines, []string{"ty", "gg", "lol"}) {
+		t.Errorf("SortNone should keep the given order, got %v", lines)
+	}
+	listing.Sort = SortName
+	if lines := listing.Lines(); !slices.Equal(lines, []string{"gg", "lol", "ty"}) {
+		t.Errorf("Unexpected alphabetical order %v", lines)
+	}
+	listing.Sort = SortUsage
+	if lines := listing.Lines(); !slices.Equal(lines, []string{"gg", "lol", "ty"}) {
+		t.Errorf("Unexpected usage order %v", lines)
+	}
+	if listing.Sort.Toggle() != SortName || SortName.Toggle() != SortUsage {
+		t.Error("Toggle should switch between name and usage")
+	}
+}
+
+func TestPagesRespectLimits(t *testing.T) {
+	listing := Listing{MaxLines: 3, MaxChars: 50}
+	for i := 0; i < 7; i++ {
+		listing.Items = append(listing.Items, Item{Line: fmt.Sprintf("line %d", i)})
+	}
+
+	pages := listing.Pages()
+	if len(pages) != 3 || len(pages[0]) != 3 || len(pages[2]) != 1 {
+		t.Fatalf("Expected pages of 3, 3 and 1 lines, got %v", pages)
+	}
+
+	// Long lines are split by size and truncated to fit a page
+	listing = Listing{MaxChars: 30, Items: []Item{
+		{Line: strings.Repeat("a", 20)},
+		{Line: strings.Repeat("b", 20)},
+		{Line: strings.Repeat("é", 40)},
+	}}
+	pages = listing.Pages()
+	if len(pages) != 3 {
+		t.Fatalf("Expected each long line on its own page, got %d pages", len(pages))
+	}
+	if last := pages[2][0]; len(last) > 30 || !strings.HasSuffix(last, "…") {
+		t.Errorf("Expected the oversized line to be truncated, got %q (%d bytes)", last, len(last))
+	}
+
+	if pages := (Listing{}).Pages(); len(pages) != 1 {
+		t.Errorf("An empty listing should still have one page, got %d", len(pages))
+	}
+}
+
+func TestMessagesFitLimit(t *testing.T) {
+	listing := Listing{Title: "Codes"}
+	for i := 0; i < 300; i++ {
+		listing.Items = append(listing.Items, Item{Line: fmt.Sprintf("`code%d` (3 GIFs)", i)})
+	}
+
+	messages := listing.Messages(MessageLimit)
+	if len(messages) < 2 {
+		t.Fatalf("Expected the listing to need several messages, got %d", len(messages))
+	}
+	total := 0
+	for _, message := range messages {
+		if len(message) > MessageLimit {
+			t.Errorf("Message of %d characters is over the limit", len(message))
+		}
+		total += strings.Count(message, "`code")
+	}
+	if total != 300 {
+		t.Errorf("Expected every item across the messages, got %d", total)
+	}
+}
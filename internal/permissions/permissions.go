@@ -0,0 +1,191 @@
+// Package permissions decides which members may use which list commands.
+// Each capability is held by everyone, by listed users and roles, or by
+// anyone with one of the listed Discord permissions.
+package permissions
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Capability is a group of commands that is granted as a whole
+type Capability string
+
+// Supported capabilities
+const (
+	// Add covers adding GIFs and editing their tags, weights, modes and aliases
+	Add Capability = "add"
+	// Remove covers removing single GIFs from a code
+	Remove Capability = "remove"
+	// RemoveCode covers removing whole codes and reverting changes
+	RemoveCode Capability = "remove-code"
+	// Import covers loading a list from a file
+	Import Capability = "import"
+	// Review covers approving and rejecting submissions, and adding without review
+	Review Capability = "review"
+	// Admin covers bot settings, and implies every other capability
+	Admin Capability = "admin"
+)
+
+// Capabilities lists every capability, for help text and listings
+var Capabilities = []Capability{Add, Remove, RemoveCode, Import, Review, Admin}
+
+// ParseCapability converts user input into a Capability
+func ParseCapability(value string) (Capability, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, c := range Capabilities {
+		if string(c) == value {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("unknown capability %q, use one of: add, remove, remove-code, import, review, admin", value)
+}
+
+// Permissions are the Discord permissions that can be named in a grant
+var Permissions = map[string]int64{
+	"manage-messages": discordgo.PermissionManageMessages,
+	"manage-server":   discordgo.PermissionManageServer,
+	"manage-roles":    discordgo.PermissionManageRoles,
+	"administrator":   discordgo.PermissionAdministrator,
+}
+
+// Rule says who holds a capability
+type Rule struct {
+	Everyone    bool     `json:"everyone,omitempty"`
+	Users       []string `json:"users,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions int64    `json:"permissions,omitempty"` // Any of these Discord permissions grants the capability
+}
+
+// DefaultRule is used for capabilities a guild hasn't configured: everyone
+// can add GIFs, moderators with Manage Messages can do the rest
+func DefaultRule(c Capability) Rule {
+	if c == Add {
+		return Rule{Everyone: true}
+	}
+	return Rule{Permissions: discordgo.PermissionManageMessages}
+}
+
+// Member is who is asking, as far as permissions are concerned
+type Member struct {
+	UserID      string
+	Roles       []string
+	Permissions int64 // Discord permissions in the channel, zero in direct messages
+}
+
+// allows reports whether a rule grants its capability to a member
+func (r Rule) allows(m Member) bool {
+	if r.Everyone || slices.Contains(r.Users, m.UserID) || r.Permissions&m.Permissions != 0 {
+		return true
+	}
+	for _, role := range m.Roles {
+		if slices.Contains(r.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed reports whether a member holds a capability under a guild's
+// rules. Server administrators always do, so a guild can't lock itself out.
+func Allowed(rules func(Capability) Rule, m Member, c Capability) bool {
+	if m.Permissions&discordgo.PermissionAdministrator != 0 {
+		return true
+	}
+	return rules(c).allows(m) || (c != Admin && rules(Admin).allows(m))
+}
+
+// Grantee is someone a capability can be granted to
+type Grantee struct {
+	Everyone   bool
+	User       string
+	Role       string
+	Permission string // Key of Permissions
+}
+
+// ParseGrantee accepts a user or role mention, "everyone", or a permission
+// name like manage-messages
+func ParseGrantee(value string) (Grantee, error) {
+	switch {
+	case value == "everyone" || value == "@everyone":
+		return Grantee{Everyone: true}, nil
+	case strings.HasPrefix(value, "<@&") && strings.HasSuffix(value, ">"):
+		return Grantee{Role: strings.TrimSuffix(strings.TrimPrefix(value, "<@&"), ">")}, nil
+	case strings.HasPrefix(value, "<@") && strings.HasSuffix(value, ">"):
+		return Grantee{User: strings.TrimPrefix(strings.TrimSuffix(strings.TrimPrefix(value, "<@"), ">"), "!")}, nil
+	}
+	if _, ok := Permissions[strings.ToLower(value)]; ok {
+		return Grantee{Permission: strings.ToLower(value)}, nil
+	}
+	return Grantee{}, fmt.Errorf("can't grant to %q, mention a user or role, or use everyone or one of: %s",
+		value, strings.Join(PermissionNames(), ", "))
+}
+
+// With returns the rule with the grantee added
+func (r Rule) With(g Grantee) Rule {
+	r.Users, r.Roles = slices.Clone(r.Users), slices.Clone(r.Roles)
+	switch {
+	case g.Everyone:
+		r.Everyone = true
+	case g.User != "" && !slices.Contains(r.Users, g.User):
+		r.Users = append(r.Users, g.User)
+	case g.Role != "" && !slices.Contains(r.Roles, g.Role):
+		r.Roles = append(r.Roles, g.Role)
+	case g.Permission != "":
+		r.Permissions |= Permissions[g.Permission]
+	}
+	return r
+}
+
+// Without returns the rule with the grantee removed
+func (r Rule) Without(g Grantee) Rule {
+	r.Users, r.Roles = slices.Clone(r.Users), slices.Clone(r.Roles)
+	switch {
+	case g.Everyone:
+		r.Everyone = false
+	case g.User != "":
+		r.Users = slices.DeleteFunc(r.Users, func(id string) bool { return id == g.User })
+	case g.Role != "":
+		r.Roles = slices.DeleteFunc(r.Roles, func(id string) bool { return id == g.Role })
+	case g.Permission != "":
+		r.Permissions &^= Permissions[g.Permission]
+	}
+	return r
+}
+
+// Describe lists who holds a rule's capability, with Discord mentions
+func (r Rule) Describe() string {
+	var holders []string
+	if r.Everyone {
+		holders = append(holders, "everyone")
+	}
+	for _, name := range PermissionNames() {
+		if r.Permissions&Permissions[name] != 0 {
+			holders = append(holders, name)
+		}
+	}
+	for _, role := range r.Roles {
+		holders = append(holders, "<@&"+role+">")
+	}
+	for _, user := range r.Users {
+		holders = append(holders, "<@"+user+">")
+	}
+	if len(holders) == 0 {
+		return "nobody (server administrators only)"
+	}
+	return strings.Join(holders, ", ")
+}
+
+// PermissionNames returns the names accepted by ParseGrantee, sorted
+func PermissionNames() []string {
+	names := make([]string, 0, len(Permissions))
+	for name := range Permissions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,70 @@
+package permissions
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestAllowed(t *testing.T) {
+	rules := map[Capability]Rule{
+		RemoveCode: {Roles: []string{"mods"}},
+		Import:     {Users: []string{"u2"}},
+		Admin:      {Users: []string{"owner"}},
+	}
+	ruleFor := func(c Capability) Rule {
+		if rule, ok := rules[c]; ok {
+			return rule
+		}
+		return DefaultRule(c)
+	}
+
+	member := Member{UserID: "u1"}
+	mod := Member{UserID: "u3", Roles: []string{"mods"}}
+	manager := Member{UserID: "u4", Permissions: discordgo.PermissionManageMessages}
+	serverAdmin := Member{UserID: "u5", Permissions: discordgo.PermissionAdministrator}
+
+	tests := []struct {
+		name   string
+		member Member
+		c      Capability
+		want   bool
+	}{
+		{"everyone adds by default", member, Add, true},
+		{"members can't remove by default", member, Remove, false},
+		{"manage messages removes by default", manager, Remove, true},
+		{"configured rule replaces the default", manager, RemoveCode, false},
+		{"role grant", mod, RemoveCode, true},
+		{"user grant", Member{UserID: "u2"}, Import, true},
+		{"admin implies everything", Member{UserID: "owner"}, Import, true},
+		{"server administrators can't be locked out", serverAdmin, Admin, true},
+	}
+	for _, test := range tests {
+		if got := Allowed(ruleFor, test.member, test.c); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGrantAndRevoke(t *testing.T) {
+	rule := Rule{}
+	for _, value := range []string{"<@&42>", "<@!7>", "everyone", "manage-messages"} {
+		grantee, err := ParseGrantee(value)
+		if err != nil {
+			t.Fatalf("ParseGrantee(%q) failed: %v", value, err)
+		}
+		rule = rule.With(grantee)
+	}
+	if !rule.Everyone || len(rule.Roles) != 1 || rule.Roles[0] != "42" || len(rule.Users) != 1 || rule.Users[0] != "7" ||
+		rule.Permissions != discordgo.PermissionManageMessages {
+		t.Fatalf("Unexpected rule after grants: %+v", rule)
+	}
+
+	grantee, _ := ParseGrantee("<@&42>")
+	if rule = rule.Without(grantee); len(rule.Roles) != 0 {
+		t.Errorf("Role should be revoked: %+v", rule)
+	}
+	if _, err := ParseGrantee("mods"); err == nil {
+		t.Error("Unknown grantees should be rejected")
+	}
+}
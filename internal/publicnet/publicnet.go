@@ -0,0 +1,80 @@
+// Package publicnet makes HTTP clients that only reach the public internet
+package publicnet
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// reservedRanges aren't reachable from the internet either, though netip
+// doesn't count them as private
+var reservedRanges = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "This network", 0.0.0.0 reaches the local host
+	netip.MustParsePrefix("100.64.0.0/10"),  // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // Benchmarking, used for internal networks
+	netip.MustParsePrefix("240.0.0.0/4"),    // Reserved, including broadcast
+	netip.MustParsePrefix("64:ff9b:1::/48"), // Local-use NAT64, translated inside the network
+}
+
+// nat64Prefix is the well-known NAT64 prefix. The IPv4 address in its last
+// four bytes is what the gateway actually connects to.
+var nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+
+// Client returns a client that refuses to connect to loopback, private and
+// link-local addresses. Anyone who can add a GIF picks the URL, so fetching
+// it must never reach the bot's own network. The check runs on every dial,
+// so it also covers redirects and names that resolve differently the
+// second time.
+func Client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, Control: RefusePrivate}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // A proxy would make the dial to the proxy, not the host
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// RefusePrivate is a net.Dialer Control that rejects addresses which aren't
+// reachable from the internet
+func RefusePrivate(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("unexpected address %s: %v", address, err)
+	}
+	if !public(unwrap(ip)) {
+		return fmt.Errorf("refusing to connect to non-public address %s", ip)
+	}
+	return nil
+}
+
+// unwrap returns the IPv4 address behind an IPv4-mapped or NAT64 address,
+// which is where a connection to it really goes
+func unwrap(ip netip.Addr) netip.Addr {
+	if nat64Prefix.Contains(ip) {
+		bytes := ip.As16()
+		return netip.AddrFrom4([4]byte(bytes[12:]))
+	}
+	return ip.Unmap()
+}
+
+// public reports whether an address can be reached from the internet
+func public(ip netip.Addr) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, reserved := range reservedRanges {
+		if reserved.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,32 @@
+package publicnet
+
+import "testing"
+
+func TestRefusePrivate(t *testing.T) {
+	for address, public := range map[string]bool{
+		"93.184.215.14:443":        true,
+		"[2606:4700::1111]:443":    true,
+		"127.0.0.1:80":             false,
+		"10.1.2.3:80":              false,
+		"192.168.0.10:80":          false,
+		"169.254.169.254:80":       false,
+		"100.64.0.1:80":            false,
+		"0.0.0.0:80":               false,
+		"0.1.2.3:80":               false,
+		"198.18.0.1:80":            false,
+		"198.19.255.254:80":        false,
+		"[64:ff9b::a00:1]:80":      false,
+		"[64:ff9b::7f00:1]:80":     false,
+		"[64:ff9b::5db8:d70e]:443": true,
+		"[64:ff9b:1::a00:1]:80":    false,
+		"[::ffff:10.0.0.1]:80":     false,
+		"[::1]:80":                 false,
+		"[::ffff:127.0.0.1]:80":    false,
+		"[fd00::1]:80":             false,
+		"[fe80::1]:80":             false,
+	} {
+		if err := RefusePrivate("tcp", address, nil); (err == nil) != public {
+			t.Errorf("%s: expected public %v, got %v", address, public, err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Package review keeps GIF submissions that are waiting for a moderator
+package review
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"theListBot/internal/safefile"
+	"time"
+)
+
+// fileName is the queue file kept in each guild's directory
+const fileName = "pending.json"
+
+// Submission is a GIF someone asked to add
+type Submission struct {
+	ID              int       `json:"id"`
+	Code            string    `json:"code"`
+	URL             string    `json:"url"`
+	By              string    `json:"by"`         // User ID of whoever submitted it
+	ChannelID       string    `json:"channel_id"` // Where it was submitted, for the verdict
+	At              time.Time `json:"at"`
+	ReviewChannelID string    `json:"review_channel_id,omitempty"` // Where the review message was posted
+	ReviewMessageID string    `json:"review_message_id,omitempty"`
+}
+
+// Queue holds the pending submissions of one guild, in the order they arrived
+type Queue struct {
+	mutex       sync.Mutex
+	path        string
+	NextID      int          `json:"next_id"`
+	Submissions []Submission `json:"submissions"`
+}
+
+// Add queues a submission, assigns its ID and saves the queue
+func (q *Queue) Add(submission Submission) (Submission, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, pending := range q.Submissions {
+		if pending.Code == submission.Code && pending.URL == submission.URL {
+			return Submission{}, fmt.Errorf("that GIF is already waiting for review as #%d", pending.ID)
+		}
+	}
+
+	q.NextID++
+	submission.ID = q.NextID
+	if submission.At.IsZero() {
+		submission.At = time.Now()
+	}
+	q.Submissions = append(q.Submissions, submission)
+
+	if err := q.saveLocked(); err != nil {
+		q.Submissions = q.Submissions[:len(q.Submissions)-1]
+		q.NextID--
+		return Submission{}, err
+	}
+	return submission, nil
+}
+
+// SetReviewMessage records where a submission's review message was posted
+func (q *Queue) SetReviewMessage(id int, channelID string, messageID string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	index := q.indexLocked(id)
+	if index < 0 {
+		return fmt.Errorf("submission #%d not found", id)
+	}
+	q.Submissions[index].ReviewChannelID = channelID
+	q.Submissions[index].ReviewMessageID = messageID
+	return q.saveLocked()
+}
+
+// Take removes a submission from the queue so exactly one moderator can
+// decide on it. It reports false if the submission was already handled.
+func (q *Queue) Take(id int) (Submission, bool, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	index := q.indexLocked(id)
+	if index < 0 {
+		return Submission{}, false, nil
+	}
+
+	submission := q.Submissions[index]
+	q.Submissions = slices.Delete(q.Submissions, index, index+1)
+	if err := q.saveLocked(); err != nil {
+		q.Submissions = slices.Insert(q.Submissions, index, submission)
+		return Submission{}, false, err
+	}
+	return submission, true, nil
+}
+
+// Pending returns a copy of every waiting submission, oldest first
+func (q *Queue) Pending() []Submission {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return slices.Clone(q.Submissions)
+}
+
+// indexLocked returns the position of a submission, or -1. Callers must
+// hold the lock.
+func (q *Queue) indexLocked(id int) int {
+	return slices.IndexFunc(q.Submissions, func(s Submission) bool { return s.ID == id })
+}
+
+// saveLocked writes the queue to disk. Callers must hold the lock.
+func (q *Queue) saveLocked() error {
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize review queue: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+		return fmt.Errorf("failed to create review queue directory: %v", err)
+	}
+	if err := safefile.WriteFile(q.path, data, 0644, safefile.BackupCount()); err != nil {
+		return fmt.Errorf("failed to save review queue: %v", err)
+	}
+	return nil
+}
+
+// Registry keeps the review queue of every guild
+type Registry struct {
+	mutex  sync.Mutex
+	dirFor func(guildID string) string // Directory holding a guild's files
+	queues map[string]*Queue           // Keyed by directory
+}
+
+// NewRegistry creates a Registry that keeps each guild's queue in the
+// directory returned by dirFor
+func NewRegistry(dirFor func(guildID string) string) *Registry {
+	return &Registry{
+		dirFor: dirFor,
+		queues: make(map[string]*Queue),
+	}
+}
+
+// ForGuild returns a guild's queue, loading it on first use
+func (r *Registry) ForGuild(guildID string) *Queue {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	dir := r.dirFor(guildID)
+	if q, ok := r.queues[dir]; ok {
+		return q
+	}
+
+	q := &Queue{path: filepath.Join(dir, fileName)}
+	err := safefile.ReadFile(q.path, func(data []byte) error {
+		q.NextID, q.Submissions = 0, nil
+		return json.Unmarshal(data, q)
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Error loading review queue from %s, starting empty: %v", dir, err)
+	}
+	if len(q.Submissions) > 0 {
+		log.Printf("Loaded %d pending submissions from %s", len(q.Submissions), q.path)
+	}
+
+	r.queues[dir] = q
+	return q
+}
@@ -0,0 +1,81 @@
+package review
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQueuePersistsAndTakesOnce(t *testing.T) {
+	root := t.TempDir()
+	dirFor := func(guildID string) string { return filepath.Join(root, guildID) }
+
+	queue := NewRegistry(dirFor).ForGuild("g1")
+	first, err := queue.Add(Submission{Code: "gg", URL: "https://example.com/a.gif", By: "u1", ChannelID: "c1"})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if _, err := queue.Add(Submission{Code: "gg", URL: "https://example.com/a.gif", By: "u2"}); err == nil {
+		t.Error("The same GIF should not be queued twice")
+	}
+	second, _ := queue.Add(Submission{Code: "ty", URL: "https://example.com/b.gif", By: "u1"})
+	if first.ID == second.ID || first.At.IsZero() {
+		t.Errorf("Submissions should get distinct IDs and a time: %+v %+v", first, second)
+	}
+	if err := queue.SetReviewMessage(first.ID, "review", "m1"); err != nil {
+		t.Fatalf("SetReviewMessage failed: %v", err)
+	}
+
+	reloaded := NewRegistry(dirFor).ForGuild("g1")
+	pending := reloaded.Pending()
+	if len(pending) != 2 || pending[0].ReviewMessageID != "m1" {
+		t.Fatalf("Unexpected queue after reload: %+v", pending)
+	}
+
+	taken, found, err := reloaded.Take(first.ID)
+	if err != nil || !found || taken.Code != "gg" || taken.By != "u1" {
+		t.Fatalf("Take returned %+v, %v, %v", taken, found, err)
+	}
+	if _, found, _ := reloaded.Take(first.ID); found {
+		t.Error("A submission should only be taken once")
+	}
+
+	// IDs keep counting after a reload so old review buttons never match a new submission
+	third, _ := reloaded.Add(Submission{Code: "gg", URL: "https://example.com/a.gif"})
+	if third.ID <= second.ID {
+		t.Errorf("Expected a fresh ID above %d, got %d", second.ID, third.ID)
+	}
+	if len(NewRegistry(dirFor).ForGuild("g2").Pending()) != 0 {
+		t.Error("Queues should not leak between guilds")
+	}
+}
+
+func TestFailedAddKeepsIDs(t *testing.T) {
+	root := t.TempDir()
+	dirFor := func(guildID string) string { return filepath.Join(root, guildID) }
+
+	// A file where the guild's directory should be makes saving fail
+	blocked := filepath.Join(root, "g1")
+	if err := os.WriteFile(blocked, nil, 0644); err != nil {
+		t.Fatalf("Failed to block the queue directory: %v", err)
+	}
+	queue := NewRegistry(dirFor).ForGuild("g1")
+	if _, err := queue.Add(Submission{Code: "gg", URL: "https://example.com/a.gif"}); err == nil {
+		t.Fatal("Expected the add to fail when the queue can't be saved")
+	}
+	if pending := queue.Pending(); len(pending) != 0 {
+		t.Errorf("Expected the failed submission to be dropped, got %+v", pending)
+	}
+
+	os.Remove(blocked)
+	submission, err := queue.Add(Submission{Code: "gg", URL: "https://example.com/a.gif"})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if submission.ID != 1 {
+		t.Errorf("Expected the failed add not to use up an ID, got #%d", submission.ID)
+	}
+	if reloaded := NewRegistry(dirFor).ForGuild("g1"); reloaded.NextID != submission.ID {
+		t.Errorf("Expected the saved next ID %d, got %d", submission.ID, reloaded.NextID)
+	}
+}
@@ -0,0 +1,170 @@
+package safefile
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// defaultBackupCount is how many backups are kept when GIFLIST_BACKUP_COUNT is unset
+const defaultBackupCount = 5
+
+// backupTimeFormat sorts lexically in chronological order
+const backupTimeFormat = "20060102-150405.000000000"
+
+// BackupCount returns how many rotating backups to keep beside each file
+func BackupCount() int {
+	if value := os.Getenv("GIFLIST_BACKUP_COUNT"); value != "" {
+		if count, err := strconv.Atoi(value); err == nil && count >= 0 {
+			return count
+		}
+		log.Printf("Invalid GIFLIST_BACKUP_COUNT %q, using %d", value, defaultBackupCount)
+	}
+	return defaultBackupCount
+}
+
+// WriteFile atomically replaces path with data. The data is written to a
+// temporary file in the same directory, synced, and renamed over path, so a
+// crash leaves either the old or the new contents but never a truncated file.
+// The previous contents are kept as a timestamped backup, with at most keep
+// backups retained.
+func WriteFile(path string, data []byte, perm os.FileMode, keep int) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	tmpName := tmp.Name()
+	// Clean up the temp file on any failure before the rename
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp file: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync temp file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %v", err)
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return fmt.Errorf("failed to set permissions: %v", err)
+	}
+
+	if keep > 0 {
+		if err := backup(path, keep); err != nil {
+			// A failed backup should not block saving the new data
+			log.Printf("Warning: Failed to back up %s: %v", path, err)
+		}
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", path, err)
+	}
+
+	// Sync the directory so the rename itself survives a crash
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
+
+// ReadFile reads path and hands the contents to decode. If the file can't be
+// read or decoded, it is set aside as a .corrupt copy and the backups are
+// tried from newest to oldest; the first one that decodes is restored.
+// decode may be called several times and must reset its target each time.
+// A missing file with no backups returns an error wrapping os.ErrNotExist.
+func ReadFile(path string, decode func([]byte) error) error {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err = decode(data); err == nil {
+			return nil
+		}
+		log.Printf("Failed to decode %s: %v", path, err)
+		quarantine(path)
+	} else if !os.IsNotExist(err) {
+		log.Printf("Failed to read %s: %v", path, err)
+	}
+
+	backups := Backups(path)
+	if len(backups) == 0 {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s does not exist: %w", path, os.ErrNotExist)
+		}
+		return fmt.Errorf("failed to load %s and no backups are available: %v", path, err)
+	}
+
+	for _, backupPath := range backups {
+		backupData, readErr := os.ReadFile(backupPath)
+		if readErr != nil {
+			log.Printf("Skipping unreadable backup %s: %v", backupPath, readErr)
+			continue
+		}
+		if decodeErr := decode(backupData); decodeErr != nil {
+			log.Printf("Skipping invalid backup %s: %v", backupPath, decodeErr)
+			continue
+		}
+
+		log.Printf("Recovered %s from backup %s", path, backupPath)
+		if writeErr := WriteFile(path, backupData, 0644, 0); writeErr != nil {
+			log.Printf("Warning: Failed to restore %s from backup: %v", path, writeErr)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("failed to load %s and none of %d backups are valid: %v", path, len(backups), err)
+}
+
+// Backups returns the backup files for path, newest first
+func Backups(path string) []string {
+	matches, err := filepath.Glob(path + ".*.bak")
+	if err != nil {
+		return nil
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(matches)))
+	return matches
+}
+
+// backup copies the current contents of path to a new timestamped backup and
+// prunes the oldest backups beyond keep
+func backup(path string, keep int) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	backupPath := fmt.Sprintf("%s.%s.bak", path, time.Now().UTC().Format(backupTimeFormat))
+	if err := os.WriteFile(backupPath, data, 0644); err != nil {
+		return err
+	}
+
+	backups := Backups(path)
+	for _, old := range backups[min(keep, len(backups)):] {
+		if err := os.Remove(old); err != nil {
+			log.Printf("Warning: Failed to remove old backup %s: %v", old, err)
+		}
+	}
+	return nil
+}
+
+// quarantine moves a corrupt file aside so it is never overwritten or rotated away
+func quarantine(path string) {
+	corruptPath := fmt.Sprintf("%s.%s.corrupt", path, time.Now().UTC().Format(backupTimeFormat))
+	if err := os.Rename(path, corruptPath); err != nil {
+		log.Printf("Warning: Failed to set aside corrupt file %s: %v", path, err)
+		return
+	}
+	log.Printf("Moved corrupt file %s to %s", path, corruptPath)
+}
@@ -0,0 +1,80 @@
+package safefile
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileRotatesBackups(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "data.json")
+
+	for i := 0; i < 5; i++ {
+		if err := WriteFile(path, []byte{byte('0' + i)}, 0644, 3); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "4" {
+		t.Fatalf("Expected latest contents, got %q (%v)", data, err)
+	}
+
+	backups := Backups(path)
+	if len(backups) != 3 {
+		t.Fatalf("Expected 3 backups, got %d: %v", len(backups), backups)
+	}
+	newest, _ := os.ReadFile(backups[0])
+	if string(newest) != "3" {
+		t.Errorf("Newest backup should hold the previous contents, got %q", newest)
+	}
+
+	// No temp files are left behind
+	entries, _ := os.ReadDir(tempDir)
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp-") {
+			t.Errorf("Temp file left behind: %s", entry.Name())
+		}
+	}
+}
+
+func TestReadFileFallsBackToBackup(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "counts.json")
+
+	WriteFile(path, []byte(`{"gg": 3}`), 0644, 2)
+	WriteFile(path, []byte(`{"gg": 4}`), 0644, 2)
+	// Simulate a crash that truncated the live file
+	os.WriteFile(path, []byte(`{"gg":`), 0644)
+
+	var counts map[string]int
+	err := ReadFile(path, func(data []byte) error {
+		counts = make(map[string]int)
+		return json.Unmarshal(data, &counts)
+	})
+	if err != nil {
+		t.Fatalf("Expected recovery from backup, got: %v", err)
+	}
+	if counts["gg"] != 3 {
+		t.Errorf("Expected the newest valid backup to be used, got %v", counts)
+	}
+
+	// The live file is restored and the damaged copy is kept aside
+	if data, _ := os.ReadFile(path); string(data) != `{"gg": 3}` {
+		t.Errorf("Live file should be restored from backup, got %q", data)
+	}
+	if matches, _ := filepath.Glob(path + ".*.corrupt"); len(matches) != 1 {
+		t.Errorf("Expected the corrupt file to be set aside, found %v", matches)
+	}
+}
+
+func TestReadFileMissing(t *testing.T) {
+	err := ReadFile(filepath.Join(t.TempDir(), "missing.json"), func([]byte) error { return nil })
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a not-exist error, got %v", err)
+	}
+}
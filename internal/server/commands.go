@@ -0,0 +1,373 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"theListBot/internal/chat/discordchat"
+	"theListBot/internal/combo"
+	"theListBot/internal/cooldown"
+	"theListBot/internal/giflist"
+	"theListBot/internal/paginate"
+	"theListBot/internal/permissions"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxChoices is how many autocomplete suggestions Discord accepts
+const maxChoices = 25
+
+// codeOption is the code argument shared by most commands, completed from
+// the guild's codes
+func codeOption(description string, required bool) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         "code",
+		Description:  description,
+		Required:     required,
+		Autocomplete: true,
+	}
+}
+
+// sortOption lets listings start sorted by name or usage
+func sortOption() *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "sort",
+		Description: "How to sort the listing",
+		Choices: []*discordgo.ApplicationCommandOptionChoice{
+			{Name: "by name", Value: string(paginate.SortName)},
+			{Name: "by usage", Value: string(paginate.SortUsage)},
+		},
+	}
+}
+
+// applicationCommands are the slash commands the bot registers
+var applicationCommands = []*discordgo.ApplicationCommand{
+	{
+		Name:        "list",
+		Description: "Show and manage the gif list",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "show",
+				Description: "Show every code, or the GIFs of one code",
+				Options:     []*discordgo.ApplicationCommandOption{codeOption("Code to show the GIFs of", false), sortOption()},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "add",
+				Description: "Add a GIF to a code",
+				Options: []*discordgo.ApplicationCommandOption{
+					codeOption("Code to add the GIF to, new codes are created", true),
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "url",
+						Description: "Link to the GIF",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "remove",
+				Description: "Remove a GIF from a code, or the whole code",
+				Options: []*discordgo.ApplicationCommandOption{
+					codeOption("Code to remove from", true),
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "url",
+						Description: "GIF to remove, leave out to remove the whole code",
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "info",
+				Description: "Show who added each GIF of a code and how often it's picked",
+				Options:     []*discordgo.ApplicationCommandOption{codeOption("Code to show", true)},
+			},
+		},
+	},
+	{
+		Name:        "counts",
+		Description: "Show how often each code was used today and ever",
+		Options:     []*discordgo.ApplicationCommandOption{sortOption()},
+	},
+	{
+		Name:        "gif",
+		Description: "Post a GIF for a code",
+		Options:     []*discordgo.ApplicationCommandOption{codeOption("Code to post", true)},
+	},
+}
+
+// registerCommands replaces the bot's global slash commands with the
+// current definitions
+func (s *Server) registerCommands(session *discordgo.Session) {
+	registered, err := session.ApplicationCommandBulkOverwrite(session.State.User.ID, "", applicationCommands)
+	if err != nil {
+		log.Printf("Error registering slash commands: %v", err)
+		return
+	}
+	log.Printf("Registered %d slash commands", len(registered))
+}
+
+// commandOptions flattens a command's options by name, descending into
+// the chosen subcommand
+func commandOptions(options []*discordgo.ApplicationCommandInteractionDataOption) (string, map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	subcommand := ""
+	if len(options) == 1 && options[0].Type == discordgo.ApplicationCommandOptionSubCommand {
+		subcommand = options[0].Name
+		options = options[0].Options
+	}
+
+	byName := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(options))
+	for _, option := range options {
+		byName[option.Name] = option
+	}
+	return subcommand, byName
+}
+
+// stringOption returns a string option, or "" if it wasn't given
+func stringOption(options map[string]*discordgo.ApplicationCommandInteractionDataOption, name string) string {
+	if option, ok := options[name]; ok {
+		return strings.TrimSpace(option.StringValue())
+	}
+	return ""
+}
+
+// handleApplicationCommand runs a slash command
+func (s *Server) handleApplicationCommand(session *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	subcommand, options := commandOptions(data.Options)
+	member := discordchat.InteractionMember(i)
+	log.Printf("Slash command from %s: /%s %s", member.UserID, data.Name, subcommand)
+
+	gifList := s.gifLists.ForGuild(i.GuildID)
+	code := strings.ToLower(stringOption(options, "code"))
+	url := stringOption(options, "url")
+
+	switch data.Name + " " + subcommand {
+	case "list show":
+		if code != "" {
+			listing, found := codeListing(gifList, code)
+			if !found {
+				respondText(session, i, fmt.Sprintf("No GIFs found for code: %s.", code)+didYouMean(gifList, code))
+				return
+			}
+			s.respondListing(session, i, listing)
+			return
+		}
+
+		order := paginate.SortName
+		if parsed, ok := paginate.ParseSortOrder(stringOption(options, "sort")); ok {
+			order = parsed
+		}
+		listing, found := codesListing(gifList, order)
+		if !found {
+			respondText(session, i, "No codes available yet.")
+			return
+		}
+		s.respondListing(session, i, listing)
+
+	case "list add":
+		if !s.requireInteraction(session, i, permissions.Add) {
+			return
+		}
+		respondText(session, i, s.addGif(discordchat.New(session), i.GuildID, i.ChannelID, member, code, url))
+
+	case "list remove":
+		capability := permissions.RemoveCode
+		if url != "" {
+			capability = permissions.Remove
+		}
+		if !s.requireInteraction(session, i, capability) {
+			return
+		}
+		respondText(session, i, removeGif(gifList, code, url, member.UserID))
+
+	case "list info":
+		listing, found := infoListing(gifList, code)
+		if !found {
+			respondText(session, i, fmt.Sprintf("No GIFs found for code: %s.", code)+didYouMean(gifList, code))
+			return
+		}
+		s.respondListing(session, i, listing)
+
+	case "counts ":
+		order := paginate.SortUsage
+		if parsed, ok := paginate.ParseSortOrder(stringOption(options, "sort")); ok {
+			order = parsed
+		}
+		combos := s.combos.ForGuild(i.GuildID)
+		s.respondListing(session, i, countsListing("Daily Code Counts", combos.GetDailyCounts(), order))
+		s.followupListing(session, i, countsListing("Lifetime Code Counts", combos.GetLifetimeCounts(), order))
+
+	case "gif ":
+		s.handleGifCommand(session, i, gifList, code)
+
+	default:
+		log.Printf("Unknown slash command /%s %s", data.Name, subcommand)
+		respondEphemeral(session, i, "Unknown command.")
+	}
+}
+
+// handleGifCommand posts a GIF for a code like typing the code would,
+// under the same cooldowns and counts
+func (s *Server) handleGifCommand(session *discordgo.Session, i *discordgo.InteractionCreate, gifList *giflist.GifList, code string) {
+	if err := gifList.Policy().Validate(code); err != nil {
+		respondEphemeral(session, i, "Error: "+err.Error())
+		return
+	}
+	code = gifList.Resolve(code)
+	member := discordchat.InteractionMember(i)
+
+	// Codes without GIFs to post mustn't use up anyone's cooldown
+	if !gifList.HasPostableGifs(code) {
+		respondEphemeral(session, i, fmt.Sprintf("No GIFs found for code: %s.", code)+didYouMean(gifList, code))
+		return
+	}
+
+	// Slash commands can't be left unanswered, so limited uses get a private note
+	cfg := s.settings.Get(i.GuildID).Cooldown
+	allowed, reason := s.cooldowns.Allow(cfg, cooldown.Use{GuildID: i.GuildID, UserID: member.UserID, ChannelID: i.ChannelID, Code: code})
+	if !allowed {
+		log.Printf("Rate limited /gif %s from %s: %s", code, member.UserID, reason)
+		if !cfg.NoCount {
+			s.combos.ForGuild(i.GuildID).RecordCode(member.UserID, code)
+		}
+		respondEphemeral(session, i, "Slow down! ("+reason+")")
+		return
+	}
+
+	gif, found := gifList.PickGif(code, i.ChannelID)
+	if !found {
+		respondEphemeral(session, i, fmt.Sprintf("No GIFs found for code: %s.", code)+didYouMean(gifList, code))
+		return
+	}
+
+	dailyCount, userCombo, comboEvent := s.combos.ForGuild(i.GuildID).RecordCode(member.UserID, code)
+	log.Printf("Code %s used by %s via /gif. Daily count: %d, User combo: %d", code, member.UserID, dailyCount, userCombo)
+
+	response, done := gifResponse(gifList, gif, code, member.UserID)
+	defer done()
+
+	err := session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: discordchat.InteractionData(response),
+	})
+	if err != nil {
+		log.Printf("Error sending GIF response: %v", err)
+		return
+	}
+
+	if comboEvent != nil {
+		s.followupCombo(session, i, comboEvent)
+	}
+}
+
+// followupCombo announces a combo after a slash command's response
+func (s *Server) followupCombo(session *discordgo.Session, i *discordgo.InteractionCreate, comboEvent *combo.ComboEvent) {
+	_, err := session.FollowupMessageCreate(i.Interaction, false, &discordgo.WebhookParams{
+		Content: fmt.Sprintf("%s %s", comboEvent.Message, comboEvent.GifURL),
+	})
+	if err != nil {
+		log.Printf("Error sending combo message: %v", err)
+	}
+}
+
+// handleAutocomplete suggests codes for the option being typed
+func (s *Server) handleAutocomplete(session *discordgo.Session, i *discordgo.InteractionCreate) {
+	typed := ""
+	_, options := commandOptions(i.ApplicationCommandData().Options)
+	for _, option := range options {
+		if option.Focused {
+			typed = strings.ToLower(strings.TrimSpace(option.StringValue()))
+		}
+	}
+
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, maxChoices)
+	for _, code := range completeCode(s.gifLists.ForGuild(i.GuildID).ListAllCodes(), typed) {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: code, Value: code})
+	}
+
+	err := session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+	if err != nil {
+		log.Printf("Error sending autocomplete choices: %v", err)
+	}
+}
+
+// completeCode returns the codes starting with typed, then those containing
+// it, each alphabetically and up to maxChoices, so suggestions stay put
+// between keystrokes
+func completeCode(codes []string, typed string) []string {
+	sorted := slices.Clone(codes)
+	slices.Sort(sorted)
+
+	var prefixed, contained []string
+	for _, code := range sorted {
+		switch {
+		case strings.HasPrefix(code, typed):
+			prefixed = append(prefixed, code)
+		case strings.Contains(code, typed):
+			contained = append(contained, code)
+		}
+	}
+
+	matches := append(prefixed, contained...)
+	if len(matches) > maxChoices {
+		matches = matches[:maxChoices]
+	}
+	return matches
+}
+
+// requireInteraction checks that whoever ran a slash command holds a
+// capability, and privately says so when they don't
+func (s *Server) requireInteraction(session *discordgo.Session, i *discordgo.InteractionCreate, c permissions.Capability) bool {
+	member := discordchat.InteractionMember(i)
+	if s.allowed(i.GuildID, member, c) {
+		return true
+	}
+
+	log.Printf("Denied %s to %s in guild %q via slash command", c, member.UserID, i.GuildID)
+	respondEphemeral(session, i, denial(i.GuildID, c))
+	return false
+}
+
+// respondText answers an interaction with a message everyone sees
+func respondText(session *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	err := session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Content: content},
+	})
+	if err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+	}
+}
+
+// respondListing answers an interaction with a paged listing
+func (s *Server) respondListing(session *discordgo.Session, i *discordgo.InteractionCreate, listing paginate.Listing) {
+	err := session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: discordchat.InteractionData(s.firstPage(listing)),
+	})
+	if err != nil {
+		log.Printf("Error sending listing: %v", err)
+	}
+}
+
+// followupListing sends another paged listing after an interaction's response
+func (s *Server) followupListing(session *discordgo.Session, i *discordgo.InteractionCreate, listing paginate.Listing) {
+	page := s.firstPage(listing)
+	_, err := session.FollowupMessageCreate(i.Interaction, false, &discordgo.WebhookParams{
+		Embeds:     discordchat.Embeds(page.Embeds),
+		Components: discordchat.Components(page.Buttons),
+	})
+	if err != nil {
+		log.Printf("Error sending listing: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"theListBot/internal/chat"
+	"theListBot/internal/chat/consolechat"
+	"theListBot/internal/giflist"
+	"theListBot/internal/permissions"
+)
+
+// Names the console uses for its one guild, channel and user
+const (
+	consoleGuild   = "console"
+	consoleChannel = "console"
+	consoleUser    = "console"
+)
+
+// RunConsole runs the bot offline: every line read from in is handled like
+// a chat message and responses are printed to out. Lists, settings and
+// counts live in a throwaway directory that is removed on return, and
+// nothing touches the network. The console user is a server administrator
+// so every command can be tried.
+func RunConsole(in io.Reader, out io.Writer) error {
+	dir, err := os.MkdirTemp("", "thelistbot-console-")
+	if err != nil {
+		return fmt.Errorf("failed to create console config directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Keep the real config and the GIF mirror out of it without touching
+	// the environment, which the rest of the process still relies on
+	log.Printf("Console mode using throwaway config path: %s", dir)
+
+	s := newServer(giflist.NewRegistryIn(dir, "", false))
+	defer s.Stop()
+
+	conn := consolechat.New(out, permissions.Member{Permissions: permissions.Permissions["administrator"]})
+	fmt.Fprintln(out, "theListBot console. Type !list help, !counts or a code, Ctrl+D to exit.")
+
+	scanner := bufio.NewScanner(in)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		s.handleMessage(conn, chat.Message{
+			ID:        fmt.Sprintf("in%d", n),
+			GuildID:   consoleGuild,
+			ChannelID: consoleChannel,
+			Author:    chat.User{ID: consoleUser, Name: consoleUser},
+			Content:   line,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read console input: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestConsoleRunsCommandsAndCodes(t *testing.T) {
+	in := strings.NewReader("!list add wave https://example.com/wave.gif\n\nwave\nwave\n!counts\n")
+	var out strings.Builder
+	if err := RunConsole(in, &out); err != nil {
+		t.Fatalf("RunConsole failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"Added GIF for code: `wave`",
+		"[m2]\nhttps://example.com/wave.gif",
+		"He's heating up....",
+		"**Daily Code Counts**\n`wave`: 2",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestConsoleLeavesEnvironmentAlone(t *testing.T) {
+	// The real config must be neither used nor pointed elsewhere
+	configDir := t.TempDir()
+	env := map[string]string{
+		"GIFLIST_CONFIG_PATH":   configDir,
+		"GIFLIST_DEFAULT_GUILD": "123",
+		"GIFLIST_MIRROR":        "true",
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+
+	in := strings.NewReader("!list add wave https://example.com/wave.gif\n")
+	var out strings.Builder
+	if err := RunConsole(in, &out); err != nil {
+		t.Fatalf("RunConsole failed: %v", err)
+	}
+
+	for name, value := range env {
+		if got := os.Getenv(name); got != value {
+			t.Errorf("Expected %s to stay %q, got %q", name, value, got)
+		}
+	}
+	entries, err := os.ReadDir(configDir)
+	if err != nil {
+		t.Fatalf("Failed to read config directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected the console to leave the real config directory empty, found %d entries", len(entries))
+	}
+}
+
+func TestConsolePrintsEveryHelpPage(t *testing.T) {
+	var out strings.Builder
+	if err := RunConsole(strings.NewReader("!list help\n"), &out); err != nil {
+		t.Fatalf("RunConsole failed: %v", err)
+	}
+
+	for _, want := range []string{"**The List Bot Commands**", "`!list show` -", "`!list export`", "Example: `gg` or `ty`"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected the help to contain %q, got:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "Page 1 of") || strings.Contains(out.String(), "Next ▶") {
+		t.Errorf("Expected plain messages instead of a paged embed, got:\n%s", out.String())
+	}
+}
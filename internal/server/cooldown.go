@@ -0,0 +1,159 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"theListBot/internal/chat"
+	"theListBot/internal/cooldown"
+	"theListBot/internal/settings"
+	"time"
+)
+
+// rateLimited reports whether a code use should go unanswered, reacting to
+// the message if the guild asked for that
+func (s *Server) rateLimited(conn chat.Conn, msg chat.Message, code string) (bool, cooldown.Config) {
+	cfg := s.settings.Get(msg.GuildID).Cooldown
+	allowed, reason := s.cooldowns.Allow(cfg, cooldown.Use{
+		GuildID:   msg.GuildID,
+		UserID:    msg.Author.ID,
+		ChannelID: msg.ChannelID,
+		Code:      code,
+	})
+	if allowed {
+		return false, cfg
+	}
+
+	log.Printf("Rate limited code %s from %s in %s: %s", code, msg.Author.Name, msg.ChannelID, reason)
+	if cfg.React != "" {
+		if err := conn.React(msg.ChannelID, msg.ID, reactionEmoji(cfg.React)); err != nil {
+			log.Printf("Error reacting to rate limited message: %v", err)
+		}
+	}
+	return true, cfg
+}
+
+// reactionEmoji converts an emoji as typed in chat into the form the API
+// expects: unicode emoji stay as they are, <:name:id> becomes name:id
+func reactionEmoji(emoji string) string {
+	if strings.HasPrefix(emoji, "<") && strings.HasSuffix(emoji, ">") {
+		emoji = strings.TrimPrefix(strings.Trim(emoji, "<>"), "a")
+		return strings.TrimPrefix(emoji, ":")
+	}
+	return emoji
+}
+
+// describeCooldown explains a guild's limits
+func describeCooldown(cfg cooldown.Config) string {
+	limit := func(d time.Duration) string {
+		if d <= 0 {
+			return "off"
+		}
+		return d.String()
+	}
+
+	lines := []string{
+		"**Cooldowns:**",
+		"Per user: " + limit(cfg.User),
+		"Per channel: " + limit(cfg.Channel),
+		"Per code: " + limit(cfg.Code),
+	}
+	if cfg.Burst > 0 && cfg.BurstWindow > 0 {
+		lines = append(lines, fmt.Sprintf("Burst: %d responses per %s across the server", cfg.Burst, cfg.BurstWindow))
+	} else {
+		lines = append(lines, "Burst: off")
+	}
+	if cfg.React != "" {
+		lines = append(lines, "Limited codes get a "+cfg.React+" reaction")
+	} else {
+		lines = append(lines, "Limited codes are ignored silently")
+	}
+	if cfg.NoCount {
+		lines = append(lines, "Limited codes don't count towards `!counts`")
+	} else {
+		lines = append(lines, "Limited codes still count towards `!counts`")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// handleCooldownCommand shows and changes a guild's rate limits
+func (s *Server) handleCooldownCommand(conn chat.Conn, msg chat.Message, parts []string) {
+	if len(parts) < 3 {
+		reply(conn, msg, describeCooldown(s.settings.Get(msg.GuildID).Cooldown))
+		return
+	}
+
+	usage := "Usage: !list cooldown [user|channel|code] [seconds|off], !list cooldown burst [count] [seconds], " +
+		"!list cooldown react [emoji|off] or !list cooldown count [on|off]"
+	if len(parts) < 4 {
+		reply(conn, msg, usage)
+		return
+	}
+
+	var change func(cfg *cooldown.Config)
+	switch parts[2] {
+	case "user", "channel", "code":
+		d, err := cooldown.ParseDuration(parts[3])
+		if err != nil {
+			reply(conn, msg, "Error: "+err.Error())
+			return
+		}
+		change = func(cfg *cooldown.Config) {
+			switch parts[2] {
+			case "user":
+				cfg.User = d
+			case "channel":
+				cfg.Channel = d
+			case "code":
+				cfg.Code = d
+			}
+		}
+
+	case "burst":
+		if parts[3] == "off" {
+			change = func(cfg *cooldown.Config) { cfg.Burst, cfg.BurstWindow = 0, 0 }
+			break
+		}
+		count, err := strconv.Atoi(parts[3])
+		if err != nil || count < 1 || len(parts) < 5 {
+			reply(conn, msg, usage)
+			return
+		}
+		window, err := cooldown.ParseDuration(parts[4])
+		if err != nil {
+			reply(conn, msg, "Error: "+err.Error())
+			return
+		}
+		change = func(cfg *cooldown.Config) { cfg.Burst, cfg.BurstWindow = count, window }
+
+	case "react":
+		emoji := parts[3]
+		if emoji == "off" {
+			emoji = ""
+		}
+		change = func(cfg *cooldown.Config) { cfg.React = emoji }
+
+	case "count":
+		if parts[3] != "on" && parts[3] != "off" {
+			reply(conn, msg, usage)
+			return
+		}
+		change = func(cfg *cooldown.Config) { cfg.NoCount = parts[3] == "off" }
+
+	default:
+		reply(conn, msg, usage)
+		return
+	}
+
+	err := s.settings.Update(msg.GuildID, func(g *settings.Guild) { change(&g.Cooldown) })
+	if err != nil {
+		log.Printf("Error saving settings: %v", err)
+		reply(conn, msg, "Error: failed to save the setting")
+		return
+	}
+
+	cfg := s.settings.Get(msg.GuildID).Cooldown
+	log.Printf("%s changed cooldowns in guild %q: %+v", msg.Author.ID, msg.GuildID, cfg)
+	reply(conn, msg, describeCooldown(cfg))
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"theListBot/internal/chat"
+	"theListBot/internal/chat/discordchat"
+	"theListBot/internal/giflist"
+	"theListBot/internal/permissions"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// gifButtonPrefix starts the custom ID of the buttons under posted GIFs
+const gifButtonPrefix = "gif:"
+
+// maxCustomIDLength is the longest custom ID Discord accepts on a button.
+// A longer one gets the whole message rejected.
+const maxCustomIDLength = 100
+
+// gifButtons returns the reroll and delete buttons of a GIF posted for a
+// code. The user who triggered it is part of the custom ID so the buttons
+// keep working after a restart. Codes too long to fit in a custom ID get no
+// buttons.
+func gifButtons(code string, userID string) []chat.Button {
+	reroll := fmt.Sprintf("%sreroll:%s:%s", gifButtonPrefix, userID, code)
+	remove := fmt.Sprintf("%sdelete:%s:%s", gifButtonPrefix, userID, code)
+	if len(reroll) > maxCustomIDLength || len(remove) > maxCustomIDLength {
+		return nil
+	}
+	return []chat.Button{
+		{Label: "🎲 Reroll", ID: reroll},
+		{Label: "🗑 Delete", ID: remove},
+	}
+}
+
+// gifResponse returns how to post a GIF triggered by a user: its link, or
+// an upload of the local copy when the link is dead, with reroll and delete
+// buttons. done must be called once the response is sent.
+func gifResponse(gifList *giflist.GifList, gif giflist.Gif, code string, userID string) (chat.Response, func()) {
+	response := chat.Response{Text: gif.URL, Buttons: gifButtons(code, userID)}
+	if !gif.Dead() {
+		return response, func() {}
+	}
+
+	file, err := gifList.OpenMirror(gif)
+	if err != nil {
+		log.Printf("Error opening mirrored copy of %s, posting the link: %v", gif.URL, err)
+		return response, func() {}
+	}
+
+	log.Printf("Link %s is dead, uploading mirrored copy %s", gif.URL, gif.Mirror)
+	response.Text = ""
+	response.Files = []chat.File{{Name: mirrorFileName(gif.URL), Reader: file}}
+	return response, func() { file.Close() }
+}
+
+// sendGif posts a GIF triggered by a user
+func (s *Server) sendGif(conn chat.Conn, channelID string, gifList *giflist.GifList, gif giflist.Gif, code string, userID string) error {
+	response, done := gifResponse(gifList, gif, code, userID)
+	defer done()
+
+	_, err := conn.Send(channelID, response)
+	return err
+}
+
+// handleGifButton rerolls or deletes a posted GIF. Only the user who
+// triggered it and members who can remove GIFs may press the buttons.
+func (s *Server) handleGifButton(session *discordgo.Session, i *discordgo.InteractionCreate, customID string) {
+	parts := strings.SplitN(strings.TrimPrefix(customID, gifButtonPrefix), ":", 3)
+	if len(parts) != 3 {
+		respondEphemeral(session, i, "This button doesn't work anymore.")
+		return
+	}
+	action, ownerID, code := parts[0], parts[1], parts[2]
+
+	member := discordchat.InteractionMember(i)
+	if member.UserID != ownerID && !s.allowed(i.GuildID, member, permissions.Remove) {
+		log.Printf("Denied %s of GIF for %s to %s", action, code, member.UserID)
+		respondEphemeral(session, i, fmt.Sprintf("Only <@%s> or a moderator can %s this GIF.", ownerID, action))
+		return
+	}
+
+	switch action {
+	case "reroll":
+		s.rerollGif(session, i, code, ownerID)
+
+	case "delete":
+		log.Printf("%s deleted GIF for code %s", member.UserID, code)
+		err := session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredMessageUpdate,
+		})
+		if err != nil {
+			log.Printf("Error acknowledging delete: %v", err)
+		}
+		if err := session.ChannelMessageDelete(i.ChannelID, i.Message.ID); err != nil {
+			log.Printf("Error deleting GIF message: %v", err)
+		}
+
+	default:
+		log.Printf("Unknown GIF button action %q", action)
+		respondEphemeral(session, i, "This button doesn't work anymore.")
+	}
+}
+
+// rerollGif replaces a posted GIF with another from the same pool. It
+// doesn't count as a new use of the code.
+func (s *Server) rerollGif(session *discordgo.Session, i *discordgo.InteractionCreate, code string, ownerID string) {
+	gifList := s.gifLists.ForGuild(i.GuildID)
+
+	gif, found := gifList.RerollGif(code, i.Message.Content)
+	if !found {
+		respondEphemeral(session, i, fmt.Sprintf("`%s` has no GIFs anymore.", code))
+		return
+	}
+	log.Printf("Rerolled GIF for code %s: %s", code, gif.URL)
+
+	response, done := gifResponse(gifList, gif, code, ownerID)
+	defer done()
+
+	// Clearing the attachments drops the upload of a previous dead link
+	data := discordchat.InteractionData(response)
+	data.Attachments = &[]*discordgo.MessageAttachment{}
+	err := session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: data,
+	})
+	if err != nil {
+		log.Printf("Error rerolling GIF: %v", err)
+	}
+}
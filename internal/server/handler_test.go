@@ -0,0 +1,511 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"theListBot/internal/chat"
+	"theListBot/internal/chat/chattest"
+	"theListBot/internal/giflist"
+	"theListBot/internal/linkcheck"
+	"theListBot/internal/paginate"
+	"theListBot/internal/permissions"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// harness runs messages through the server against an in-memory chat
+type harness struct {
+	t      *testing.T
+	server *Server
+	conn   *chattest.Conn
+	nextID int
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("GIFLIST_CONFIG_PATH", dir)
+	t.Setenv("GIFLIST_DEFAULT_GUILD", "")
+	t.Setenv("GIFLIST_MIRROR", "")
+
+	s := newServer(giflist.NewRegistry())
+	t.Cleanup(s.Stop)
+
+	conn := chattest.New()
+	conn.SetMember(permissions.Member{UserID: "admin", Permissions: permissions.Permissions["administrator"]})
+	return &harness{t: t, server: s, conn: conn}
+}
+
+// say sends a message to channel c1 of guild g1 and returns the responses
+func (h *harness) say(userID string, content string) []chattest.Sent {
+	return h.sayIn("g1", "c1", userID, content)
+}
+
+// sayIn sends a message to a channel and returns the responses
+func (h *harness) sayIn(guildID string, channelID string, userID string, content string) []chattest.Sent {
+	h.t.Helper()
+	h.nextID++
+	h.server.handleMessage(h.conn, chat.Message{
+		ID:        fmt.Sprintf("in%d", h.nextID),
+		GuildID:   guildID,
+		ChannelID: channelID,
+		Author:    chat.User{ID: userID, Name: userID},
+		Content:   content,
+	})
+	return h.conn.Sent()
+}
+
+// expect checks that the first response contains want. Codes used again
+// soon after may be followed by a combo message.
+func (h *harness) expect(sent []chattest.Sent, want string) chattest.Sent {
+	h.t.Helper()
+	if len(sent) == 0 {
+		h.t.Fatalf("Expected a response containing %q, got none", want)
+	}
+	if !strings.Contains(sent[0].Text(), want) {
+		h.t.Fatalf("Expected a response containing %q, got %q", want, sent[0].Text())
+	}
+	return sent[0]
+}
+
+func TestAddedCodeTriggersGif(t *testing.T) {
+	h := newHarness(t)
+
+	h.expect(h.say("u1", "!list add wave https://example.com/wave.gif"), "Added GIF for code: `wave`")
+
+	gif := h.expect(h.say("u1", "WAVE"), "https://example.com/wave.gif")
+	if len(gif.Response.Buttons) != 2 || !strings.HasPrefix(gif.Response.Buttons[0].ID, gifButtonPrefix+"reroll:u1:wave") {
+		t.Errorf("Expected reroll and delete buttons, got %+v", gif.Response.Buttons)
+	}
+
+	if sent := h.say("u1", "hello there"); len(sent) != 0 {
+		t.Errorf("Regular messages should get no response, got %+v", sent)
+	}
+	if sent := h.sayIn("g2", "c9", "u1", "wave"); len(sent) != 0 {
+		t.Errorf("Codes should not leak between guilds, got %+v", sent)
+	}
+}
+
+func TestRemoveNeedsPermission(t *testing.T) {
+	h := newHarness(t)
+	h.say("u1", "!list add wave https://example.com/wave.gif")
+
+	h.expect(h.say("u1", "!list remove wave"), "you need the `remove-code` permission")
+	h.expect(h.say("u1", "wave"), "https://example.com/wave.gif")
+
+	h.conn.SetMember(permissions.Member{UserID: "mod", Permissions: permissions.Permissions["manage-messages"]})
+	h.expect(h.say("mod", "!list remove wave"), "Removed code: `wave`")
+	if sent := h.say("u1", "wave"); len(sent) != 0 {
+		t.Errorf("Removed codes should get no response, got %+v", sent)
+	}
+}
+
+func TestGrantedRoleCanAdd(t *testing.T) {
+	h := newHarness(t)
+
+	h.expect(h.say("u1", "!list perms revoke add everyone"), "you need the `admin` permission")
+	h.expect(h.say("admin", "!list perms revoke add everyone"), "`add` is now held by")
+	h.expect(h.say("admin", "!list perms grant add <@&editors>"), "<@&editors>")
+
+	h.expect(h.say("u1", "!list add wave https://example.com/wave.gif"), "you need the `add` permission")
+	h.conn.SetMember(permissions.Member{UserID: "u1", Roles: []string{"editors"}})
+	h.expect(h.say("u1", "!list add wave https://example.com/wave.gif"), "Added GIF")
+}
+
+func TestDirectMessageListIsReadOnly(t *testing.T) {
+	h := newHarness(t)
+
+	h.expect(h.sayIn("", "dm1", "u1", "!list add wave https://example.com/wave.gif"), "can't be changed here")
+	h.expect(h.sayIn("", "dm1", "u1", "!list remove gg"), "can't be changed here")
+	h.expect(h.sayIn("", "dm1", "u1", "!list perms grant add everyone"), "can't be changed here")
+	if sent := h.sayIn("", "dm2", "u2", "wave"); len(sent) != 0 {
+		t.Errorf("Expected nothing added to the shared DM list, got %+v", sent)
+	}
+	h.expect(h.sayIn("", "dm2", "u2", "gg"), "giphy")
+}
+
+func TestWeightWarnsOutsideRandomMode(t *testing.T) {
+	h := newHarness(t)
+	h.say("u1", "!list add wave https://example.com/wave.gif")
+
+	if sent := h.expect(h.say("u1", "!list weight wave https://example.com/wave.gif 5"), "to 5"); strings.Contains(sent.Text(), "random mode") {
+		t.Errorf("Expected no warning in random mode, got %q", sent.Text())
+	}
+
+	h.say("u1", "!list mode wave shuffle")
+	h.expect(h.say("u1", "!list weight wave https://example.com/wave.gif 3"), "Weights only apply in random mode, `wave` is in shuffle mode")
+}
+
+func TestCountsCommand(t *testing.T) {
+	h := newHarness(t)
+	h.say("u1", "!list add wave https://example.com/wave.gif")
+	h.say("u1", "wave")
+	h.conn.Sent()
+	h.say("u2", "wave")
+
+	sent := h.say("u1", "!counts")
+	if len(sent) != 2 {
+		t.Fatalf("Expected daily and lifetime counts, got %+v", sent)
+	}
+	for _, s := range sent {
+		if !strings.Contains(s.Text(), "`wave`: 2") {
+			t.Errorf("Expected wave to be counted twice, got %q", s.Text())
+		}
+	}
+}
+
+func TestCountsAndCombosStayInTheirGuild(t *testing.T) {
+	h := newHarness(t)
+	h.sayIn("g1", "c1", "u1", "!list add wave https://example.com/wave.gif")
+	h.sayIn("g2", "c2", "u1", "!list add wave https://example.com/other-wave.gif")
+	h.sayIn("g2", "c2", "u1", "!list add bye https://example.com/bye.gif")
+
+	h.expect(h.sayIn("g1", "c1", "u1", "wave"), "https://example.com/wave.gif")
+	if sent := h.sayIn("g2", "c2", "u1", "wave"); len(sent) != 1 {
+		t.Errorf("Expected no combo from another guild's use, got %+v", sent)
+	}
+
+	h.sayIn("g2", "c2", "u1", "bye")
+	sent := h.sayIn("g1", "c1", "u1", "!counts")
+	if len(sent) != 2 {
+		t.Fatalf("Expected daily and lifetime counts, got %+v", sent)
+	}
+	for _, s := range sent {
+		if !strings.Contains(s.Text(), "`wave`: 1") || strings.Contains(s.Text(), "bye") {
+			t.Errorf("Expected only g1's use of wave, got %q", s.Text())
+		}
+	}
+}
+
+func TestCooldownReactsInsteadOfPosting(t *testing.T) {
+	h := newHarness(t)
+	h.say("u1", "!list add wave https://example.com/wave.gif")
+	h.say("admin", "!list cooldown user 60")
+	h.say("admin", "!list cooldown react ⏳")
+	h.say("admin", "!list cooldown count off")
+
+	h.expect(h.say("u1", "wave"), "https://example.com/wave.gif")
+	if sent := h.say("u1", "wave"); len(sent) != 0 {
+		t.Errorf("A rate limited code should get no GIF, got %+v", sent)
+	}
+	if reactions := h.conn.Reactions(); len(reactions) != 1 || reactions[0].Emoji != "⏳" {
+		t.Errorf("Expected one ⏳ reaction, got %+v", reactions)
+	}
+	h.expect(h.say("u2", "wave"), "https://example.com/wave.gif")
+
+	counts := h.say("u1", "!counts")
+	if len(counts) == 0 || !strings.Contains(counts[0].Text(), "`wave`: 2") {
+		t.Errorf("Limited uses should not count, got %+v", counts)
+	}
+}
+
+func TestUnknownCodesDontUseCooldowns(t *testing.T) {
+	h := newHarness(t)
+	h.say("u1", "!list add wave https://example.com/wave.gif")
+	h.say("admin", "!list cooldown user 60")
+	h.say("admin", "!list cooldown burst 1 60")
+	h.say("admin", "!list cooldown react ⏳")
+
+	if sent := h.say("u1", "lol"); len(sent) != 0 {
+		t.Errorf("Unknown codes should get no response, got %+v", sent)
+	}
+	h.expect(h.say("u1", "wave"), "https://example.com/wave.gif")
+	if reactions := h.conn.Reactions(); len(reactions) != 0 {
+		t.Errorf("Unknown codes should not be reacted to, got %+v", reactions)
+	}
+}
+
+// killGif has the link checker give up on a GIF in guild g1
+func (h *harness) killGif(gifURL string) {
+	h.t.Helper()
+	for i := 0; i < giflist.DeadAfterFailures; i++ {
+		h.server.gifLists.ForGuild("g1").RecordLinkChecks([]linkcheck.Result{
+			{URL: gifURL, Status: http.StatusNotFound, Error: "404 Not Found", CheckedAt: time.Now()},
+		})
+	}
+}
+
+func TestDeadCodesDontUseCooldowns(t *testing.T) {
+	h := newHarness(t)
+	h.say("u1", "!list add wave https://example.com/wave.gif")
+	h.say("u1", "!list add gone https://example.com/gone.gif")
+	h.killGif("https://example.com/gone.gif")
+	h.say("admin", "!list cooldown user 60")
+	h.say("admin", "!list cooldown react ⏳")
+
+	if sent := h.say("u1", "gone"); len(sent) != 0 {
+		t.Errorf("Codes with only dead GIFs should get no response, got %+v", sent)
+	}
+	h.expect(h.say("u1", "wave"), "https://example.com/wave.gif")
+
+	recorder := &discordRecorder{}
+	if response := h.slashGif(recorder, "u2", "gone"); !strings.Contains(response.Data.Content, "No GIFs found") {
+		t.Errorf("Expected a code with only dead GIFs to be reported, got %q", response.Data.Content)
+	}
+	if response := h.slashGif(recorder, "u2", "wave"); !strings.Contains(response.Data.Content, "https://example.com/wave.gif") {
+		t.Errorf("Expected the GIF after a dead code, got %q", response.Data.Content)
+	}
+}
+
+func TestSuggestionsForUnknownCodes(t *testing.T) {
+	h := newHarness(t)
+	h.say("u1", "!list add wave https://example.com/wave.gif")
+
+	if sent := h.say("u1", "wavw"); len(sent) != 0 {
+		t.Errorf("Suggestions should be off by default, got %+v", sent)
+	}
+	h.say("admin", "!list suggest on")
+	h.expect(h.say("u1", "wavw"), "Did you mean `wave`?")
+}
+
+func TestModeratedAdditions(t *testing.T) {
+	h := newHarness(t)
+	h.conn.SetChannelGuild("reviews", "g1")
+	h.expect(h.say("admin", "!list review on <#reviews>"), "<#reviews>")
+
+	sent := h.say("u1", "!list add wave https://example.com/wave.gif")
+	h.expect(sent[len(sent)-1:], "waiting for a moderator to approve it (submission #1)")
+	if sent := h.say("u1", "wave"); len(sent) != 0 {
+		t.Fatalf("Submissions should not be live before approval, got %+v", sent)
+	}
+
+	h.expect(h.say("u1", "!list approve 1"), "you need the `review` permission")
+
+	sent = h.say("admin", "!list approve 1")
+	if len(sent) != 1 || !strings.Contains(sent[0].Text(), "<@u1> your GIF for `wave` (submission #1) was approved") {
+		t.Fatalf("Expected the submitter to be told, got %+v", sent)
+	}
+	h.expect(h.say("u1", "wave"), "https://example.com/wave.gif")
+}
+
+func TestReviewMessageIsClosed(t *testing.T) {
+	h := newHarness(t)
+	h.conn.SetChannelGuild("reviews", "g1")
+	h.say("admin", "!list review on <#reviews>")
+
+	// The review post is sent before the reply to the submitter
+	h.say("u1", "!list add wave https://example.com/wave.gif")
+	post, ok := h.conn.Message("m2")
+	if !ok || post.ChannelID != "reviews" || len(post.Response.Buttons) != 2 {
+		t.Fatalf("Expected a review post with buttons, got %+v", post)
+	}
+
+	h.say("admin", "!list reject 1")
+	post, _ = h.conn.Message("m2")
+	if len(post.Response.Buttons) != 0 || !strings.Contains(post.Text(), "Rejected by <@admin>") {
+		t.Errorf("Expected the review post to show the outcome, got %q", post.Text())
+	}
+	if sent := h.say("u1", "wave"); len(sent) != 0 {
+		t.Errorf("Rejected GIFs should not be added, got %+v", sent)
+	}
+}
+
+func TestExportUploadsList(t *testing.T) {
+	h := newHarness(t)
+	h.say("u1", "!list add wave https://example.com/wave.gif")
+
+	export := h.expect(h.say("u1", "!list export"), "Exported")
+	if !strings.Contains(string(export.Files[exportFileName]), "https://example.com/wave.gif") {
+		t.Errorf("Export should contain the list, got %q", export.Files[exportFileName])
+	}
+}
+
+func TestUnknownSubcommand(t *testing.T) {
+	h := newHarness(t)
+	h.expect(h.say("u1", "!list frobnicate"), "Unknown command")
+}
+
+func TestShowAndInfoForLongCodes(t *testing.T) {
+	h := newHarness(t)
+	h.conn.SetComponents(false)
+	for i := 0; i < 40; i++ {
+		h.say("u1", fmt.Sprintf("!list add wave https://example.com/a-rather-long-path/to/wave-%02d.gif", i))
+	}
+	h.conn.Sent()
+
+	h.expect(h.say("u1", "!list show wave please"), "GIFs for code `wave` (40)")
+
+	sent := h.say("u1", "!list info wave")
+	if len(sent) < 2 {
+		t.Fatalf("Expected info for 40 GIFs to span several messages, got %d", len(sent))
+	}
+	all := ""
+	for _, s := range sent {
+		if len(s.Response.Text) > 2000 {
+			t.Errorf("Message of %d characters is over the limit", len(s.Response.Text))
+		}
+		all += s.Response.Text
+	}
+	if !strings.Contains(all, "wave-00.gif") || !strings.Contains(all, "wave-39.gif") {
+		t.Errorf("Expected every GIF in the info, got %q", all)
+	}
+}
+
+func TestHistoryIsPagedWithoutPings(t *testing.T) {
+	h := newHarness(t)
+	h.conn.SetComponents(false)
+	for i := 0; i < 40; i++ {
+		h.say("u1", fmt.Sprintf("!list add wave https://example.com/a-rather-long-path/to/wave-%02d.gif", i))
+	}
+	h.conn.Sent()
+
+	sent := h.say("u1", "!list history")
+	if len(sent) < 2 {
+		t.Fatalf("Expected 40 changes to span several messages, got %d", len(sent))
+	}
+	for _, s := range sent {
+		if len(s.Response.Text) > 2000 {
+			t.Errorf("Message of %d characters is over the limit", len(s.Response.Text))
+		}
+		if !s.Response.NoMentions {
+			t.Errorf("History should not ping the people who made changes, got %+v", s.Response)
+		}
+	}
+}
+
+// throttledConn is a chat connection that only takes one message per reply
+type throttledConn struct {
+	*chattest.Conn
+}
+
+func (throttledConn) MaxMessages() int {
+	return 1
+}
+
+func TestThrottledListingsAreCut(t *testing.T) {
+	conn := throttledConn{chattest.New()}
+	listing := paginate.Listing{Title: "Long"}
+	for i := 0; i < 200; i++ {
+		listing.Items = append(listing.Items, paginate.Item{Line: fmt.Sprintf("https://example.com/a-rather-long-path/to/wave-%03d.gif", i)})
+	}
+
+	sendListingMessages(conn, "c1", listing)
+	sent := conn.Sent()
+	if len(sent) != 2 || !strings.Contains(sent[1].Text(), "…truncated") {
+		t.Errorf("Expected one message and a truncation note, got %+v", sent)
+	}
+}
+
+func TestCodeNamedBy(t *testing.T) {
+	h := newHarness(t)
+	h.expect(h.say("u1", "!list add by https://example.com/bye.gif"), "Added GIF for code: `by`")
+	h.expect(h.say("u1", "by"), "https://example.com/bye.gif")
+	h.expect(h.say("u1", "!list show by"), "GIFs for code `by` (1)")
+	h.expect(h.say("u1", "!list show by usage"), "Available codes")
+}
+
+// recordedResponse is the part of an interaction response tests look at
+type recordedResponse struct {
+	Data struct {
+		Content string `json:"content"`
+	} `json:"data"`
+}
+
+// discordRecorder stands in for Discord's API and records the interaction
+// responses sent to it
+type discordRecorder struct {
+	mutex     sync.Mutex
+	responses []recordedResponse
+}
+
+func (r *discordRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasSuffix(req.URL.Path, "/callback") {
+		var response recordedResponse
+		if err := json.NewDecoder(req.Body).Decode(&response); err == nil {
+			r.mutex.Lock()
+			r.responses = append(r.responses, response)
+			r.mutex.Unlock()
+		}
+	}
+	return &http.Response{StatusCode: http.StatusNoContent, Body: io.NopCloser(strings.NewReader("")), Header: http.Header{}, Request: req}, nil
+}
+
+// Responses returns and clears the recorded interaction responses
+func (r *discordRecorder) Responses() []recordedResponse {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	responses := r.responses
+	r.responses = nil
+	return responses
+}
+
+// slashGif runs /gif code for a user in channel c1 of guild g1 and returns
+// the response
+func (h *harness) slashGif(recorder *discordRecorder, userID string, code string) recordedResponse {
+	h.t.Helper()
+	session, _ := discordgo.New("Bot test")
+	session.Client = &http.Client{Transport: recorder}
+
+	h.nextID++
+	h.server.interactionHandler(session, &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:        fmt.Sprintf("i%d", h.nextID),
+		Token:     "token",
+		Type:      discordgo.InteractionApplicationCommand,
+		GuildID:   "g1",
+		ChannelID: "c1",
+		Member:    &discordgo.Member{User: &discordgo.User{ID: userID}},
+		Data: discordgo.ApplicationCommandInteractionData{
+			Name: "gif",
+			Options: []*discordgo.ApplicationCommandInteractionDataOption{
+				{Name: "code", Type: discordgo.ApplicationCommandOptionString, Value: code},
+			},
+		},
+	}})
+
+	responses := recorder.Responses()
+	if len(responses) != 1 {
+		h.t.Fatalf("Expected one response to /gif %s, got %+v", code, responses)
+	}
+	return responses[0]
+}
+
+func TestUnknownSlashCodesDontUseCooldowns(t *testing.T) {
+	h := newHarness(t)
+	h.say("u1", "!list add wave https://example.com/wave.gif")
+	h.say("admin", "!list cooldown user 60")
+	h.say("admin", "!list cooldown burst 1 60")
+
+	recorder := &discordRecorder{}
+	if response := h.slashGif(recorder, "u1", "lol"); !strings.Contains(response.Data.Content, "No GIFs found") {
+		t.Errorf("Expected unknown codes to be reported, got %q", response.Data.Content)
+	}
+	if response := h.slashGif(recorder, "u1", "wave"); !strings.Contains(response.Data.Content, "https://example.com/wave.gif") {
+		t.Errorf("Expected the GIF after an unknown code, got %q", response.Data.Content)
+	}
+	if response := h.slashGif(recorder, "u1", "wave"); !strings.Contains(response.Data.Content, "Slow down") {
+		t.Errorf("Expected the cooldown to still apply to real codes, got %q", response.Data.Content)
+	}
+}
+
+func TestLongCodesGetNoGifButtons(t *testing.T) {
+	t.Setenv("GIFLIST_CODE_MAX_LENGTH", "120")
+	h := newHarness(t)
+	long := strings.Repeat("a", 100)
+	h.say("u1", "!list add "+long+" https://example.com/long.gif")
+
+	gif := h.expect(h.say("u1", long), "https://example.com/long.gif")
+	if len(gif.Response.Buttons) != 0 {
+		t.Errorf("Expected no buttons when the custom ID would be too long, got %+v", gif.Response.Buttons)
+	}
+	if buttons := gifButtons(strings.Repeat("a", 60), "123456789012345678"); len(buttons) != 2 || len(buttons[0].ID) > maxCustomIDLength {
+		t.Errorf("Expected buttons for a code that fits, got %+v", buttons)
+	}
+}
+
+func TestReviewChannelMustBeInGuild(t *testing.T) {
+	h := newHarness(t)
+	h.conn.SetChannelGuild("elsewhere", "g2")
+
+	h.expect(h.say("admin", "!list review on <#elsewhere>"), "isn't a channel of this server")
+	h.expect(h.say("admin", "!list review on <#nowhere>"), "not found")
+	if h.server.settings.Get("g1").Moderation {
+		t.Error("Moderation should stay off when the review channel is refused")
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// interactionHandler routes slash commands, autocomplete requests and
+// button presses to the feature that owns them
+func (s *Server) interactionHandler(session *discordgo.Session, i *discordgo.InteractionCreate) {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		s.handleApplicationCommand(session, i)
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		s.handleAutocomplete(session, i)
+	case discordgo.InteractionMessageComponent:
+		s.handleButton(session, i)
+	}
+}
+
+// handleButton routes a button press by the prefix of its custom ID
+func (s *Server) handleButton(session *discordgo.Session, i *discordgo.InteractionCreate) {
+	customID := i.MessageComponentData().CustomID
+	switch {
+	case strings.HasPrefix(customID, pageButtonPrefix):
+		s.handlePageButton(session, i, customID)
+	case strings.HasPrefix(customID, reviewButtonPrefix):
+		s.handleReviewButton(session, i, customID)
+	case strings.HasPrefix(customID, gifButtonPrefix):
+		s.handleGifButton(session, i, customID)
+	default:
+		log.Printf("Unknown button %q", customID)
+	}
+}
+
+// respondEphemeral answers an interaction with a message only its user sees
+func respondEphemeral(session *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	err := session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"theListBot/internal/chat"
+	"theListBot/internal/chat/discordchat"
+	"theListBot/internal/paginate"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// pageButtonPrefix starts the custom ID of every pagination button
+const pageButtonPrefix = "page:"
+
+// listingLifetime is how long the buttons of a paged listing keep working
+const listingLifetime = 30 * time.Minute
+
+// listingColor is the accent color of listing embeds
+const listingColor = 0x5865F2
+
+// pagedListing is a listing someone can page through with buttons
+type pagedListing struct {
+	listing paginate.Listing
+	page    int
+	created time.Time
+}
+
+// listings remembers the paged listings that have been sent, by ID
+type listings struct {
+	mutex  sync.Mutex
+	byID   map[string]*pagedListing
+	nextID int
+}
+
+// add stores a listing and returns its ID, dropping expired ones
+func (l *listings) add(listing paginate.Listing) string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.byID == nil {
+		l.byID = make(map[string]*pagedListing)
+	}
+	for id, paged := range l.byID {
+		if time.Since(paged.created) > listingLifetime {
+			delete(l.byID, id)
+		}
+	}
+
+	l.nextID++
+	id := strconv.Itoa(l.nextID)
+	l.byID[id] = &pagedListing{listing: listing, created: time.Now()}
+	return id
+}
+
+// update applies a button press to a listing and returns what to show
+func (l *listings) update(id string, action string) (paginate.Listing, int, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	paged, ok := l.byID[id]
+	if !ok || time.Since(paged.created) > listingLifetime {
+		return paginate.Listing{}, 0, false
+	}
+
+	switch action {
+	case "prev":
+		paged.page--
+	case "next":
+		paged.page++
+	case "sort":
+		paged.listing.Sort = paged.listing.Sort.Toggle()
+		paged.page = 0
+	}
+
+	pages := len(paged.listing.Pages())
+	paged.page = max(0, min(paged.page, pages-1))
+	return paged.listing, paged.page, true
+}
+
+// sendListing shows a listing as an embed with buttons to page through it,
+// falling back to plain messages where there are no buttons or the embed
+// can't be sent
+func (s *Server) sendListing(conn chat.Conn, channelID string, listing paginate.Listing) {
+	if !conn.SupportsComponents() {
+		sendListingMessages(conn, channelID, listing)
+		return
+	}
+	if _, err := conn.Send(channelID, s.firstPage(listing)); err != nil {
+		// Embeds need the Embed Links permission, plain text always works
+		log.Printf("Error sending listing embed, falling back to plain messages: %v", err)
+		sendListingMessages(conn, channelID, listing)
+	}
+}
+
+// sendListingMessages sends a whole listing as plain messages, or as much
+// of it as a throttled connection takes. Listings name the people who
+// added or changed things, which mustn't ping them.
+func sendListingMessages(conn chat.Conn, channelID string, listing paginate.Listing) {
+	messages := listing.Messages(paginate.MessageLimit)
+	if throttled, ok := conn.(chat.Throttled); ok && len(messages) > throttled.MaxMessages() {
+		limit := max(1, throttled.MaxMessages())
+		messages = append(messages[:limit], fmt.Sprintf("…truncated, %d more messages", len(messages)-limit))
+	}
+	for _, text := range messages {
+		if _, err := conn.Send(channelID, chat.Response{Text: text, NoMentions: true}); err != nil {
+			log.Printf("Error sending listing: %v", err)
+			return
+		}
+	}
+}
+
+// firstPage renders the first page of a listing, remembering the listing
+// if it has buttons
+func (s *Server) firstPage(listing paginate.Listing) chat.Response {
+	pages := listing.Pages()
+
+	response := chat.Response{Embeds: []chat.Embed{listingEmbed(listing, pages, 0)}, NoMentions: true}
+	if len(pages) > 1 || listing.Sort != paginate.SortNone {
+		id := s.listings.add(listing)
+		response.Buttons = listingButtons(id, listing, 0, len(pages))
+	}
+	return response
+}
+
+// handlePageButton moves a listing to another page or sort order
+func (s *Server) handlePageButton(session *discordgo.Session, i *discordgo.InteractionCreate, customID string) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(customID, pageButtonPrefix), ":")
+
+	listing, page, ok := s.listings.update(id, action)
+	if !ok {
+		respondEphemeral(session, i, "This listing has expired, run the command again.")
+		return
+	}
+
+	pages := listing.Pages()
+	err := session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: discordchat.InteractionData(chat.Response{
+			Embeds:  []chat.Embed{listingEmbed(listing, pages, page)},
+			Buttons: listingButtons(id, listing, page, len(pages)),
+		}),
+	})
+	if err != nil {
+		log.Printf("Error updating listing: %v", err)
+	}
+}
+
+// listingEmbed renders one page of a listing
+func listingEmbed(listing paginate.Listing, pages [][]string, page int) chat.Embed {
+	footer := fmt.Sprintf("Page %d of %d", page+1, len(pages))
+	if order := listing.Sort.Describe(); order != "" {
+		footer += " · Sorted " + order
+	}
+
+	return chat.Embed{
+		Title:       listing.Title,
+		Description: strings.Join(pages[page], "\n"),
+		Color:       listingColor,
+		Footer:      footer,
+	}
+}
+
+// listingButtons returns the previous, next and sort buttons of a listing
+func listingButtons(id string, listing paginate.Listing, page int, pages int) []chat.Button {
+	var buttons []chat.Button
+	if pages > 1 {
+		buttons = append(buttons,
+			chat.Button{
+				Label:    "◀ Previous",
+				ID:       pageButtonPrefix + id + ":prev",
+				Disabled: page == 0,
+			},
+			chat.Button{
+				Label:    "Next ▶",
+				ID:       pageButtonPrefix + id + ":next",
+				Disabled: page >= pages-1,
+			},
+		)
+	}
+	if listing.Sort != paginate.SortNone {
+		buttons = append(buttons, chat.Button{
+			Label: "Sort " + listing.Sort.Toggle().Describe(),
+			Style: chat.Primary,
+			ID:    pageButtonPrefix + id + ":sort",
+		})
+	}
+	return buttons
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"theListBot/internal/chat"
+	"theListBot/internal/permissions"
+)
+
+// allowed reports whether a member holds a capability in a guild. Every
+// direct message shares one list, so nobody may change it from a DM.
+func (s *Server) allowed(guildID string, member permissions.Member, c permissions.Capability) bool {
+	if guildID == "" {
+		return false
+	}
+	return permissions.Allowed(s.settings.Get(guildID).Rule, member, c)
+}
+
+// require checks that the author of a message holds a capability, and
+// politely says so when they don't
+func (s *Server) require(conn chat.Conn, msg chat.Message, c permissions.Capability) bool {
+	if s.allowed(msg.GuildID, conn.Member(msg), c) {
+		return true
+	}
+
+	log.Printf("Denied %s to %s (%s) in guild %q: %s", c, msg.Author.Name, msg.Author.ID, msg.GuildID, msg.Content)
+	reply(conn, msg, denial(msg.GuildID, c))
+	return false
+}
+
+// denial explains a missing capability
+func denial(guildID string, c permissions.Capability) string {
+	if guildID == "" {
+		return "Sorry, the list in direct messages is shared by everyone, so it can't be changed here. Use the bot in a server instead."
+	}
+	return fmt.Sprintf("Sorry, you need the `%s` permission to do that. A server admin can grant it with `!list perms grant %s [@role]`.", c, c)
+}
+
+// listCapability returns the capability a !list command needs, if any
+func listCapability(parts []string) (permissions.Capability, bool) {
+	switch parts[1] {
+	case "add", "tag", "weight", "alias":
+		return permissions.Add, true
+	case "mode":
+		// Showing the mode is open to everyone, changing it isn't
+		return permissions.Add, len(parts) >= 4
+	case "remove":
+		if len(parts) >= 4 {
+			return permissions.Remove, true
+		}
+		return permissions.RemoveCode, true
+	case "revert":
+		return permissions.RemoveCode, true
+	case "import":
+		return permissions.Import, true
+	case "approve", "reject":
+		return permissions.Review, true
+	case "suggest", "review", "cooldown":
+		// Showing the setting is open to everyone, changing it isn't
+		return permissions.Admin, len(parts) >= 3
+	case "perms":
+		return permissions.Admin, len(parts) >= 3
+	}
+	return "", false
+}
+
+// handlePermsCommand shows and changes who holds each capability
+func (s *Server) handlePermsCommand(conn chat.Conn, msg chat.Message, parts []string) {
+	if len(parts) < 3 {
+		guild := s.settings.Get(msg.GuildID)
+		lines := []string{"**Permissions:**"}
+		for _, c := range permissions.Capabilities {
+			lines = append(lines, fmt.Sprintf("`%s`: %s", c, guild.Rule(c).Describe()))
+		}
+		lines = append(lines, "Server administrators can always do everything, and `admin` includes every other permission.")
+		// Mentions in the listing shouldn't ping anyone
+		_, err := conn.Send(msg.ChannelID, chat.Response{Text: strings.Join(lines, "\n"), NoMentions: true})
+		if err != nil {
+			log.Printf("Error sending permissions: %v", err)
+		}
+		return
+	}
+
+	usage := "Usage: !list perms [grant|revoke] [capability] [@user|@role|everyone|" +
+		strings.Join(permissions.PermissionNames(), "|") + "] or !list perms reset [capability]"
+	if len(parts) < 4 {
+		reply(conn, msg, usage)
+		return
+	}
+
+	c, err := permissions.ParseCapability(parts[3])
+	if err != nil {
+		reply(conn, msg, "Error: "+err.Error())
+		return
+	}
+
+	switch parts[2] {
+	case "grant", "revoke":
+		if len(parts) < 5 {
+			reply(conn, msg, usage)
+			return
+		}
+		grantee, err := permissions.ParseGrantee(parts[4])
+		if err != nil {
+			reply(conn, msg, "Error: "+err.Error())
+			return
+		}
+		err = s.settings.SetRule(msg.GuildID, c, func(rule permissions.Rule) permissions.Rule {
+			if parts[2] == "grant" {
+				return rule.With(grantee)
+			}
+			return rule.Without(grantee)
+		})
+		if err != nil {
+			log.Printf("Error saving settings: %v", err)
+			reply(conn, msg, "Error: failed to save the setting")
+			return
+		}
+
+	case "reset":
+		if err := s.settings.ResetRule(msg.GuildID, c); err != nil {
+			log.Printf("Error saving settings: %v", err)
+			reply(conn, msg, "Error: failed to save the setting")
+			return
+		}
+
+	default:
+		reply(conn, msg, usage)
+		return
+	}
+
+	rule := s.settings.Get(msg.GuildID).Rule(c)
+	log.Printf("%s changed %s permission in guild %q: %+v", msg.Author.ID, c, msg.GuildID, rule)
+	_, err = conn.Send(msg.ChannelID, chat.Response{Text: fmt.Sprintf("`%s` is now held by %s", c, rule.Describe()), NoMentions: true})
+	if err != nil {
+		log.Printf("Error sending permissions: %v", err)
+	}
+}
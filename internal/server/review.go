@@ -0,0 +1,189 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"theListBot/internal/chat"
+	"theListBot/internal/chat/discordchat"
+	"theListBot/internal/permissions"
+	"theListBot/internal/review"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// reviewButtonPrefix starts the custom ID of the approve and reject buttons
+const reviewButtonPrefix = "review:"
+
+// Colors of review messages
+const (
+	reviewPendingColor  = 0xFEE75C
+	reviewApprovedColor = 0x57F287
+	reviewRejectedColor = 0xED4245
+)
+
+// submitGif queues a GIF for review instead of adding it, and returns the
+// reply for the submitter
+func (s *Server) submitGif(conn chat.Conn, guildID string, channelID string, userID string, code string, url string) string {
+	submission, err := s.reviews.ForGuild(guildID).Add(review.Submission{
+		Code:      code,
+		URL:       url,
+		By:        userID,
+		ChannelID: channelID,
+	})
+	if err != nil {
+		log.Printf("Error queueing submission: %v", err)
+		return "Error: " + err.Error()
+	}
+
+	log.Printf("Queued submission #%d for code %s: %s", submission.ID, code, url)
+	reply := fmt.Sprintf("Thanks! Your GIF for `%s` is waiting for a moderator to approve it (submission #%d).", code, submission.ID)
+
+	reviewChannel := s.settings.Get(guildID).ReviewChannel
+	if reviewChannel == "" {
+		return reply
+	}
+
+	messageID, err := conn.Send(reviewChannel, chat.Response{
+		Embeds:  []chat.Embed{reviewEmbed(submission, "", reviewPendingColor)},
+		Buttons: reviewButtons(submission.ID),
+	})
+	if err != nil {
+		log.Printf("Error posting submission #%d for review: %v", submission.ID, err)
+		return reply
+	}
+	if err := s.reviews.ForGuild(guildID).SetReviewMessage(submission.ID, reviewChannel, messageID); err != nil {
+		log.Printf("Error recording review message of submission #%d: %v", submission.ID, err)
+	}
+	return reply
+}
+
+// decideSubmission approves or rejects a submission. Approved GIFs are
+// added in the submitter's name. The returned text describes the outcome.
+func (s *Server) decideSubmission(conn chat.Conn, guildID string, id int, approve bool, moderatorID string) (review.Submission, string, error) {
+	submission, found, err := s.reviews.ForGuild(guildID).Take(id)
+	if err != nil {
+		return review.Submission{}, "", err
+	}
+	if !found {
+		return review.Submission{}, "", fmt.Errorf("submission #%d was already handled or doesn't exist", id)
+	}
+
+	verdict := "Rejected"
+	if approve {
+		verdict = "Approved"
+		if err := s.gifLists.ForGuild(guildID).AddGifBy(submission.Code, submission.URL, submission.By); err != nil {
+			// It's out of the queue either way, the list may have changed since it was submitted
+			log.Printf("Error adding approved submission #%d: %v", id, err)
+			verdict = "Approved, but it couldn't be added: " + err.Error()
+		}
+	}
+	outcome := fmt.Sprintf("%s by <@%s>", verdict, moderatorID)
+	log.Printf("Submission #%d for code %s: %s", id, submission.Code, outcome)
+
+	// Let the submitter know where they asked
+	conn.Send(submission.ChannelID, chat.Text(fmt.Sprintf("<@%s> your GIF for `%s` (submission #%d) was %s.", submission.By, submission.Code, id, strings.ToLower(verdict))))
+
+	return submission, outcome, nil
+}
+
+// handleReviewButton applies an approve or reject button press
+func (s *Server) handleReviewButton(session *discordgo.Session, i *discordgo.InteractionCreate, customID string) {
+	action, idText, _ := strings.Cut(strings.TrimPrefix(customID, reviewButtonPrefix), ":")
+	id, err := strconv.Atoi(idText)
+	if err != nil || i.Member == nil {
+		respondEphemeral(session, i, "This button doesn't work here.")
+		return
+	}
+
+	if !s.allowed(i.GuildID, discordchat.InteractionMember(i), permissions.Review) {
+		log.Printf("Denied review of submission #%d to %s", id, i.Member.User.ID)
+		respondEphemeral(session, i, denial(i.GuildID, permissions.Review))
+		return
+	}
+
+	submission, outcome, err := s.decideSubmission(discordchat.New(session), i.GuildID, id, action == "approve", i.Member.User.ID)
+	if err != nil {
+		respondEphemeral(session, i, "Error: "+err.Error())
+		return
+	}
+
+	color := reviewRejectedColor
+	if action == "approve" {
+		color = reviewApprovedColor
+	}
+	err = session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     discordchat.Embeds([]chat.Embed{reviewEmbed(submission, outcome, color)}),
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		log.Printf("Error updating review message: %v", err)
+	}
+}
+
+// closeReviewMessage replaces the buttons of a submission's review message
+// with the outcome, when it was decided with a command instead
+func closeReviewMessage(conn chat.Conn, submission review.Submission, outcome string, color int) {
+	if submission.ReviewMessageID == "" {
+		return
+	}
+
+	err := conn.Edit(submission.ReviewChannelID, submission.ReviewMessageID, chat.Response{
+		Embeds: []chat.Embed{reviewEmbed(submission, outcome, color)},
+	})
+	if err != nil {
+		log.Printf("Error closing review message of submission #%d: %v", submission.ID, err)
+	}
+}
+
+// reviewEmbed shows a submission, and its outcome once decided
+func reviewEmbed(submission review.Submission, outcome string, color int) chat.Embed {
+	embed := chat.Embed{
+		Title:       fmt.Sprintf("New GIF for `%s`", submission.Code),
+		Description: fmt.Sprintf("Submitted by <@%s> in <#%s>\n%s", submission.By, submission.ChannelID, submission.URL),
+		Color:       color,
+		ImageURL:    submission.URL,
+		Footer:      fmt.Sprintf("Submission #%d", submission.ID),
+		Timestamp:   submission.At,
+	}
+	if outcome != "" {
+		embed.Fields = []chat.Field{{Name: "Outcome", Value: outcome}}
+	}
+	return embed
+}
+
+// reviewButtons returns the approve and reject buttons of a submission
+func reviewButtons(id int) []chat.Button {
+	return []chat.Button{
+		{Label: "Approve", Style: chat.Success, ID: fmt.Sprintf("%sapprove:%d", reviewButtonPrefix, id)},
+		{Label: "Reject", Style: chat.Danger, ID: fmt.Sprintf("%sreject:%d", reviewButtonPrefix, id)},
+	}
+}
+
+// parseChannelMention accepts a channel mention like <#123> or a bare ID
+func parseChannelMention(value string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(value, "<#"), ">")
+}
+
+// checkChannelGuild makes sure a channel given by a user is in their guild.
+// The bot can post in every guild it's in, so review posts could otherwise
+// be sent to another guild.
+func checkChannelGuild(conn chat.Conn, channelID string, guildID string) error {
+	channels, ok := conn.(chat.ChannelGuilds)
+	if !ok {
+		// The connection only serves one guild
+		return nil
+	}
+	channelGuild, err := channels.ChannelGuild(channelID)
+	if err != nil {
+		return fmt.Errorf("channel %s not found", channelID)
+	}
+	if channelGuild != guildID {
+		return fmt.Errorf("<#%s> isn't a channel of this server", channelID)
+	}
+	return nil
+}
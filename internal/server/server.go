@@ -1,15 +1,30 @@
 package server
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
-	"regexp"
+	"path"
+	"strconv"
 	"strings"
 	"syscall"
+	"theListBot/internal/api"
+	"theListBot/internal/chat"
+	"theListBot/internal/chat/discordchat"
+	"theListBot/internal/chat/ircchat"
 	"theListBot/internal/combo" // Import the combo package
+	"theListBot/internal/cooldown"
 	"theListBot/internal/giflist"
+	"theListBot/internal/linkcheck"
+	"theListBot/internal/paginate"
+	"theListBot/internal/permissions"
+	"theListBot/internal/review"
+	"theListBot/internal/settings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
@@ -18,26 +33,48 @@ import (
 
 type Server struct {
 	discordSession *discordgo.Session
-	gifList        *giflist.GifList
-	comboTracker   *combo.ComboTracker // Add the combo tracker
+	gifLists       *giflist.Registry  // One isolated gif list per guild
+	combos         *combo.Registry    // One set of counts and combos per guild
+	settings       *settings.Registry // Per-guild settings changed with commands
+	reviews        *review.Registry   // Per-guild queues of additions awaiting a moderator
 	done           chan os.Signal
+	stopLinkCheck  context.CancelFunc // Stops the background link checker
+	stopIRC        context.CancelFunc // Disconnects from IRC, nil when IRC is off
+	apiServer      *http.Server       // Admin API, nil when it is off
+	listings       listings           // Paged listings whose buttons still work
+	cooldowns      *cooldown.Limiter  // Recent code responses, for rate limiting
 }
 
 func NewServer() *Server {
-	// Define the file path for lifetime counts
-	filePath := "lifetime_counts.json"
+	s := newServer(giflist.NewRegistry())
 
+	// Counts from before each guild had its own go with the legacy gif list
+	if guild := s.gifLists.DefaultGuild(); guild != "" {
+		if err := s.combos.MigrateLegacyFile("lifetime_counts.json", guild); err != nil {
+			log.Printf("Warning: Failed to migrate legacy lifetime counts: %v", err)
+		}
+	}
+	return s
+}
+
+// newServer creates a Server around gif lists, keeping every other
+// per-guild file beside each guild's list
+func newServer(gifLists *giflist.Registry) *Server {
 	return &Server{
-		gifList:      giflist.NewGifList(),
-		comboTracker: combo.NewComboTracker(600*time.Second, filePath), // Pass the file path
-		done:         make(chan os.Signal, 1),
+		gifLists:  gifLists,
+		combos:    combo.NewRegistry(600*time.Second, gifLists.GuildDir),
+		settings:  settings.NewRegistry(gifLists.GuildDir),
+		reviews:   review.NewRegistry(gifLists.GuildDir),
+		cooldowns: cooldown.New(),
+		done:      make(chan os.Signal, 1),
 	}
 }
 
 func (s *Server) Start() {
+	// The environment may come from elsewhere, such as the systemd unit
 	err := godotenv.Load()
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		log.Printf("No .env file loaded, using the environment as is: %v", err)
 	}
 
 	token := os.Getenv("DISCORD_TOKEN")
@@ -51,37 +88,92 @@ func (s *Server) Start() {
 		log.Fatalf("Error creating Discord session: %v", err)
 	}
 
-	// Set required intents to receive message events
-	s.discordSession.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentsDirectMessages
+	// Set required intents to receive message events. Guilds fills the
+	// state cache with the roles and channels permission checks need.
+	s.discordSession.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages | discordgo.IntentsDirectMessages
 
 	// Register message handler
 	s.discordSession.AddHandler(s.messageHandler)
+	s.discordSession.AddHandler(s.interactionHandler)
 
 	err = s.discordSession.Open()
 	if err != nil {
 		log.Fatalf("Error opening connection to Discord: %v", err)
 	}
 
+	// Slash commands work without the message content intent
+	s.registerCommands(s.discordSession)
+
 	log.Println("Bot is now running and listening for commands. Press CTRL+C to exit.")
 
+	// Serve the same codes on IRC when a server is configured
+	if cfg := ircchat.ConfigFromEnv(); cfg.Enabled() {
+		s.startIRC(cfg)
+	}
+
+	// Let other tools manage the lists over HTTP
+	if cfg := api.ConfigFromEnv(); cfg.Enabled() {
+		s.startAPI(cfg)
+	} else if cfg.Addr != "" {
+		log.Println("GIFLIST_API_ADDR is set but GIFLIST_API_TOKENS is empty, not starting the admin API")
+	}
+
 	// Start the daily reset ticker
 	go s.dailyResetTicker()
 
-	// Wait for a termination signal
-	signal.Notify(s.done, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-	<-s.done
+	// Periodically persist GIF pick statistics
+	go s.statsFlushTicker()
+
+	// Periodically look for GIF links that stopped working
+	if interval := linkcheck.Interval(); interval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopLinkCheck = cancel
+		go s.linkCheckTicker(ctx, interval)
+	} else {
+		log.Println("Link checker disabled")
+	}
+
+	// Pick up edits made to the gif list files while the bot is running
+	if interval := giflist.ReloadInterval(); interval > 0 {
+		go s.reloadTicker(interval)
+	}
+
+	// Wait for a termination signal, reloading the gif lists on SIGHUP
+	signal.Notify(s.done, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, os.Interrupt)
+	for sig := range s.done {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		log.Println("Received SIGHUP, reloading gif lists")
+		s.gifLists.ReloadAll()
+	}
 
 	// Clean up before exiting
 	s.Stop()
 }
 
 func (s *Server) Stop() {
+	if s.stopLinkCheck != nil {
+		s.stopLinkCheck()
+	}
+	if s.stopIRC != nil {
+		s.stopIRC()
+	}
+	if s.apiServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := s.apiServer.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down admin API: %v", err)
+		}
+		cancel()
+	}
 	if s.discordSession != nil {
 		log.Println("Closing Discord session...")
 		s.discordSession.Close()
 	}
 	// Stop the combo tracker to save lifetime counts
-	s.comboTracker.Stop()
+	s.combos.Stop()
+	// Release the gif list stores
+	s.gifLists.Close()
 	log.Println("Server shutdown complete")
 }
 
@@ -96,11 +188,77 @@ func (s *Server) dailyResetTicker() {
 
 	ticker := time.NewTicker(24 * time.Hour)
 	for range ticker.C {
-		s.comboTracker.ResetDailyCounts()
+		s.combos.ResetDailyCounts()
 		log.Println("Daily counts reset at midnight")
 	}
 }
 
+// statsFlushTicker writes pick statistics to storage every few minutes so
+// picking a GIF never has to wait on disk
+func (s *Server) statsFlushTicker() {
+	ticker := time.NewTicker(5 * time.Minute)
+	for range ticker.C {
+		s.gifLists.FlushAll()
+	}
+}
+
+// reloadTicker watches the gif list stores for outside edits
+func (s *Server) reloadTicker(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	for range ticker.C {
+		s.gifLists.ReloadChanged()
+	}
+}
+
+// linkCheckTicker probes every stored GIF URL on an interval so dead links
+// stop being posted
+func (s *Server) linkCheckTicker(ctx context.Context, interval time.Duration) {
+	checker := linkcheck.NewChecker()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.gifLists.CheckAllLinks(ctx, checker)
+		}
+	}
+}
+
+// startIRC connects to an IRC network in the background. Its messages go
+// through handleMessage like Discord's, using the gif list of cfg.Guild.
+func (s *Server) startIRC(cfg ircchat.Config) {
+	if err := cfg.Validate(); err != nil {
+		log.Printf("Not connecting to IRC: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopIRC = cancel
+
+	log.Printf("Connecting to IRC server %s as %s, joining %s", cfg.Server, cfg.Nick, strings.Join(cfg.Channels, ", "))
+	client := ircchat.New(cfg, s.handleMessage)
+	go client.Run(ctx)
+}
+
+// startAPI serves the admin API in the background
+func (s *Server) startAPI(cfg api.Config) {
+	s.apiServer = &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           api.New(s.gifLists, s.combos, cfg.Tokens),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	log.Printf("Serving admin API on %s", cfg.Addr)
+	go func() {
+		if err := s.apiServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Admin API stopped: %v", err)
+		}
+	}()
+}
+
 // messageHandler processes Discord message events
 func (s *Server) messageHandler(session *discordgo.Session, m *discordgo.MessageCreate) {
 	// Ignore messages from the bot itself
@@ -108,228 +266,900 @@ func (s *Server) messageHandler(session *discordgo.Session, m *discordgo.Message
 		return
 	}
 
+	s.handleMessage(discordchat.New(session), discordchat.Message(m))
+}
+
+// handleMessage runs the command or code in a message from any platform
+func (s *Server) handleMessage(conn chat.Conn, msg chat.Message) {
 	// Only log commands and matched codes, not regular messages
 	// Regular message logging removed here
 
 	// Handle admin commands for managing GIFs
-	if strings.HasPrefix(m.Content, "!list") {
-		log.Printf("Command from %s: %s", m.Author.Username, m.Content)
-		s.handleListCommand(session, m)
+	if strings.HasPrefix(msg.Content, "!list") {
+		log.Printf("Command from %s: %s", msg.Author.Name, msg.Content)
+		s.handleListCommand(conn, msg)
 		return
 	}
 
 	// Handle combo commands
-	if strings.HasPrefix(m.Content, "!counts") {
-		log.Printf("Command from %s: %s", m.Author.Username, m.Content)
-		s.handleComboCommand(session, m)
+	if strings.HasPrefix(msg.Content, "!counts") {
+		log.Printf("Command from %s: %s", msg.Author.Name, msg.Content)
+		s.handleComboCommand(conn, msg)
 		return
 	}
 
 	// Check for 2-character codes in the message
-	s.processMessageForCodes(session, m)
+	s.processMessageForCodes(conn, msg)
 }
 
 // processMessageForCodes looks for 2-character codes at the start of messages
-func (s *Server) processMessageForCodes(session *discordgo.Session, m *discordgo.MessageCreate) {
+func (s *Server) processMessageForCodes(conn chat.Conn, msg chat.Message) {
 	// Remove verbose logging for every message check
-	// log.Printf("Checking message for codes: %s", m.Content)
+	// log.Printf("Checking message for codes: %s", msg.Content)
 
-	// Updated regex to only match at the beginning of the message
-	// ^(?i) - Start of string + case insensitive
-	// ([a-zA-Z]{2}) - Two letters as our code
-	// (\b|$|[^a-zA-Z]) - Must be followed by word boundary, end of string, or non-letter
-	codePattern := regexp.MustCompile(`^(?i)([a-zA-Z0-9\.]+)$`)
+	// A message triggers a code only if the whole message is a code that the
+	// guild's code policy would also accept in !list add
+	gifList := s.gifLists.ForGuild(msg.GuildID)
+	code, matched := gifList.MatchCode(msg.Content)
 
-	// Debug regex logging removed
-	// log.Printf("Using regex pattern: %s", codePattern.String())
-
-	// Find the match at the start of the message
-	match := codePattern.FindStringSubmatch(m.Content)
+	if matched {
+		// Only log when we've identified a code
+		log.Printf("Code match from %s: %s", msg.Author.Name, code)
 
-	if len(match) >= 2 {
-		code := strings.ToLower(match[1]) // Extract the code and convert to lowercase
+		// Aliases share their target's pool, so count usage under the canonical code
+		code = gifList.Resolve(code)
+		combos := s.combos.ForGuild(msg.GuildID)
 
-		// Only log when we've identified a code
-		log.Printf("Code match from %s: %s", m.Author.Username, code)
+		// Rate limited uses get no response, but may still count. Words that
+		// merely look like codes mustn't use up anyone's cooldown.
+		if gifList.HasPostableGifs(code) {
+			if limited, cfg := s.rateLimited(conn, msg, code); limited {
+				if !cfg.NoCount {
+					combos.RecordCode(msg.Author.ID, code)
+				}
+				return
+			}
+		}
 
 		// Record the code usage and get the counts
-		dailyCount, userCombo, comboEvent := s.comboTracker.RecordCode(m.Author.ID, code)
-		log.Printf("Code %s used by %s. Daily count: %d, User combo: %d", code, m.Author.Username, dailyCount, userCombo)
+		dailyCount, userCombo, comboEvent := combos.RecordCode(msg.Author.ID, code)
+		log.Printf("Code %s used by %s. Daily count: %d, User combo: %d", code, msg.Author.Name, dailyCount, userCombo)
 
-		if gifURL, found := s.gifList.GetGif(code); found {
-			log.Printf("Sending GIF for code %s: %s", code, gifURL)
+		if gif, found := gifList.PickGif(code, msg.ChannelID); found {
+			log.Printf("Sending GIF for code %s: %s", code, gif.URL)
 
-			// Respond with the gif
-			_, err := session.ChannelMessageSend(m.ChannelID, gifURL)
+			// Respond with the gif, or its local copy if the link is dead
+			err := s.sendGif(conn, msg.ChannelID, gifList, gif, code, msg.Author.ID)
 			if err != nil {
 				log.Printf("Error sending GIF response: %v", err)
 			}
 
 			// Check if there is a combo event and send the combo message and GIF
 			if comboEvent != nil {
-				_, err = session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("%s %s", comboEvent.Message, comboEvent.GifURL))
+				_, err = reply(conn, msg, fmt.Sprintf("%s %s", comboEvent.Message, comboEvent.GifURL))
 				if err != nil {
 					log.Printf("Error sending combo message: %v", err)
 				}
 			}
 		} else {
 			log.Printf("No GIF found for code: %s", code)
+
+			// Channels can opt in to hearing about near misses
+			if s.settings.Get(msg.GuildID).Suggests(msg.ChannelID) {
+				if hint := didYouMean(gifList, code); hint != "" {
+					reply(conn, msg, strings.TrimSpace(hint))
+				}
+			}
 		}
 	}
 	// Removed logging for no code found - too verbose
 }
 
+// reply answers a message in its channel
+func reply(conn chat.Conn, msg chat.Message, text string) (string, error) {
+	return conn.Send(msg.ChannelID, chat.Text(text))
+}
+
 // handleListCommand processes commands for managing the gif list
-func (s *Server) handleListCommand(session *discordgo.Session, m *discordgo.MessageCreate) {
-	parts := strings.Fields(m.Content)
+func (s *Server) handleListCommand(conn chat.Conn, msg chat.Message) {
+	// Every list command is scoped to the guild it was sent from
+	gifList := s.gifLists.ForGuild(msg.GuildID)
+
+	parts := strings.Fields(msg.Content)
 	if len(parts) < 2 {
 		log.Println("Showing list command help")
 		// Display help message
-		session.ChannelMessageSend(m.ChannelID, "Available commands:\n"+
-			"!list show - Display all available codes\n"+
+		reply(conn, msg, "Available commands:\n"+
+			"!list show [by name|usage] - Display all available codes\n"+
 			"!list show [code] - Show all GIFs for a specific code\n"+
 			"!list add [code] [url] - Add a new GIF\n"+
 			"!list remove [code] - Remove all GIFs for a code\n"+
 			"!list remove [code] [url] - Remove a specific GIF\n"+
+			"!list info [code] - Show who added each GIF and how often it's picked\n"+
+			"!list tag [code] [url] [tags...] - Set the tags of a GIF\n"+
+			"!list weight [code] [url] [weight] - Make a GIF more or less likely to be picked\n"+
+			"!list mode [code] [mode] - Pick GIFs at random, shuffled, or in order\n"+
+			"!list alias [alias] [code] - Make a code share another code's GIFs\n"+
+			"!list history [code] - Show recent changes to the list\n"+
+			"!list revert [change-id] - Undo a change\n"+
+			"!list search [query] - Find GIFs by code, tag or link\n"+
+			"!list suggest [on|off] - Suggest codes when an unknown one is typed here\n"+
+			"!list review [on|off] - Hold new GIFs for moderator approval\n"+
+			"!list pending - Show GIFs waiting for review\n"+
+			"!list perms - Show or change who can use which commands\n"+
+			"!list cooldown - Show or change how often codes get a response\n"+
+			"!list broken - Show GIFs whose links stopped working\n"+
+			"!list export - Download the list as a file\n"+
+			"!list import [strategy] [dry-run] - Load a list from an attached file\n"+
 			"!list help - Show detailed help")
 		return
 	}
 
+	if c, needed := listCapability(parts); needed && !s.require(conn, msg, c) {
+		return
+	}
+
 	switch parts[1] {
 	case "show":
-		if len(parts) >= 3 {
+		// "!list show by name|usage" sorts the code list, anything else is a
+		// code. "by" is only a keyword when a sort order follows, so a code
+		// named by can still be shown.
+		order, sorted := paginate.SortName, false
+		if len(parts) >= 4 && parts[2] == "by" {
+			order, sorted = paginate.ParseSortOrder(parts[3])
+		}
+		if len(parts) >= 3 && !sorted {
 			// Show all GIFs for a specific code
 			code := strings.ToLower(parts[2])
 			log.Printf("Showing GIFs for code: %s", code)
 
-			urls, found := s.gifList.GetAllGifsForCode(code)
-			if !found || len(urls) == 0 {
-				session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("No GIFs found for code: %s", code))
+			listing, found := codeListing(gifList, code)
+			if !found {
+				reply(conn, msg, fmt.Sprintf("No GIFs found for code: %s.", code)+didYouMean(gifList, code))
 				return
 			}
-
-			message := fmt.Sprintf("**GIFs for code `%s` (%d):**\n", code, len(urls))
-			for i, url := range urls {
-				message += fmt.Sprintf("%d. %s\n", i+1, url)
-			}
-
-			session.ChannelMessageSend(m.ChannelID, message)
+			s.sendListing(conn, msg.ChannelID, listing)
 		} else {
 			// Show all codes with counts
 			log.Println("Processing list show command")
-			codeDetails := s.gifList.ListCodesWithCounts()
 
-			if len(codeDetails) == 0 {
+			listing, found := codesListing(gifList, order)
+			if !found {
 				log.Println("No codes available to show")
-				session.ChannelMessageSend(m.ChannelID, "No codes available yet.")
+				reply(conn, msg, "No codes available yet.")
 				return
 			}
-
-			message := fmt.Sprintf("**Available codes (%d):**\n", len(codeDetails))
-			for _, detail := range codeDetails {
-				message += fmt.Sprintf("`%s` (%d GIFs)\n", detail.Code, detail.GifCount)
-			}
-
-			session.ChannelMessageSend(m.ChannelID, message)
+			s.sendListing(conn, msg.ChannelID, listing)
 		}
 
 	case "add":
 		if len(parts) < 4 {
 			log.Println("Invalid add command format")
-			session.ChannelMessageSend(m.ChannelID, "Usage: !list add [code] [url]")
+			reply(conn, msg, "Usage: !list add [code] [url]")
+			return
+		}
+
+		reply(conn, msg, s.addGif(conn, msg.GuildID, msg.ChannelID, conn.Member(msg), strings.ToLower(parts[2]), parts[3]))
+
+	case "remove":
+		if len(parts) < 3 {
+			log.Println("Invalid remove command format")
+			reply(conn, msg, "Usage: !list remove [code] or !list remove [code] [url]")
+			return
+		}
+
+		// A URL removes just that GIF, otherwise the whole code goes
+		url := ""
+		if len(parts) >= 4 {
+			url = parts[3]
+		}
+		reply(conn, msg, removeGif(gifList, strings.ToLower(parts[2]), url, msg.Author.ID))
+
+	case "info":
+		if len(parts) < 3 {
+			reply(conn, msg, "Usage: !list info [code]")
+			return
+		}
+
+		code := strings.ToLower(parts[2])
+		log.Printf("Showing GIF info for code: %s", code)
+		listing, found := infoListing(gifList, code)
+		if !found {
+			reply(conn, msg, fmt.Sprintf("No GIFs found for code: %s.", code)+didYouMean(gifList, code))
+			return
+		}
+		s.sendListing(conn, msg.ChannelID, listing)
+
+	case "tag":
+		if len(parts) < 4 {
+			reply(conn, msg, "Usage: !list tag [code] [url] [tags...]")
 			return
 		}
 
 		code := strings.ToLower(parts[2])
 		url := parts[3]
-		log.Printf("Adding GIF for code %s: %s", code, url)
+		tags := make([]string, 0, len(parts)-4)
+		for _, tag := range parts[4:] {
+			tags = append(tags, strings.ToLower(tag))
+		}
 
-		if err := s.gifList.AddGif(code, url); err != nil {
-			log.Printf("Error adding GIF: %v", err)
-			session.ChannelMessageSend(m.ChannelID, "Error: "+err.Error())
+		if !gifList.SetTags(code, url, tags, msg.Author.ID) {
+			reply(conn, msg, fmt.Sprintf("URL not found for code: %s", code))
 			return
 		}
 
-		urls, _ := s.gifList.GetAllGifsForCode(code)
-		log.Printf("Successfully added GIF for code: %s (now has %d GIFs)", code, len(urls))
-		session.ChannelMessageSend(m.ChannelID,
-			fmt.Sprintf("Added GIF for code: `%s` → %s (now has %d GIFs)", code, url, len(urls)))
+		if len(tags) == 0 {
+			reply(conn, msg, fmt.Sprintf("Cleared tags for GIF in code `%s`", code))
+		} else {
+			reply(conn, msg, fmt.Sprintf("Tagged GIF in code `%s`: %s", code, strings.Join(tags, ", ")))
+		}
 
-	case "remove":
+	case "weight":
+		if len(parts) < 5 {
+			reply(conn, msg, "Usage: !list weight [code] [url] [weight]")
+			return
+		}
+
+		code := strings.ToLower(parts[2])
+		url := parts[3]
+		weight, err := strconv.Atoi(parts[4])
+		if err != nil {
+			reply(conn, msg, "Error: weight must be a whole number")
+			return
+		}
+
+		if err := gifList.SetWeight(code, url, weight, msg.Author.ID); err != nil {
+			log.Printf("Error setting weight: %v", err)
+			reply(conn, msg, "Error: "+err.Error())
+			return
+		}
+
+		message := fmt.Sprintf("Set weight of GIF in code `%s` to %d", code, weight)
+		// Shuffle and round-robin deal every GIF equally, so say when the weight won't matter yet
+		if mode, _ := gifList.GetMode(code); mode != giflist.ModeRandom {
+			message += fmt.Sprintf(". Weights only apply in random mode, `%s` is in %s mode; use `!list mode %s random` to use them", code, mode, code)
+		}
+		reply(conn, msg, message)
+
+	case "mode":
 		if len(parts) < 3 {
-			log.Println("Invalid remove command format")
-			session.ChannelMessageSend(m.ChannelID, "Usage: !list remove [code] or !list remove [code] [url]")
+			reply(conn, msg, "Usage: !list mode [code] [random|shuffle|roundrobin]")
 			return
 		}
 
 		code := strings.ToLower(parts[2])
+		if len(parts) == 3 {
+			mode, found := gifList.GetMode(code)
+			if !found {
+				reply(conn, msg, fmt.Sprintf("Code not found: %s", code))
+				return
+			}
+			reply(conn, msg, fmt.Sprintf("Code `%s` uses %s mode", code, mode))
+			return
+		}
+
+		mode, err := giflist.ParseSelectionMode(parts[3])
+		if err != nil {
+			reply(conn, msg, "Error: "+err.Error())
+			return
+		}
+
+		if !gifList.SetMode(code, mode, msg.Author.ID) {
+			reply(conn, msg, fmt.Sprintf("Code not found: %s", code))
+			return
+		}
+
+		log.Printf("Set selection mode for code %s to %s", code, mode)
+		reply(conn, msg, fmt.Sprintf("Code `%s` now uses %s mode", code, mode))
+
+	case "alias":
+		if len(parts) < 4 {
+			reply(conn, msg, "Usage: !list alias [alias] [code]")
+			return
+		}
+
+		alias := strings.ToLower(parts[2])
+		target := strings.ToLower(parts[3])
+		log.Printf("Setting alias %s -> %s", alias, target)
+
+		if err := gifList.SetAlias(alias, target, msg.Author.ID); err != nil {
+			log.Printf("Error setting alias: %v", err)
+			reply(conn, msg, "Error: "+err.Error())
+			return
+		}
+
+		reply(conn, msg, fmt.Sprintf("`%s` is now an alias of `%s`", alias, target))
+
+	case "history":
+		code := ""
+		if len(parts) >= 3 {
+			code = strings.ToLower(parts[2])
+		}
+		log.Printf("Showing change history for code: %q", code)
+
+		listing, found := historyListing(gifList, code)
+		if !found {
+			reply(conn, msg, "No changes recorded yet.")
+			return
+		}
+		s.sendListing(conn, msg.ChannelID, listing)
+
+	case "revert":
+		if len(parts) < 3 {
+			reply(conn, msg, "Usage: !list revert [change-id] [force]")
+			return
+		}
+
+		changeID, err := strconv.Atoi(strings.TrimPrefix(parts[2], "#"))
+		if err != nil {
+			reply(conn, msg, "Error: change ID must be a number, see `!list history`")
+			return
+		}
+		force := len(parts) >= 4 && strings.EqualFold(parts[3], "force")
+
+		log.Printf("Reverting change %d (force: %v)", changeID, force)
+		revert, err := gifList.Revert(changeID, msg.Author.ID, force)
+		if err != nil {
+			log.Printf("Error reverting change: %v", err)
+			reply(conn, msg, "Error: "+err.Error())
+			return
+		}
+
+		reply(conn, msg, fmt.Sprintf("Reverted change #%d to `%s` (recorded as #%d)", changeID, revert.Code, revert.ID))
+
+	case "search":
+		if len(parts) < 3 {
+			reply(conn, msg, "Usage: !list search [query]")
+			return
+		}
+
+		query := strings.Join(parts[2:], " ")
+		log.Printf("Searching for %q", query)
+
+		results := gifList.Search(query)
+		if len(results) == 0 {
+			reply(conn, msg, fmt.Sprintf("Nothing matches \"%s\".", query)+didYouMean(gifList, strings.ToLower(query)))
+			return
+		}
+		s.sendListing(conn, msg.ChannelID, searchListing(query, results))
 
-		// Check if we're removing a specific URL
+	case "suggest":
+		if len(parts) < 3 || (parts[2] != "on" && parts[2] != "off") {
+			enabled := s.settings.Get(msg.GuildID).Suggests(msg.ChannelID)
+			state := "off"
+			if enabled {
+				state = "on"
+			}
+			reply(conn, msg, fmt.Sprintf("\"Did you mean\" replies are %s in this channel. Usage: !list suggest [on|off]", state))
+			return
+		}
+
+		enabled := parts[2] == "on"
+		log.Printf("Setting suggestions in channel %s to %v", msg.ChannelID, enabled)
+		if err := s.settings.SetSuggest(msg.GuildID, msg.ChannelID, enabled); err != nil {
+			log.Printf("Error saving settings: %v", err)
+			reply(conn, msg, "Error: failed to save the setting")
+			return
+		}
+
+		if enabled {
+			reply(conn, msg, "Unknown codes in this channel will now get \"did you mean\" replies")
+		} else {
+			reply(conn, msg, "Unknown codes in this channel will no longer get replies")
+		}
+
+	case "review":
+		if len(parts) < 3 || (parts[2] != "on" && parts[2] != "off") {
+			guild := s.settings.Get(msg.GuildID)
+			state := "off"
+			if guild.Moderation {
+				state = "on"
+				if guild.ReviewChannel != "" {
+					state += fmt.Sprintf(", submissions are posted in <#%s>", guild.ReviewChannel)
+				}
+			}
+			reply(conn, msg, fmt.Sprintf("Review of new GIFs is %s. Usage: !list review [on [#channel]|off]", state))
+			return
+		}
+
+		enabled := parts[2] == "on"
+		reviewChannel := msg.ChannelID
 		if len(parts) >= 4 {
-			url := parts[3]
-			log.Printf("Attempting to remove specific URL for code %s: %s", code, url)
-
-			if s.gifList.RemoveGif(code, url) {
-				log.Printf("Successfully removed URL for code: %s", code)
-				session.ChannelMessageSend(m.ChannelID,
-					fmt.Sprintf("Removed GIF from code: `%s`", code))
-			} else {
-				log.Printf("Failed to remove URL for code: %s", code)
-				session.ChannelMessageSend(m.ChannelID,
-					fmt.Sprintf("URL not found for code: %s", code))
+			reviewChannel = parseChannelMention(parts[3])
+			if err := checkChannelGuild(conn, reviewChannel, msg.GuildID); err != nil {
+				log.Printf("Refused review channel %s for guild %q: %v", reviewChannel, msg.GuildID, err)
+				reply(conn, msg, "Error: "+err.Error())
+				return
 			}
+		}
+		log.Printf("Setting moderation in guild %q to %v (review channel %s)", msg.GuildID, enabled, reviewChannel)
+		if err := s.settings.SetModeration(msg.GuildID, enabled, reviewChannel); err != nil {
+			log.Printf("Error saving settings: %v", err)
+			reply(conn, msg, "Error: failed to save the setting")
+			return
+		}
+
+		if enabled {
+			reply(conn, msg, fmt.Sprintf("GIFs added by non-moderators will now be posted in <#%s> for approval", reviewChannel))
 		} else {
-			// Remove all GIFs for the code
-			log.Printf("Attempting to remove all GIFs for code: %s", code)
-
-			if s.gifList.RemoveCode(code) {
-				log.Printf("Successfully removed code: %s", code)
-				session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Removed code: `%s`", code))
-			} else {
-				log.Printf("Failed to remove non-existent code: %s", code)
-				session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Code not found: %s", code))
+			reply(conn, msg, "GIFs are now added right away again")
+		}
+
+	case "perms":
+		s.handlePermsCommand(conn, msg, parts)
+
+	case "cooldown":
+		s.handleCooldownCommand(conn, msg, parts)
+
+	case "pending":
+		pending := s.reviews.ForGuild(msg.GuildID).Pending()
+		if len(pending) == 0 {
+			reply(conn, msg, "No GIFs are waiting for review.")
+			return
+		}
+
+		listing := paginate.Listing{Title: fmt.Sprintf("Waiting for Review (%d)", len(pending))}
+		for _, submission := range pending {
+			listing.Items = append(listing.Items, paginate.Item{Line: fmt.Sprintf("`#%d` `%s` <%s> by <@%s>, %s",
+				submission.ID, submission.Code, submission.URL, submission.By, submission.At.Format("2006-01-02 15:04"))})
+		}
+		s.sendListing(conn, msg.ChannelID, listing)
+
+	case "approve", "reject":
+		if len(parts) < 3 {
+			reply(conn, msg, fmt.Sprintf("Usage: !list %s [submission-id]", parts[1]))
+			return
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(parts[2], "#"))
+		if err != nil {
+			reply(conn, msg, "Error: the submission ID must be a number")
+			return
+		}
+
+		approve := parts[1] == "approve"
+		submission, outcome, err := s.decideSubmission(conn, msg.GuildID, id, approve, msg.Author.ID)
+		if err != nil {
+			reply(conn, msg, "Error: "+err.Error())
+			return
+		}
+
+		color := reviewRejectedColor
+		if approve {
+			color = reviewApprovedColor
+		}
+		closeReviewMessage(conn, submission, outcome, color)
+		if submission.ChannelID != msg.ChannelID {
+			reply(conn, msg, fmt.Sprintf("Submission #%d: %s", id, outcome))
+		}
+
+	case "broken":
+		log.Println("Showing broken GIFs")
+
+		broken := gifList.BrokenGifs()
+		if len(broken) == 0 {
+			reply(conn, msg, "No broken GIFs found.")
+			return
+		}
+
+		listing := paginate.Listing{Title: fmt.Sprintf("Broken GIFs (%d)", len(broken))}
+		for _, b := range broken {
+			listing.Items = append(listing.Items, paginate.Item{Line: formatBrokenGif(b)})
+		}
+		s.sendListing(conn, msg.ChannelID, listing)
+
+	case "export":
+		log.Printf("Exporting gif list for guild %q", msg.GuildID)
+
+		data, err := gifList.Export()
+		if err != nil {
+			log.Printf("Error exporting gif list: %v", err)
+			reply(conn, msg, "Error: "+err.Error())
+			return
+		}
+
+		_, err = conn.Send(msg.ChannelID, chat.Response{
+			Text: fmt.Sprintf("Exported %d codes. Use `!list import` with this file to load it.", len(gifList.ListAllCodes())),
+			Files: []chat.File{{
+				Name:        exportFileName,
+				ContentType: "application/json",
+				Reader:      bytes.NewReader(data),
+			}},
+		})
+		if err != nil {
+			log.Printf("Error sending export: %v", err)
+		}
+
+	case "import":
+		if len(msg.Attachments) == 0 {
+			reply(conn, msg, "Usage: attach a file from `!list export` to `!list import [merge|replace|skip-existing] [dry-run]`")
+			return
+		}
+
+		strategy := giflist.ImportMerge
+		dryRun := false
+		for _, arg := range parts[2:] {
+			if strings.EqualFold(arg, "dry-run") || strings.EqualFold(arg, "dryrun") {
+				dryRun = true
+				continue
+			}
+			parsed, err := giflist.ParseImportStrategy(arg)
+			if err != nil {
+				reply(conn, msg, "Error: "+err.Error())
+				return
 			}
+			strategy = parsed
 		}
 
+		attachment := msg.Attachments[0]
+		log.Printf("Importing %s with %s strategy (dry run: %v)", attachment.Name, strategy, dryRun)
+
+		data, err := downloadAttachment(attachment)
+		if err != nil {
+			log.Printf("Error downloading import file: %v", err)
+			reply(conn, msg, "Error: "+err.Error())
+			return
+		}
+
+		imported, err := giflist.ParseImport(data)
+		if err != nil {
+			log.Printf("Error parsing import file: %v", err)
+			reply(conn, msg, "Error: that file isn't a gif list export")
+			return
+		}
+
+		report := gifList.Import(imported, strategy, dryRun, msg.Author.ID)
+		reply(conn, msg, formatImportReport(report))
+
 	case "help":
 		log.Println("Showing detailed help")
-		helpMsg := "**The List Bot Commands:**\n" +
-			"`!list show` - Display all available codes with GIF counts\n" +
-			"`!list show [code]` - Show all GIFs for a specific code\n" +
-			"`!list add [code] [url]` - Add a GIF URL to a code\n" +
-			"`!list remove [code]` - Remove all GIFs for a code\n" +
-			"`!list remove [code] [url]` - Remove a specific GIF URL from a code\n" +
-			"`!counts` - Display the daily code counts\n\n" + // Added combo command to help
-			"**Usage:**\n" +
-			"Type a code at the start of your message to trigger a random GIF\n" +
-			"Example: `gg` or `ty everyone`"
-		session.ChannelMessageSend(m.ChannelID, helpMsg)
+		helpLines := []string{
+			"`!list show` - Display all available codes with GIF counts",
+			"`!list show by [name|usage]` - Sort the codes alphabetically or by how often they're picked",
+			"`!list show [code]` - Show all GIFs for a specific code",
+			"`!list add [code] [url]` - Add a GIF URL to a code",
+			"`!list remove [code]` - Remove all GIFs for a code",
+			"`!list remove [code] [url]` - Remove a specific GIF URL from a code",
+			"`!list info [code]` - Show who added each GIF, when, and how often it's picked",
+			"`!list tag [code] [url] [tags...]` - Set the tags of a GIF (no tags clears them)",
+			"`!list weight [code] [url] [weight]` - Set how likely a GIF is to be picked in random mode (1-100, default 1)",
+			"`!list mode [code]` - Show how GIFs are picked for a code",
+			"`!list mode [code] [random|shuffle|roundrobin]` - Pick at random (weighted), shuffled without repeats, or in order",
+			"`!list alias [alias] [code]` - Make `alias` trigger `code`'s GIFs (remove it with `!list remove [alias]`)",
+			"`!list history` - Show the most recent changes to the list",
+			"`!list history [code]` - Show the most recent changes to a code",
+			"`!list revert [change-id]` - Put a code back the way it was before a change",
+			"`!list revert [change-id] force` - Revert even if the code has changed again since",
+			"`!list search [query]` - Find GIFs whose code, aliases, tags or link match every word of the query",
+			"`!list suggest [on|off]` - Reply to unknown codes typed in this channel with the closest existing ones",
+			"`!list review [on [#channel]|off]` - Admins only: hold GIFs added by everyone else for approval in a review channel",
+			"`!list pending` - Show the GIFs waiting for review",
+			"`!list approve [submission-id]` / `!list reject [submission-id]` - Moderators only: decide on a submission",
+			"`!list perms` - Show who can add, remove, remove whole codes, import, review submissions and change settings",
+			"`!list perms [grant|revoke] [capability] [@user|@role|everyone|manage-messages]` - Admins only: change who holds a capability",
+			"`!list perms reset [capability]` - Admins only: put a capability back to its default",
+			"`!list cooldown` - Show how often codes get a response",
+			"`!list cooldown [user|channel|code] [seconds|off]` - Admins only: wait this long between responses to the same user, in the same channel, or to the same code",
+			"`!list cooldown burst [count] [seconds]` - Admins only: allow at most `count` responses across the server in that time",
+			"`!list cooldown react [emoji|off]` - Admins only: react to limited codes instead of ignoring them silently",
+			"`!list cooldown count [on|off]` - Admins only: whether limited codes still count towards `!counts`",
+			fmt.Sprintf("`!list broken` - Show GIFs whose links failed the last check. Links that fail %d checks in a row are no longer posted",
+				giflist.DeadAfterFailures),
+			"`!list export` - Download the whole list as a JSON file",
+			"`!list import [merge|replace|skip-existing] [dry-run]` - Load a list from an attached JSON file. " +
+				"`merge` (default) adds new GIFs, `replace` makes the list match the file, `skip-existing` only adds new codes. " +
+				"`dry-run` previews the changes without making them",
+			"`!counts` - Display the daily code counts", // Added combo command to help
+			"`!counts by [name|usage]` - Sort the counts alphabetically or busiest first",
+			"",
+			"**Usage:**",
+			"Send a code as a message on its own to trigger a random GIF",
+			"Example: `gg` or `ty`",
+		}
+
+		// The help has outgrown a single message, so it is paged like any other listing
+		listing := paginate.Listing{Title: "The List Bot Commands"}
+		for _, line := range helpLines {
+			listing.Items = append(listing.Items, paginate.Item{Line: line})
+		}
+		s.sendListing(conn, msg.ChannelID, listing)
 
 	default:
 		log.Printf("Unknown list subcommand: %s", parts[1])
-		session.ChannelMessageSend(m.ChannelID, "Unknown command. Use `!list help` for help.")
+		reply(conn, msg, "Unknown command. Use `!list help` for help.")
+	}
+}
+
+// codeListing lists the GIFs of a code, reporting false if it has none
+func codeListing(gifList *giflist.GifList, code string) (paginate.Listing, bool) {
+	urls, found := gifList.GetAllGifsForCode(code)
+	if !found || len(urls) == 0 {
+		return paginate.Listing{}, false
+	}
+
+	listing := paginate.Listing{Title: fmt.Sprintf("GIFs for code `%s` (%d)", code, len(urls))}
+	if canonical := gifList.Resolve(code); canonical != code {
+		listing.Title = fmt.Sprintf("GIFs for code `%s` (alias of `%s`) (%d)", code, canonical, len(urls))
+	}
+	if aliases := gifList.AliasesOf(code); len(aliases) > 0 {
+		listing.Items = append(listing.Items, paginate.Item{Line: fmt.Sprintf("Aliases: `%s`", strings.Join(aliases, "`, `"))})
+	}
+	for i, url := range urls {
+		listing.Items = append(listing.Items, paginate.Item{Line: fmt.Sprintf("%d. %s", i+1, url)})
+	}
+	return listing, true
+}
+
+// codesListing lists every code with its GIF count, reporting false if the
+// list is empty
+func codesListing(gifList *giflist.GifList, order paginate.SortOrder) (paginate.Listing, bool) {
+	codeDetails := gifList.ListCodesWithCounts()
+	if len(codeDetails) == 0 {
+		return paginate.Listing{}, false
+	}
+
+	listing := paginate.Listing{Title: fmt.Sprintf("Available codes (%d)", len(codeDetails)), Sort: order}
+	for _, detail := range codeDetails {
+		line := fmt.Sprintf("`%s` (%d GIFs)", detail.Code, detail.GifCount)
+		if detail.AliasOf != "" {
+			line = fmt.Sprintf("`%s` → `%s` (alias, %d GIFs)", detail.Code, detail.AliasOf, detail.GifCount)
+		} else if detail.Mode != giflist.ModeRandom {
+			line += fmt.Sprintf(" [%s]", detail.Mode)
+		}
+		if order == paginate.SortUsage {
+			line += fmt.Sprintf(" · picked %d times", detail.Picks)
+		}
+		listing.Items = append(listing.Items, paginate.Item{Key: detail.Code, Usage: detail.Picks, Line: line})
+	}
+	return listing, true
+}
+
+// addGif adds a GIF for a member, or queues it for review when the guild
+// moderates additions, and returns the reply
+func (s *Server) addGif(conn chat.Conn, guildID string, channelID string, member permissions.Member, code string, url string) string {
+	gifList := s.gifLists.ForGuild(guildID)
+
+	// With moderation on, additions from everyone else wait for approval
+	if s.settings.Get(guildID).Moderation && !s.allowed(guildID, member, permissions.Review) {
+		if err := gifList.CheckAdd(code, url); err != nil {
+			log.Printf("Rejected submission for code %s: %v", code, err)
+			return "Error: " + err.Error()
+		}
+		return s.submitGif(conn, guildID, channelID, member.UserID, code, url)
 	}
+
+	log.Printf("Adding GIF for code %s: %s", code, url)
+
+	if err := gifList.AddGifBy(code, url, member.UserID); err != nil {
+		log.Printf("Error adding GIF: %v", err)
+		return "Error: " + err.Error()
+	}
+
+	urls, _ := gifList.GetAllGifsForCode(code)
+	log.Printf("Successfully added GIF for code: %s (now has %d GIFs)", code, len(urls))
+	return fmt.Sprintf("Added GIF for code: `%s` → %s (now has %d GIFs)", code, url, len(urls))
+}
+
+// removeGif removes one GIF from a code, or the whole code if url is empty,
+// and returns the reply
+func removeGif(gifList *giflist.GifList, code string, url string, by string) string {
+	if url != "" {
+		log.Printf("Attempting to remove specific URL for code %s: %s", code, url)
+
+		if gifList.RemoveGifBy(code, url, by) {
+			log.Printf("Successfully removed URL for code: %s", code)
+			return fmt.Sprintf("Removed GIF from code: `%s`", code)
+		}
+		log.Printf("Failed to remove URL for code: %s", code)
+		return fmt.Sprintf("URL not found for code: %s", code)
+	}
+
+	log.Printf("Attempting to remove all GIFs for code: %s", code)
+
+	if gifList.RemoveCodeBy(code, by) {
+		log.Printf("Successfully removed code: %s", code)
+		return fmt.Sprintf("Removed code: `%s`", code)
+	}
+	log.Printf("Failed to remove non-existent code: %s", code)
+	return fmt.Sprintf("Code not found: %s", code)
+}
+
+// infoListing describes who added each GIF of a code and how often it's
+// picked, reporting false if the code has no GIFs
+func infoListing(gifList *giflist.GifList, code string) (paginate.Listing, bool) {
+	gifs, found := gifList.GetGifDetails(code)
+	if !found {
+		return paginate.Listing{}, false
+	}
+
+	listing := paginate.Listing{Title: fmt.Sprintf("Info for code `%s` (%d GIFs)", code, len(gifs))}
+	for i, gif := range gifs {
+		listing.Items = append(listing.Items, paginate.Item{
+			Line: fmt.Sprintf("%d. <%s>\n   %s", i+1, gif.URL, formatGifInfo(gif)),
+		})
+	}
+	return listing, true
 }
 
 // handleComboCommand displays the daily counts
-func (s *Server) handleComboCommand(session *discordgo.Session, m *discordgo.MessageCreate) {
-	dailyCounts := s.comboTracker.GetDailyCounts()
-	lifetimeCounts := s.comboTracker.GetLifetimeCounts()
+func (s *Server) handleComboCommand(conn chat.Conn, msg chat.Message) {
+	combos := s.combos.ForGuild(msg.GuildID)
+	dailyCounts := combos.GetDailyCounts()
+	lifetimeCounts := combos.GetLifetimeCounts()
 
 	if len(dailyCounts) == 0 && len(lifetimeCounts) == 0 {
-		session.ChannelMessageSend(m.ChannelID, "No codes have been used yet.")
+		reply(conn, msg, "No codes have been used yet.")
 		return
 	}
 
-	message := "**Daily Code Counts:**\n"
-	for code, count := range dailyCounts {
-		message += fmt.Sprintf("`%s`: %d\n", code, count)
+	// "!counts by name" sorts alphabetically, the busiest codes come first otherwise
+	order := paginate.SortUsage
+	if parts := strings.Fields(msg.Content); len(parts) >= 3 && parts[1] == "by" {
+		if parsed, ok := paginate.ParseSortOrder(parts[2]); ok {
+			order = parsed
+		}
+	}
+
+	s.sendListing(conn, msg.ChannelID, countsListing("Daily Code Counts", dailyCounts, order))
+	s.sendListing(conn, msg.ChannelID, countsListing("Lifetime Code Counts", lifetimeCounts, order))
+}
+
+// countsListing turns code counts into a sortable listing
+func countsListing(title string, counts map[string]int, order paginate.SortOrder) paginate.Listing {
+	listing := paginate.Listing{Title: title, Sort: order}
+	for code, count := range counts {
+		listing.Items = append(listing.Items, paginate.Item{
+			Key:   code,
+			Usage: count,
+			Line:  fmt.Sprintf("`%s`: %d", code, count),
+		})
+	}
+	if len(listing.Items) == 0 {
+		listing.Items = append(listing.Items, paginate.Item{Line: "No codes used yet."})
+	}
+	return listing
+}
+
+// historyLimit is how many changes !list history shows
+const historyLimit = 100
+
+// historyListing lists the most recent changes, to one code if code isn't
+// empty, reporting false if nothing was recorded
+func historyListing(gifList *giflist.GifList, code string) (paginate.Listing, bool) {
+	changes := gifList.History(code, historyLimit)
+	if len(changes) == 0 {
+		return paginate.Listing{}, false
+	}
+
+	listing := paginate.Listing{Title: "Recent changes"}
+	if code != "" {
+		listing.Title = fmt.Sprintf("Recent changes to `%s`", code)
+	}
+	for _, change := range changes {
+		listing.Items = append(listing.Items, paginate.Item{Line: formatChange(change)})
+	}
+	return listing, true
+}
+
+// formatChange describes a recorded change on a single line
+func formatChange(change giflist.Change) string {
+	by := "the bot"
+	if change.By != "" {
+		by = fmt.Sprintf("<@%s>", change.By)
+	}
+
+	line := fmt.Sprintf("`#%d` %s · `%s` %s", change.ID, change.At.Format("2006-01-02 15:04"), change.Code, change.Action)
+	if strings.HasPrefix(change.Detail, "http") {
+		// Angle brackets stop Discord from embedding every GIF in the history
+		line += " <" + change.Detail + ">"
+	} else if change.Detail != "" {
+		line += " " + change.Detail
+	}
+
+	// Summarize the effect on the pool size
+	beforeCount, afterCount := 0, 0
+	if change.Before != nil {
+		beforeCount = len(change.Before.Gifs)
+	}
+	if change.After != nil {
+		afterCount = len(change.After.Gifs)
+	}
+	if beforeCount != afterCount {
+		line += fmt.Sprintf(" (%d → %d GIFs)", beforeCount, afterCount)
+	}
+
+	return line + " by " + by
+}
+
+// searchListing lists every search result
+func searchListing(query string, results []giflist.SearchResult) paginate.Listing {
+	listing := paginate.Listing{Title: fmt.Sprintf("%d results for \"%s\"", len(results), query)}
+	for i, result := range results {
+		// Angle brackets stop Discord from embedding every GIF in the results
+		line := fmt.Sprintf("%d. `%s` <%s>", i+1, result.Code, result.Gif.URL)
+		if len(result.Gif.Tags) > 0 {
+			line += " · " + strings.Join(result.Gif.Tags, ", ")
+		}
+		listing.Items = append(listing.Items, paginate.Item{Line: line})
 	}
+	return listing
+}
+
+// maxSuggestions is how many codes a "did you mean" hint offers
+const maxSuggestions = 3
 
-	message += "\n**Lifetime Code Counts:**\n"
-	for code, count := range lifetimeCounts {
-		message += fmt.Sprintf("`%s`: %d\n", code, count)
+// didYouMean returns a hint naming the codes closest to an unknown code,
+// starting with a space, or "" if nothing is close
+func didYouMean(gifList *giflist.GifList, code string) string {
+	suggestions := gifList.Suggest(code, maxSuggestions)
+	if len(suggestions) == 0 {
+		return ""
 	}
 
-	session.ChannelMessageSend(m.ChannelID, message)
+	quoted := make([]string, len(suggestions))
+	for i, suggestion := range suggestions {
+		quoted[i] = "`" + suggestion + "`"
+	}
+	if len(quoted) == 1 {
+		return " Did you mean " + quoted[0] + "?"
+	}
+	return " Did you mean " + strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1] + "?"
+}
+
+// formatBrokenGif describes a GIF that failed its link check on a single line
+func formatBrokenGif(b giflist.BrokenGif) string {
+	// Angle brackets stop Discord from trying to embed the broken link
+	line := fmt.Sprintf("`%s` <%s> · %s", b.Code, b.Gif.URL, b.Gif.CheckError)
+	if b.Gif.Failures == 1 {
+		line += " · failed once"
+	} else {
+		line += fmt.Sprintf(" · failed %d times in a row", b.Gif.Failures)
+	}
+	line += " (last checked " + b.Gif.CheckedAt.Format("2006-01-02 15:04") + ")"
+	if b.Gif.Dead() && b.Gif.Mirror != "" {
+		line += " · **dead, posting local copy**"
+	} else if b.Gif.Dead() {
+		line += " · **dead, no longer posted**"
+	}
+	return line
+}
+
+// mirrorFileName names an uploaded mirror copy after the original URL so
+// Discord shows it the same way
+func mirrorFileName(gifURL string) string {
+	name := "mirrored.gif"
+	if parsed, err := url.Parse(gifURL); err == nil {
+		if base := path.Base(parsed.Path); path.Ext(base) != "" {
+			name = base
+		}
+	}
+	return name
+}
+
+// formatGifInfo describes a GIF's metadata on a single line
+func formatGifInfo(gif giflist.Gif) string {
+	addedBy := "unknown"
+	if gif.AddedBy != "" {
+		addedBy = fmt.Sprintf("<@%s>", gif.AddedBy)
+	}
+
+	info := "Added by " + addedBy
+	if !gif.AddedAt.IsZero() {
+		info += " on " + gif.AddedAt.Format("2006-01-02")
+	}
+
+	info += fmt.Sprintf(" · Weight %d · Picked %d times", gif.EffectiveWeight(), gif.PickCount)
+	if !gif.LastPicked.IsZero() {
+		info += " (last " + gif.LastPicked.Format("2006-01-02 15:04") + ")"
+	}
+
+	if len(gif.Tags) > 0 {
+		info += " · Tags: " + strings.Join(gif.Tags, ", ")
+	}
+	if gif.Dead() {
+		info += " · Link dead"
+		if gif.Mirror != "" {
+			info += ", posting local copy"
+		}
+	}
+	return info
 }
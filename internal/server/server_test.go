@@ -1,7 +1,9 @@
 package server
 
 import (
+	"fmt"
 	"regexp"
+	"slices"
 	"testing"
 )
 
@@ -103,3 +105,31 @@ func TestStartOfMessageCodeOnly(t *testing.T) {
 		}
 	}
 }
+
+func TestCompleteCode(t *testing.T) {
+	codes := []string{"ggez", "ty", "egg", "lol", "gg"}
+
+	got := completeCode(codes, "gg")
+	want := []string{"gg", "ggez", "egg"}
+	if len(got) != len(want) {
+		t.Fatalf("completeCode = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("completeCode = %v, want %v", got, want)
+			break
+		}
+	}
+
+	many := make([]string, 40)
+	for i := range many {
+		many[i] = fmt.Sprintf("c%d", i)
+	}
+	got = completeCode(many, "")
+	if len(got) != maxChoices {
+		t.Fatalf("Expected %d choices, got %d", maxChoices, len(got))
+	}
+	if !slices.IsSorted(got) || got[0] != "c0" {
+		t.Errorf("Expected the first codes alphabetically, got %v", got)
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"theListBot/internal/chat"
+	"theListBot/internal/giflist"
+	"time"
+)
+
+// exportFileName is the name of the file !list export uploads
+const exportFileName = "gifcodes.json"
+
+// maxImportSize caps how much of an attachment !list import will read
+const maxImportSize = 5 << 20
+
+// importPreviewSize is how many items of each kind an import report lists
+const importPreviewSize = 5
+
+// attachmentClient downloads attachments, with a timeout so a slow CDN
+// can't hold up the message handler
+var attachmentClient = &http.Client{Timeout: 30 * time.Second}
+
+// downloadAttachment fetches the contents of a message attachment
+func downloadAttachment(attachment chat.Attachment) ([]byte, error) {
+	if attachment.Size > maxImportSize {
+		return nil, fmt.Errorf("file is too large (%d bytes, limit %d)", attachment.Size, maxImportSize)
+	}
+
+	resp, err := attachmentClient.Get(attachment.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %v", attachment.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", attachment.Name, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImportSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", attachment.Name, err)
+	}
+	if len(data) > maxImportSize {
+		return nil, fmt.Errorf("file is too large (limit %d bytes)", maxImportSize)
+	}
+	return data, nil
+}
+
+// formatImportReport summarizes an import, listing the first few items of
+// each kind
+func formatImportReport(report giflist.ImportReport) string {
+	var b strings.Builder
+	if report.DryRun {
+		fmt.Fprintf(&b, "**Import preview (%s, nothing changed yet):**\n", report.Strategy)
+	} else {
+		fmt.Fprintf(&b, "**Imported with %s:**\n", report.Strategy)
+	}
+	fmt.Fprintf(&b, "%d added, %d removed, %d skipped\n",
+		len(report.Added), len(report.Removed), len(report.Skipped))
+
+	writeImportItems(&b, "Added", report.Added)
+	writeImportItems(&b, "Removed", report.Removed)
+	writeImportItems(&b, "Skipped", report.Skipped)
+
+	if report.DryRun {
+		b.WriteString("\nRun the same command without `dry-run` to apply it.")
+	}
+	return b.String()
+}
+
+// writeImportItems lists up to importPreviewSize items under a heading
+func writeImportItems(b *strings.Builder, heading string, items []giflist.ImportItem) {
+	if len(items) == 0 {
+		return
+	}
+
+	fmt.Fprintf(b, "\n**%s:**\n", heading)
+	for i, item := range items {
+		if i == importPreviewSize {
+			fmt.Fprintf(b, "...and %d more\n", len(items)-importPreviewSize)
+			break
+		}
+
+		line := fmt.Sprintf("`%s`", item.Code)
+		switch {
+		case item.AliasOf != "":
+			line += fmt.Sprintf(" → `%s`", item.AliasOf)
+		case item.URL != "":
+			// Angle brackets stop Discord from embedding every GIF
+			line += " <" + item.URL + ">"
+		}
+		if item.Reason != "" {
+			line += " (" + item.Reason + ")"
+		}
+		b.WriteString("- " + line + "\n")
+	}
+}
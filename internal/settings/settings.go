@@ -0,0 +1,171 @@
+// Package settings stores per-guild bot settings that moderators change
+// with commands
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"theListBot/internal/cooldown"
+	"theListBot/internal/permissions"
+	"theListBot/internal/safefile"
+)
+
+// fileName is the settings file kept in each guild's directory
+const fileName = "settings.json"
+
+// Guild holds the settings of one guild
+type Guild struct {
+	SuggestChannels []string `json:"suggest_channels,omitempty"` // Channels where unknown codes get "did you mean" replies
+	Moderation      bool     `json:"moderation,omitempty"`       // Additions by non-moderators wait for approval
+	ReviewChannel   string   `json:"review_channel,omitempty"`   // Where submissions are posted for review
+
+	Cooldown cooldown.Config `json:"cooldown,omitempty"` // Limits on how often codes get a response
+
+	// Who holds each capability, capabilities not listed use the default rule
+	Permissions map[permissions.Capability]permissions.Rule `json:"permissions,omitempty"`
+}
+
+// copyGuild returns a deep copy of a guild's settings
+func copyGuild(g *Guild) Guild {
+	copied := *g
+	copied.SuggestChannels = slices.Clone(g.SuggestChannels)
+	if g.Permissions != nil {
+		copied.Permissions = make(map[permissions.Capability]permissions.Rule, len(g.Permissions))
+		for c, rule := range g.Permissions {
+			rule.Users, rule.Roles = slices.Clone(rule.Users), slices.Clone(rule.Roles)
+			copied.Permissions[c] = rule
+		}
+	}
+	return copied
+}
+
+// Suggests reports whether a channel has "did you mean" replies turned on
+func (g Guild) Suggests(channelID string) bool {
+	return slices.Contains(g.SuggestChannels, channelID)
+}
+
+// Rule returns who holds a capability in the guild
+func (g Guild) Rule(c permissions.Capability) permissions.Rule {
+	if rule, ok := g.Permissions[c]; ok {
+		return rule
+	}
+	return permissions.DefaultRule(c)
+}
+
+// Registry loads and saves the settings of every guild
+type Registry struct {
+	mutex  sync.Mutex
+	dirFor func(guildID string) string // Directory holding a guild's files
+	guilds map[string]*Guild           // Keyed by directory
+}
+
+// NewRegistry creates a Registry that keeps each guild's settings in the
+// directory returned by dirFor
+func NewRegistry(dirFor func(guildID string) string) *Registry {
+	return &Registry{
+		dirFor: dirFor,
+		guilds: make(map[string]*Guild),
+	}
+}
+
+// Get returns a copy of a guild's settings
+func (r *Registry) Get(guildID string) Guild {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return copyGuild(r.loadLocked(r.dirFor(guildID)))
+}
+
+// Update changes a guild's settings and saves them. The change is made to a
+// copy that only takes effect once it is saved, so a failed save leaves the
+// guild as it was.
+func (r *Registry) Update(guildID string, change func(g *Guild)) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	dir := r.dirFor(guildID)
+	next := copyGuild(r.loadLocked(dir))
+	change(&next)
+
+	data, err := json.MarshalIndent(&next, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := safefile.WriteFile(filepath.Join(dir, fileName), data, 0644, safefile.BackupCount()); err != nil {
+		return err
+	}
+	r.guilds[dir] = &next
+	return nil
+}
+
+// SetSuggest turns "did you mean" replies for a channel on or off
+func (r *Registry) SetSuggest(guildID string, channelID string, enabled bool) error {
+	return r.Update(guildID, func(g *Guild) {
+		index := slices.Index(g.SuggestChannels, channelID)
+		if enabled && index < 0 {
+			g.SuggestChannels = append(g.SuggestChannels, channelID)
+		} else if !enabled && index >= 0 {
+			g.SuggestChannels = slices.Delete(g.SuggestChannels, index, index+1)
+		}
+	})
+}
+
+// SetModeration turns the approval queue on or off, posting submissions
+// for review in reviewChannel
+func (r *Registry) SetModeration(guildID string, enabled bool, reviewChannel string) error {
+	return r.Update(guildID, func(g *Guild) {
+		g.Moderation = enabled
+		if enabled {
+			g.ReviewChannel = reviewChannel
+		}
+	})
+}
+
+// SetRule changes who holds a capability
+func (r *Registry) SetRule(guildID string, c permissions.Capability, change func(rule permissions.Rule) permissions.Rule) error {
+	return r.Update(guildID, func(g *Guild) {
+		if g.Permissions == nil {
+			g.Permissions = make(map[permissions.Capability]permissions.Rule)
+		}
+		g.Permissions[c] = change(g.Rule(c))
+	})
+}
+
+// ResetRule puts a capability back to its default rule
+func (r *Registry) ResetRule(guildID string, c permissions.Capability) error {
+	return r.Update(guildID, func(g *Guild) {
+		delete(g.Permissions, c)
+	})
+}
+
+// loadLocked returns the cached settings for a guild directory, reading
+// them on first use. Callers must hold the lock.
+func (r *Registry) loadLocked(dir string) *Guild {
+	if g, ok := r.guilds[dir]; ok {
+		return g
+	}
+
+	g := &Guild{}
+	err := safefile.ReadFile(filepath.Join(dir, fileName), func(data []byte) error {
+		loaded := &Guild{}
+		if err := json.Unmarshal(data, loaded); err != nil {
+			return err
+		}
+		g = loaded
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Error loading settings from %s, using defaults: %v", dir, err)
+	}
+
+	r.guilds[dir] = g
+	return g
+}
@@ -0,0 +1,82 @@
+package settings
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"theListBot/internal/permissions"
+)
+
+func TestSuggestChannelsPersist(t *testing.T) {
+	root := t.TempDir()
+	dirFor := func(guildID string) string { return filepath.Join(root, guildID) }
+
+	registry := NewRegistry(dirFor)
+	if registry.Get("g1").Suggests("c1") {
+		t.Fatal("Suggestions should be off by default")
+	}
+
+	if err := registry.SetSuggest("g1", "c1", true); err != nil {
+		t.Fatalf("SetSuggest failed: %v", err)
+	}
+	registry.SetSuggest("g1", "c2", true)
+	registry.SetSuggest("g1", "c2", false)
+
+	reloaded := NewRegistry(dirFor)
+	g1 := reloaded.Get("g1")
+	if !g1.Suggests("c1") || g1.Suggests("c2") {
+		t.Errorf("Unexpected channels after reload: %v", g1.SuggestChannels)
+	}
+	if reloaded.Get("g2").Suggests("c1") {
+		t.Error("Settings should not leak between guilds")
+	}
+}
+
+func TestPermissionRulesPersist(t *testing.T) {
+	root := t.TempDir()
+	dirFor := func(guildID string) string { return filepath.Join(root, guildID) }
+
+	registry := NewRegistry(dirFor)
+	if !registry.Get("g1").Rule(permissions.Add).Everyone {
+		t.Fatal("Everyone should be able to add by default")
+	}
+
+	err := registry.SetRule("g1", permissions.Add, func(rule permissions.Rule) permissions.Rule {
+		return rule.Without(permissions.Grantee{Everyone: true}).With(permissions.Grantee{Role: "r1"})
+	})
+	if err != nil {
+		t.Fatalf("SetRule failed: %v", err)
+	}
+
+	rule := NewRegistry(dirFor).Get("g1").Rule(permissions.Add)
+	if rule.Everyone || len(rule.Roles) != 1 || rule.Roles[0] != "r1" {
+		t.Errorf("Unexpected rule after reload: %+v", rule)
+	}
+
+	registry.ResetRule("g1", permissions.Add)
+	if !NewRegistry(dirFor).Get("g1").Rule(permissions.Add).Everyone {
+		t.Error("Reset should restore the default rule")
+	}
+}
+
+func TestFailedSaveKeepsOldSettings(t *testing.T) {
+	root := t.TempDir()
+	// A file where the guild's directory should be makes every save fail
+	if err := os.WriteFile(filepath.Join(root, "g1"), nil, 0644); err != nil {
+		t.Fatalf("Failed to create blocking file: %v", err)
+	}
+	registry := NewRegistry(func(guildID string) string { return filepath.Join(root, guildID) })
+
+	err := registry.SetRule("g1", permissions.Add, func(rule permissions.Rule) permissions.Rule {
+		return rule.Without(permissions.Grantee{Everyone: true})
+	})
+	if err == nil {
+		t.Fatal("Expected the save to fail")
+	}
+	if !registry.Get("g1").Rule(permissions.Add).Everyone {
+		t.Error("A rule that failed to save should not take effect")
+	}
+	if registry.SetSuggest("g1", "c1", true) == nil || registry.Get("g1").Suggests("c1") {
+		t.Error("A setting that failed to save should not take effect")
+	}
+}